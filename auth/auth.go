@@ -0,0 +1,64 @@
+// Package auth CONNECT认证，认证失败的错误映射为CONNACK的原因码
+package auth
+
+import (
+	"fmt"
+
+	msproto "github.com/mushanyux/MSIMGoProto"
+	"github.com/pkg/errors"
+)
+
+// Authenticator 认证CONNECT中的UID和Token，返回nil表示通过
+type Authenticator interface {
+	Authenticate(connect *msproto.ConnectPacket) error
+}
+
+// AuthenticatorFunc 函数形式的Authenticator
+type AuthenticatorFunc func(connect *msproto.ConnectPacket) error
+
+func (f AuthenticatorFunc) Authenticate(connect *msproto.ConnectPacket) error {
+	return f(connect)
+}
+
+// Error 认证失败，ReasonCode为CONNACK中返回的原因码
+type Error struct {
+	ReasonCode msproto.ReasonCode
+	Err        error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %v", e.ReasonCode, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// authFail Token无效
+func authFail(err error) error {
+	return &Error{ReasonCode: msproto.ReasonAuthFail, Err: err}
+}
+
+// queryTokenError 无法查询Token（如密钥获取失败），与Token本身无关
+func queryTokenError(err error) error {
+	return &Error{ReasonCode: msproto.ReasonQueryTokenError, Err: err}
+}
+
+// ReasonCodeOf 认证结果对应的原因码，err为nil时为ReasonSuccess，不是*Error的错误为ReasonAuthFail
+func ReasonCodeOf(err error) msproto.ReasonCode {
+	if err == nil {
+		return msproto.ReasonSuccess
+	}
+	var authErr *Error
+	if errors.As(err, &authErr) {
+		return authErr.ReasonCode
+	}
+	return msproto.ReasonAuthFail
+}
+
+// Connack 认证connect并返回对应原因码的CONNACK
+func Connack(a Authenticator, connect *msproto.ConnectPacket) *msproto.ConnackPacket {
+	return &msproto.ConnackPacket{
+		ReasonCode: ReasonCodeOf(a.Authenticate(connect)),
+	}
+}
@@ -0,0 +1,207 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	msproto "github.com/mushanyux/MSIMGoProto"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrMalformedToken Token格式错误
+	ErrMalformedToken = errors.New("malformed token")
+	// ErrInvalidSignature Token签名错误
+	ErrInvalidSignature = errors.New("invalid token signature")
+	// ErrTokenExpired Token已过期
+	ErrTokenExpired = errors.New("token expired")
+	// ErrUIDMismatch Token不属于该UID
+	ErrUIDMismatch = errors.New("token uid mismatch")
+	// ErrDeviceFlagMismatch Token不属于该设备类型
+	ErrDeviceFlagMismatch = errors.New("token device flag mismatch")
+	// ErrUnknownKey 签名Token的密钥不存在
+	ErrUnknownKey = errors.New("unknown token key")
+	// ErrKeyTooShort 签名密钥短于MinKeySize
+	ErrKeyTooShort = errors.New("token key too short")
+)
+
+// MinKeySize 签名密钥的最小长度，与HMAC-SHA256的输出长度一致
+const MinKeySize = sha256.Size
+
+// KeyFunc 根据密钥ID获取验证Token的密钥，不存在时返回nil，
+// 返回错误或者短于MinKeySize的密钥时（如查询密钥服务失败）认证结果为ReasonQueryTokenError
+type KeyFunc func(keyID string) ([]byte, error)
+
+// TokenOptions Token配置
+type TokenOptions struct {
+	TTL    time.Duration    // Token有效期
+	Leeway time.Duration    // 允许的时钟误差
+	Keys   KeyFunc          // 验证其它密钥签名的Token（如密钥轮换），为nil时只接受当前密钥
+	Now    func() time.Time // 当前时间
+}
+
+// NewTokenOptions 默认配置
+func NewTokenOptions() *TokenOptions {
+	return &TokenOptions{
+		TTL: 7 * 24 * time.Hour,
+		Now: time.Now,
+	}
+}
+
+type TokenOption func(*TokenOptions)
+
+// WithTTL Token有效期
+func WithTTL(ttl time.Duration) TokenOption {
+	return func(o *TokenOptions) {
+		o.TTL = ttl
+	}
+}
+
+// WithLeeway 允许的时钟误差
+func WithLeeway(leeway time.Duration) TokenOption {
+	return func(o *TokenOptions) {
+		o.Leeway = leeway
+	}
+}
+
+// WithKeys 验证其它密钥签名的Token
+func WithKeys(keys KeyFunc) TokenOption {
+	return func(o *TokenOptions) {
+		o.Keys = keys
+	}
+}
+
+// WithNow 当前时间
+func WithNow(now func() time.Time) TokenOption {
+	return func(o *TokenOptions) {
+		o.Now = now
+	}
+}
+
+// Claims Token中的内容
+type Claims struct {
+	KeyID      string             `json:"kid,omitempty"`
+	UID        string             `json:"uid"`
+	DeviceFlag msproto.DeviceFlag `json:"df"`
+	IssuedAt   int64              `json:"iat"` // 签发时间，Unix秒
+	ExpiresAt  int64              `json:"exp"` // 过期时间，Unix秒
+}
+
+// TokenAuth HMAC-SHA256签名的Token，绑定UID和设备类型，格式为 base64url(Claims的json).base64url(签名)
+type TokenAuth struct {
+	opts  *TokenOptions
+	keyID string
+	key   []byte
+}
+
+// NewTokenAuth 使用key签发和验证Token，keyID写入Token用于密钥轮换，可以为空
+// key短于MinKeySize时返回ErrKeyTooShort
+func NewTokenAuth(keyID string, key []byte, opts ...TokenOption) (*TokenAuth, error) {
+	if len(key) < MinKeySize {
+		return nil, errors.Wrapf(ErrKeyTooShort, "key length %d, need at least %d", len(key), MinKeySize)
+	}
+	o := NewTokenOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+	return &TokenAuth{
+		opts:  o,
+		keyID: keyID,
+		key:   append([]byte(nil), key...),
+	}, nil
+}
+
+// Issue 签发uid在deviceFlag类型设备上使用的Token
+func (a *TokenAuth) Issue(uid string, deviceFlag msproto.DeviceFlag) (string, error) {
+	now := a.opts.Now()
+	return a.Sign(&Claims{
+		KeyID:      a.keyID,
+		UID:        uid,
+		DeviceFlag: deviceFlag,
+		IssuedAt:   now.Unix(),
+		ExpiresAt:  now.Add(a.opts.TTL).Unix(),
+	})
+}
+
+// Sign 用当前密钥签名claims，claims的KeyID应与当前密钥一致
+func (a *TokenAuth) Sign(claims *Claims) (string, error) {
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(sign(a.key, payload)), nil
+}
+
+// Verify 验证token属于uid和deviceFlag且没有过期
+func (a *TokenAuth) Verify(token, uid string, deviceFlag msproto.DeviceFlag) (*Claims, error) {
+	payload, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, authFail(ErrMalformedToken)
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, authFail(errors.Wrap(ErrMalformedToken, err.Error()))
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return nil, authFail(errors.Wrap(ErrMalformedToken, err.Error()))
+	}
+	claims := &Claims{}
+	if err = json.Unmarshal(data, claims); err != nil {
+		return nil, authFail(errors.Wrap(ErrMalformedToken, err.Error()))
+	}
+	key, err := a.lookup(claims.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(mac, sign(key, payload)) {
+		return nil, authFail(ErrInvalidSignature)
+	}
+	if a.opts.Now().Add(-a.opts.Leeway).Unix() >= claims.ExpiresAt {
+		return nil, authFail(ErrTokenExpired)
+	}
+	if claims.UID != uid {
+		return nil, authFail(ErrUIDMismatch)
+	}
+	if claims.DeviceFlag != deviceFlag {
+		return nil, authFail(ErrDeviceFlagMismatch)
+	}
+	return claims, nil
+}
+
+// Authenticate 验证CONNECT中的Token
+func (a *TokenAuth) Authenticate(connect *msproto.ConnectPacket) error {
+	_, err := a.Verify(connect.Token, connect.UID, connect.DeviceFlag)
+	return err
+}
+
+func (a *TokenAuth) lookup(keyID string) ([]byte, error) {
+	if keyID == a.keyID {
+		return a.key, nil
+	}
+	if a.opts.Keys == nil {
+		return nil, authFail(errors.Wrapf(ErrUnknownKey, "key id %q", keyID))
+	}
+	key, err := a.opts.Keys(keyID)
+	if err != nil {
+		return nil, queryTokenError(err)
+	}
+	if key == nil {
+		return nil, authFail(errors.Wrapf(ErrUnknownKey, "key id %q", keyID))
+	}
+	if len(key) < MinKeySize {
+		return nil, queryTokenError(errors.Wrapf(ErrKeyTooShort, "key id %q", keyID))
+	}
+	return key, nil
+}
+
+func sign(key []byte, payload string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,137 @@
+package auth_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	msproto "github.com/mushanyux/MSIMGoProto"
+	"github.com/mushanyux/MSIMGoProto/auth"
+	"github.com/mushanyux/MSIMGoProto/broker"
+	"github.com/mushanyux/MSIMGoProto/client"
+)
+
+var testKey = bytes.Repeat([]byte("k"), auth.MinKeySize)
+
+func newTokenAuth(t *testing.T, keyID string, key []byte, opts ...auth.TokenOption) *auth.TokenAuth {
+	t.Helper()
+	a, err := auth.NewTokenAuth(keyID, key, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestNewTokenAuthKeySize(t *testing.T) {
+	for _, key := range [][]byte{nil, {}, testKey[:auth.MinKeySize-1]} {
+		if _, err := auth.NewTokenAuth("k1", key); !errors.Is(err, auth.ErrKeyTooShort) {
+			t.Errorf("NewTokenAuth(%d byte key) = %v, want ErrKeyTooShort", len(key), err)
+		}
+	}
+	newTokenAuth(t, "k1", testKey)
+}
+
+func TestTokenVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	a := newTokenAuth(t, "k1", testKey, auth.WithTTL(time.Hour), auth.WithNow(func() time.Time { return now }))
+	token, err := a.Issue("u1", msproto.APP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := a.Verify(token, "u1", msproto.APP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.KeyID != "k1" || claims.ExpiresAt != now.Add(time.Hour).Unix() {
+		t.Errorf("claims = %+v", claims)
+	}
+
+	payload, signature, _ := strings.Cut(token, ".")
+	later := newTokenAuth(t, "k1", testKey, auth.WithNow(func() time.Time { return now.Add(time.Hour) }))
+	other := newTokenAuth(t, "k1", bytes.Repeat([]byte("x"), auth.MinKeySize))
+	tests := []struct {
+		name       string
+		a          *auth.TokenAuth
+		token      string
+		uid        string
+		deviceFlag msproto.DeviceFlag
+		want       error
+	}{
+		{"malformed", a, "no-dot", "u1", msproto.APP, auth.ErrMalformedToken},
+		{"bad base64", a, payload + ".!!", "u1", msproto.APP, auth.ErrMalformedToken},
+		{"tampered signature", a, payload + "." + strings.Repeat("A", len(signature)), "u1", msproto.APP, auth.ErrInvalidSignature},
+		{"other key", other, token, "u1", msproto.APP, auth.ErrInvalidSignature},
+		{"expired", later, token, "u1", msproto.APP, auth.ErrTokenExpired},
+		{"uid mismatch", a, token, "u2", msproto.APP, auth.ErrUIDMismatch},
+		{"device mismatch", a, token, "u1", msproto.PC, auth.ErrDeviceFlagMismatch},
+		{"unknown key", newTokenAuth(t, "k2", testKey), token, "u1", msproto.APP, auth.ErrUnknownKey},
+	}
+	for _, tt := range tests {
+		_, err := tt.a.Verify(tt.token, tt.uid, tt.deviceFlag)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.want)
+		}
+		if code := auth.ReasonCodeOf(err); code != msproto.ReasonAuthFail {
+			t.Errorf("%s: reason code = %s, want ReasonAuthFail", tt.name, code)
+		}
+	}
+}
+
+func TestTokenKeyRotation(t *testing.T) {
+	old := newTokenAuth(t, "k1", testKey)
+	token, err := old.Issue("u1", msproto.APP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newKey := bytes.Repeat([]byte("n"), auth.MinKeySize)
+	keys := map[string][]byte{"k1": testKey, "short": []byte("short")}
+	current := newTokenAuth(t, "k2", newKey, auth.WithKeys(func(keyID string) ([]byte, error) {
+		if keyID == "down" {
+			return nil, errors.New("key service unavailable")
+		}
+		return keys[keyID], nil
+	}))
+	if _, err = current.Verify(token, "u1", msproto.APP); err != nil {
+		t.Fatalf("token signed with the previous key: %v", err)
+	}
+
+	// 密钥服务出错或者返回短密钥时无法验证，与Token本身无关
+	for _, keyID := range []string{"short", "down"} {
+		forged, err := newTokenAuth(t, keyID, testKey).Issue("u1", msproto.APP)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = current.Verify(forged, "u1", msproto.APP)
+		if code := auth.ReasonCodeOf(err); code != msproto.ReasonQueryTokenError {
+			t.Errorf("key %q: err = %v, want ReasonQueryTokenError", keyID, err)
+		}
+	}
+}
+
+func TestTokenAuthBroker(t *testing.T) {
+	a := newTokenAuth(t, "k1", testKey)
+	b := broker.New(broker.WithAuthenticator(a))
+	defer b.Close()
+	token, err := a.Issue("u1", msproto.APP)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := client.Connect(b.Pipe(), "u1", token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = s.Close()
+
+	_, err = client.Connect(b.Pipe(), "u2", token)
+	var connackErr *client.ConnackError
+	if !errors.As(err, &connackErr) || connackErr.ReasonCode != msproto.ReasonAuthFail {
+		t.Fatalf("token of another uid: err = %v, want ReasonAuthFail", err)
+	}
+	_, err = client.Connect(b.Pipe(), "u1", token, client.WithDeviceFlag(msproto.PC))
+	if !errors.As(err, &connackErr) || connackErr.ReasonCode != msproto.ReasonAuthFail {
+		t.Fatalf("token of another device: err = %v, want ReasonAuthFail", err)
+	}
+}
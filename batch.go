@@ -0,0 +1,102 @@
+package msproto
+
+import (
+	"bytes"
+	"io"
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+// FrameSize 包编码后的总大小（固定报头+剩余长度）
+func (l *MSProto) FrameSize(frame Frame, version uint8) (int, error) {
+	frame, err := normalizeFrame(frame)
+	if err != nil {
+		return 0, err
+	}
+	frameType := frame.GetFrameType()
+	if frameType == PING || frameType == PONG {
+		return 1, nil
+	}
+	c := l.frameCodec(frameType)
+	if c == nil || c.size == nil {
+		return 0, errors.Wrapf(ErrUnknownFrameType, "%s", l.FrameTypeName(frameType))
+	}
+	if err = checkBuiltinPacket(frameType, frame); err != nil {
+		return 0, err
+	}
+	remainingLength := c.size(frame, version)
+	if remainingLength < 0 {
+		return 0, &EncodeError{FrameType: frameType, Err: errors.Errorf("invalid remaining length %d", remainingLength)}
+	}
+	return 1 + variableLength(uint32(remainingLength)) + remainingLength, nil
+}
+
+// EncodeFrames 将多个包编码到一块连续的内存中
+func (l *MSProto) EncodeFrames(frames []Frame, version uint8) ([]byte, error) {
+	buffer, err := l.encodeFrames(frames, version)
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// EncodeFramesBuffers 将多个包分别编码，返回的net.Buffers每个元素对应一个包，
+// 可以通过net.Buffers.WriteTo写入连接，TCP连接上会使用writev一次写入
+func (l *MSProto) EncodeFramesBuffers(frames []Frame, version uint8) (net.Buffers, error) {
+	buffers := make(net.Buffers, len(frames))
+	for i, frame := range frames {
+		size, err := l.FrameSize(frame, version)
+		if err != nil {
+			return nil, errors.Wrapf(err, "frame %d", i)
+		}
+		buffer := bytes.NewBuffer(make([]byte, 0, size))
+		if err = l.encodeFrameWithWriter(buffer, frame, version); err != nil {
+			return nil, errors.Wrapf(err, "frame %d", i)
+		}
+		buffers[i] = buffer.Bytes()
+	}
+	return buffers, nil
+}
+
+// WriteFrames 将多个包编码后通过net.Buffers.WriteTo写入w，任意一个包编码失败时不写入
+func (l *MSProto) WriteFrames(w io.Writer, frames []Frame, version uint8) error {
+	if w == nil {
+		return errors.New("writer is nil")
+	}
+	buffers, err := l.EncodeFramesBuffers(frames, version)
+	if err != nil {
+		return err
+	}
+	_, err = buffers.WriteTo(w)
+	return err
+}
+
+// encodeFrames 预先计算总大小后依次编码到同一个缓冲区
+func (l *MSProto) encodeFrames(frames []Frame, version uint8) (*bytes.Buffer, error) {
+	total := 0
+	for i, frame := range frames {
+		size, err := l.FrameSize(frame, version)
+		if err != nil {
+			return nil, errors.Wrapf(err, "frame %d", i)
+		}
+		total += size
+	}
+	buffer := bytes.NewBuffer(make([]byte, 0, total))
+	for i, frame := range frames {
+		if err := l.encodeFrameWithWriter(buffer, frame, version); err != nil {
+			return nil, errors.Wrapf(err, "frame %d", i)
+		}
+	}
+	return buffer, nil
+}
+
+// variableLength 剩余长度编码后所占的字节数
+func variableLength(size uint32) int {
+	n := 1
+	for size >= 0x80 {
+		size /= 0x80
+		n++
+	}
+	return n
+}
@@ -0,0 +1,145 @@
+package msproto
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func batchFrames() []Frame {
+	return []Frame{
+		&PingPacket{},
+		&SendPacket{ClientSeq: 1, ClientMsgNo: "m1", ChannelID: "c", ChannelType: ChannelTypePerson, Payload: []byte("hi")},
+		// 剩余长度需要2个和3个字节
+		&RecvPacket{MessageID: 1, ChannelID: "c", ChannelType: ChannelTypePerson, Payload: bytes.Repeat([]byte("x"), 200)},
+		&RecvPacket{MessageID: 2, ChannelID: "c", ChannelType: ChannelTypePerson, Payload: bytes.Repeat([]byte("y"), 20000)},
+		ConnackPacket{ReasonCode: ReasonSuccess},
+		&RecvackPacket{MessageID: 1, MessageSeq: 1},
+	}
+}
+
+// decodeAll 依次解码data中的所有包
+func decodeAll(t *testing.T, proto *MSProto, data []byte) []Frame {
+	t.Helper()
+	var frames []Frame
+	for len(data) > 0 {
+		frame, n, err := proto.DecodeFrame(data, LatestVersion)
+		if err != nil {
+			t.Fatal(err)
+		}
+		frames = append(frames, frame)
+		data = data[n:]
+	}
+	return frames
+}
+
+func checkFrameTypes(t *testing.T, got, want []Frame) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("decoded %d frames, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].GetFrameType() != want[i].GetFrameType() {
+			t.Fatalf("frame %d = %s, want %s", i, got[i].GetFrameType(), want[i].GetFrameType())
+		}
+	}
+}
+
+func TestFrameSize(t *testing.T) {
+	proto := New()
+	for _, frame := range batchFrames() {
+		data, err := proto.EncodeFrame(frame, LatestVersion)
+		if err != nil {
+			t.Fatal(err)
+		}
+		size, err := proto.FrameSize(frame, LatestVersion)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size != len(data) {
+			t.Errorf("%s: FrameSize = %d, encoded %d bytes", frame.GetFrameType(), size, len(data))
+		}
+	}
+	if _, err := proto.FrameSize(nil, LatestVersion); !errors.Is(err, ErrNilFrame) {
+		t.Errorf("FrameSize(nil) = %v, want ErrNilFrame", err)
+	}
+}
+
+func TestEncodeFrames(t *testing.T) {
+	proto := New()
+	frames := batchFrames()
+	data, err := proto.EncodeFrames(frames, LatestVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFrameTypes(t, decodeAll(t, proto, data), frames)
+
+	buffers, err := proto.EncodeFramesBuffers(frames, LatestVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buffers) != len(frames) {
+		t.Fatalf("%d buffers for %d frames", len(buffers), len(frames))
+	}
+	for i, buffer := range buffers {
+		// 每个元素正好是一个包
+		frame, n, err := proto.DecodeFrame(buffer, LatestVersion)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != len(buffer) || frame.GetFrameType() != frames[i].GetFrameType() {
+			t.Fatalf("buffer %d = %s (%d of %d bytes), want %s", i, frame.GetFrameType(), n, len(buffer), frames[i].GetFrameType())
+		}
+	}
+	if joined := bytes.Join(buffers, nil); !bytes.Equal(joined, data) {
+		t.Fatal("EncodeFramesBuffers and EncodeFrames differ")
+	}
+
+	// 任意一个包编码失败时返回错误
+	bad := append(batchFrames(), &SendPacket{Payload: make([]byte, PayloadMaxSize+1)})
+	if _, err = proto.EncodeFrames(bad, LatestVersion); !errors.Is(err, ErrPayloadTooLarge) {
+		t.Fatalf("EncodeFrames err = %v, want ErrPayloadTooLarge", err)
+	}
+	if _, err = proto.EncodeFramesBuffers(bad, LatestVersion); !errors.Is(err, ErrPayloadTooLarge) {
+		t.Fatalf("EncodeFramesBuffers err = %v, want ErrPayloadTooLarge", err)
+	}
+	var buf bytes.Buffer
+	if err = proto.WriteFrames(&buf, bad, LatestVersion); !errors.Is(err, ErrPayloadTooLarge) || buf.Len() != 0 {
+		t.Fatalf("WriteFrames err = %v after writing %d bytes, want ErrPayloadTooLarge and nothing written", err, buf.Len())
+	}
+}
+
+func TestWriteFramesTCP(t *testing.T) {
+	proto := New()
+	frames := batchFrames()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer ln.Close()
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			received <- nil
+			return
+		}
+		defer conn.Close()
+		data, _ := io.ReadAll(conn)
+		received <- data
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// TCP连接支持writev
+	if err = proto.WriteFrames(conn, frames, LatestVersion); err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.Close()
+	checkFrameTypes(t, decodeAll(t, proto, <-received), frames)
+}
@@ -0,0 +1,439 @@
+// Package broker 进程内的参考服务端，用于在没有真实IM集群的情况下端到端测试客户端
+package broker
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	msproto "github.com/mushanyux/MSIMGoProto"
+	"github.com/mushanyux/MSIMGoProto/auth"
+	"github.com/mushanyux/MSIMGoProto/crypto"
+	"github.com/mushanyux/MSIMGoProto/server"
+)
+
+// AuthFunc 认证CONNECT，返回ReasonSuccess表示通过
+type AuthFunc func(connect *msproto.ConnectPacket) msproto.ReasonCode
+
+// Options broker配置
+type Options struct {
+	Auth      AuthFunc            // 认证，为nil时全部通过
+	Proto     *msproto.MSProto    // 协议对象
+	NodeId    uint64              // CONNACK中的节点Id
+	QueueSize int                 // 每个连接待推送包的队列长度，队列满时断开该连接
+	Now       func() time.Time    // 当前时间，用于消息时间戳和TimeDiff
+	Replay    *server.ReplayGuard // 防重放，为nil时不检查
+}
+
+// NewOptions 默认配置
+func NewOptions() *Options {
+	return &Options{
+		QueueSize: 1024,
+		Now:       time.Now,
+	}
+}
+
+type Option func(*Options)
+
+// WithAuth 认证
+func WithAuth(auth AuthFunc) Option {
+	return func(o *Options) {
+		o.Auth = auth
+	}
+}
+
+// WithAuthenticator 使用Authenticator认证，认证失败的错误通过auth.ReasonCodeOf映射为原因码
+func WithAuthenticator(a auth.Authenticator) Option {
+	return func(o *Options) {
+		o.Auth = func(connect *msproto.ConnectPacket) msproto.ReasonCode {
+			return auth.ReasonCodeOf(a.Authenticate(connect))
+		}
+	}
+}
+
+// WithProto 协议对象
+func WithProto(proto *msproto.MSProto) Option {
+	return func(o *Options) {
+		o.Proto = proto
+	}
+}
+
+// WithNodeId CONNACK中的节点Id
+func WithNodeId(nodeId uint64) Option {
+	return func(o *Options) {
+		o.NodeId = nodeId
+	}
+}
+
+// WithQueueSize 每个连接待推送包的队列长度，队列满时断开该连接
+func WithQueueSize(size int) Option {
+	return func(o *Options) {
+		o.QueueSize = size
+	}
+}
+
+// WithNow 当前时间
+func WithNow(now func() time.Time) Option {
+	return func(o *Options) {
+		o.Now = now
+	}
+}
+
+// WithReplayGuard 防重放
+func WithReplayGuard(guard *server.ReplayGuard) Option {
+	return func(o *Options) {
+		o.Replay = guard
+	}
+}
+
+type channelKey struct {
+	channelID   string
+	channelType uint8
+}
+
+// Broker 进程内的参考服务端
+// 支持CONNECT认证、SEND→SENDACK（分配MessageID和MessageSeq）、个人和群组频道的RECV扩散、RECVACK记录以及SUB/SUBACK
+type Broker struct {
+	opts   *Options
+	server *server.Server
+
+	mu          sync.Mutex
+	sessions    map[*server.Conn]*session
+	users       map[string]map[*session]struct{}
+	members     map[channelKey]map[string]struct{} // 群组成员
+	subscribers map[channelKey]map[*session]struct{}
+	seqs        map[channelKey]uint32
+	messageID   int64
+	unacked     map[string]map[int64]*msproto.RecvPacket
+}
+
+// New 创建broker
+func New(opts ...Option) *Broker {
+	o := NewOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.Now == nil {
+		o.Now = time.Now
+	}
+	b := &Broker{
+		opts:        o,
+		sessions:    map[*server.Conn]*session{},
+		users:       map[string]map[*session]struct{}{},
+		members:     map[channelKey]map[string]struct{}{},
+		subscribers: map[channelKey]map[*session]struct{}{},
+		seqs:        map[channelKey]uint32{},
+		unacked:     map[string]map[int64]*msproto.RecvPacket{},
+	}
+	var serverOpts []server.Option
+	if o.Proto != nil {
+		serverOpts = append(serverOpts, server.WithProto(o.Proto))
+	}
+	if o.Replay != nil {
+		serverOpts = append(serverOpts, server.WithReplayGuard(o.Replay))
+	}
+	b.server = server.New(b, serverOpts...)
+	return b
+}
+
+// Serve 在ln上接受连接
+func (b *Broker) Serve(ln net.Listener) error {
+	return b.server.Serve(ln)
+}
+
+// Listen 监听回环地址并在后台接受连接，返回监听的地址
+func (b *Broker) Listen() (string, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	go func() {
+		_ = b.server.Serve(ln)
+	}()
+	return ln.Addr().String(), nil
+}
+
+// ServeConn 处理一个连接，直到连接断开
+func (b *Broker) ServeConn(conn net.Conn) {
+	b.server.ServeConn(conn)
+}
+
+// Pipe 创建一对内存连接，broker在后台处理一端，返回另一端给客户端使用
+func (b *Broker) Pipe() net.Conn {
+	clientConn, serverConn := net.Pipe()
+	go b.server.ServeConn(serverConn)
+	return clientConn
+}
+
+// Close 关闭broker以及所有连接
+func (b *Broker) Close() error {
+	return b.server.Close()
+}
+
+// AddMembers 添加群组成员
+func (b *Broker) AddMembers(channelID string, uids ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	key := channelKey{channelID, msproto.ChannelTypeGroup}
+	members, ok := b.members[key]
+	if !ok {
+		members = map[string]struct{}{}
+		b.members[key] = members
+	}
+	for _, uid := range uids {
+		members[uid] = struct{}{}
+	}
+}
+
+// RemoveMembers 移除群组成员
+func (b *Broker) RemoveMembers(channelID string, uids ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	members := b.members[channelKey{channelID, msproto.ChannelTypeGroup}]
+	for _, uid := range uids {
+		delete(members, uid)
+	}
+}
+
+// Unacked 已推送给uid但还没有收到RECVACK的消息，按MessageID排序
+func (b *Broker) Unacked(uid string) []*msproto.RecvPacket {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	packets := make([]*msproto.RecvPacket, 0, len(b.unacked[uid]))
+	for _, p := range b.unacked[uid] {
+		packets = append(packets, p)
+	}
+	sort.Slice(packets, func(i, j int) bool {
+		return packets[i].MessageID < packets[j].MessageID
+	})
+	return packets
+}
+
+// Online uid当前的连接数
+func (b *Broker) Online(uid string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.users[uid])
+}
+
+// OnConnect 认证
+func (b *Broker) OnConnect(c *server.Conn, p *msproto.ConnectPacket) *msproto.ConnackPacket {
+	reasonCode := msproto.ReasonSuccess
+	if b.opts.Auth != nil {
+		reasonCode = b.opts.Auth(p)
+	}
+	connack := &msproto.ConnackPacket{
+		ReasonCode: reasonCode,
+		NodeId:     b.opts.NodeId,
+	}
+	if p.ClientTimestamp > 0 {
+		connack.TimeDiff = p.ClientTimestamp - b.opts.Now().UnixMilli()
+	}
+	if reasonCode != msproto.ReasonSuccess {
+		return connack
+	}
+	// 客户端提供了公钥时加密Payload
+	if p.ClientKey != "" {
+		secret, err := crypto.ServerExchange(p, connack)
+		if err != nil {
+			connack.ReasonCode = msproto.ReasonSystemError
+			return connack
+		}
+		cipher, err := crypto.NewAESCipher(secret)
+		if err == nil {
+			err = c.SetPayloadCipher(cipher)
+		}
+		if err != nil {
+			connack.ReasonCode = msproto.ReasonSystemError
+			return connack
+		}
+	}
+	// 在发送CONNACK之前登记，客户端收到CONNACK后发给它的消息不会丢失
+	b.register(c)
+	return connack
+}
+
+// OnEstablished CONNACK发送后开始推送
+func (b *Broker) OnEstablished(c *server.Conn) {
+	b.mu.Lock()
+	s := b.sessions[c]
+	b.mu.Unlock()
+	if s != nil {
+		s.start()
+	}
+}
+
+// OnSend 分配MessageID和MessageSeq并扩散
+func (b *Broker) OnSend(c *server.Conn, p *msproto.SendPacket) *msproto.SendackPacket {
+	fromUID := c.UID()
+	key := channelKey{p.ChannelID, p.ChannelType}
+
+	b.mu.Lock()
+	sender := b.sessions[c]
+	var targets map[*session]struct{}
+	switch p.ChannelType {
+	case msproto.ChannelTypePerson:
+		// 个人频道的会话以双方uid确定
+		key = personKey(fromUID, p.ChannelID)
+		targets = b.userSessions(p.ChannelID, fromUID)
+	case msproto.ChannelTypeGroup:
+		members, ok := b.members[key]
+		if !ok {
+			b.mu.Unlock()
+			return &msproto.SendackPacket{ReasonCode: msproto.ReasonChannelNotExist}
+		}
+		if _, ok = members[fromUID]; !ok {
+			b.mu.Unlock()
+			return &msproto.SendackPacket{ReasonCode: msproto.ReasonSubscriberNotExist}
+		}
+		uids := make([]string, 0, len(members))
+		for uid := range members {
+			uids = append(uids, uid)
+		}
+		targets = b.userSessions(uids...)
+	default:
+		targets = map[*session]struct{}{}
+	}
+	for s := range b.subscribers[channelKey{p.ChannelID, p.ChannelType}] {
+		targets[s] = struct{}{}
+	}
+	delete(targets, sender)
+
+	b.messageID++
+	b.seqs[key]++
+	messageID := b.messageID
+	messageSeq := b.seqs[key]
+	now := b.opts.Now()
+	recvs := make(map[*session]*msproto.RecvPacket, len(targets))
+	for s := range targets {
+		recv := &msproto.RecvPacket{
+			Framer:      msproto.Framer{NoPersist: p.NoPersist, RedDot: p.RedDot, SyncOnce: p.SyncOnce},
+			Setting:     p.Setting,
+			MsgKey:      p.MsgKey,
+			Expire:      p.Expire,
+			MessageID:   messageID,
+			MessageSeq:  messageSeq,
+			ClientMsgNo: p.ClientMsgNo,
+			StreamNo:    p.StreamNo,
+			Timestamp:   int32(now.Unix()),
+			ChannelID:   p.ChannelID,
+			ChannelType: p.ChannelType,
+			Topic:       p.Topic,
+			FromUID:     fromUID,
+			Payload:     p.Payload,
+		}
+		if p.ChannelType == msproto.ChannelTypePerson && s.conn.UID() != fromUID {
+			// 接收方看到的个人频道是发送方
+			recv.ChannelID = fromUID
+		}
+		recvs[s] = recv
+		unacked, ok := b.unacked[s.conn.UID()]
+		if !ok {
+			unacked = map[int64]*msproto.RecvPacket{}
+			b.unacked[s.conn.UID()] = unacked
+		}
+		unacked[messageID] = recv
+	}
+	b.mu.Unlock()
+
+	for s, recv := range recvs {
+		s.push(recv)
+	}
+	return &msproto.SendackPacket{
+		MessageID:  messageID,
+		MessageSeq: messageSeq,
+		ReasonCode: msproto.ReasonSuccess,
+	}
+}
+
+// OnRecvack 记录回执
+func (b *Broker) OnRecvack(c *server.Conn, p *msproto.RecvackPacket) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.unacked[c.UID()], p.MessageID)
+}
+
+// OnSub 订阅或取消订阅频道
+func (b *Broker) OnSub(c *server.Conn, p *msproto.SubPacket) *msproto.SubackPacket {
+	key := channelKey{p.ChannelID, p.ChannelType}
+	suback := &msproto.SubackPacket{
+		SubNo:       p.SubNo,
+		ChannelID:   p.ChannelID,
+		ChannelType: p.ChannelType,
+		Action:      p.Action,
+		ReasonCode:  msproto.ReasonSuccess,
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.sessions[c]
+	switch p.Action {
+	case msproto.Subscribe:
+		subscribers, ok := b.subscribers[key]
+		if !ok {
+			subscribers = map[*session]struct{}{}
+			b.subscribers[key] = subscribers
+		}
+		subscribers[s] = struct{}{}
+	case msproto.UnSubscribe:
+		delete(b.subscribers[key], s)
+	default:
+		suback.ReasonCode = msproto.ReasonSystemError
+	}
+	return suback
+}
+
+// OnPing PONG由server自动回复
+func (b *Broker) OnPing(c *server.Conn) {}
+
+// OnDisconnect 移除连接
+func (b *Broker) OnDisconnect(c *server.Conn, p *msproto.DisconnectPacket) {
+	b.mu.Lock()
+	s, ok := b.sessions[c]
+	if ok {
+		delete(b.sessions, c)
+		delete(b.users[c.UID()], s)
+		if len(b.users[c.UID()]) == 0 {
+			delete(b.users, c.UID())
+		}
+		for _, subscribers := range b.subscribers {
+			delete(subscribers, s)
+		}
+	}
+	b.mu.Unlock()
+	if ok {
+		s.close()
+	}
+}
+
+// register 登记连接
+func (b *Broker) register(c *server.Conn) {
+	s := newSession(c, b.opts.QueueSize)
+	b.mu.Lock()
+	b.sessions[c] = s
+	sessions, ok := b.users[c.UID()]
+	if !ok {
+		sessions = map[*session]struct{}{}
+		b.users[c.UID()] = sessions
+	}
+	sessions[s] = struct{}{}
+	b.mu.Unlock()
+}
+
+// userSessions uids的所有连接，调用者需要持有锁
+func (b *Broker) userSessions(uids ...string) map[*session]struct{} {
+	sessions := map[*session]struct{}{}
+	for _, uid := range uids {
+		for s := range b.users[uid] {
+			sessions[s] = struct{}{}
+		}
+	}
+	return sessions
+}
+
+func personKey(uid1, uid2 string) channelKey {
+	if uid1 > uid2 {
+		uid1, uid2 = uid2, uid1
+	}
+	return channelKey{uid1 + "@" + uid2, msproto.ChannelTypePerson}
+}
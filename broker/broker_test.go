@@ -0,0 +1,191 @@
+package broker_test
+
+import (
+	"testing"
+	"time"
+
+	msproto "github.com/mushanyux/MSIMGoProto"
+	"github.com/mushanyux/MSIMGoProto/broker"
+	"github.com/mushanyux/MSIMGoProto/client"
+	"github.com/mushanyux/MSIMGoProto/crypto"
+)
+
+func newBroker(t *testing.T, opts ...broker.Option) *broker.Broker {
+	t.Helper()
+	b := broker.New(opts...)
+	t.Cleanup(func() { _ = b.Close() })
+	return b
+}
+
+func connect(t *testing.T, b *broker.Broker, uid string, opts ...client.Option) *client.Session {
+	t.Helper()
+	s, err := client.Connect(b.Pipe(), uid, uid+"-token", opts...)
+	if err != nil {
+		t.Fatalf("connect %s: %v", uid, err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+	return s
+}
+
+// frames 在后台读取s上的包
+func frames(s *client.Session) <-chan msproto.Frame {
+	ch := make(chan msproto.Frame, 16)
+	go func() {
+		defer close(ch)
+		for {
+			frame, err := s.ReadFrame()
+			if err != nil {
+				return
+			}
+			ch <- frame
+		}
+	}()
+	return ch
+}
+
+func next(t *testing.T, ch <-chan msproto.Frame) msproto.Frame {
+	t.Helper()
+	select {
+	case frame, ok := <-ch:
+		if !ok {
+			t.Fatal("connection closed")
+		}
+		return frame
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for a frame")
+	}
+	return nil
+}
+
+func eventually(t *testing.T, cond func() bool, msg string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal(msg)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestBrokerDelivery(t *testing.T) {
+	b := newBroker(t)
+	a, c := connect(t, b, "a"), connect(t, b, "c")
+	aFrames, cFrames := frames(a), frames(c)
+	b.AddMembers("g1", "a", "c")
+
+	sends := []*msproto.SendPacket{
+		{ClientSeq: 1, ClientMsgNo: "m1", ChannelID: "c", ChannelType: msproto.ChannelTypePerson, Payload: []byte("hi c")},
+		{ClientSeq: 2, ClientMsgNo: "m2", ChannelID: "g1", ChannelType: msproto.ChannelTypeGroup, Payload: []byte("hi g1")},
+		{ClientSeq: 3, ClientMsgNo: "m3", ChannelID: "g2", ChannelType: msproto.ChannelTypeGroup, Payload: []byte("hi g2")},
+	}
+	wantAcks := []msproto.ReasonCode{msproto.ReasonSuccess, msproto.ReasonSuccess, msproto.ReasonChannelNotExist}
+	for i, p := range sends {
+		if err := a.WriteFrame(p); err != nil {
+			t.Fatal(err)
+		}
+		ack, ok := next(t, aFrames).(*msproto.SendackPacket)
+		if !ok || ack.ClientSeq != p.ClientSeq || ack.ReasonCode != wantAcks[i] {
+			t.Fatalf("SENDACK for %s = %v, want %s", p.ClientMsgNo, ack, wantAcks[i])
+		}
+	}
+
+	var recvs []*msproto.RecvPacket
+	for i := 0; i < 2; i++ {
+		recv, ok := next(t, cFrames).(*msproto.RecvPacket)
+		if !ok {
+			t.Fatalf("got %v, want RECV", recv)
+		}
+		recvs = append(recvs, recv)
+	}
+	// 接收方看到的个人频道是发送方
+	if recvs[0].ChannelID != "a" || recvs[0].FromUID != "a" || recvs[0].MessageSeq != 1 {
+		t.Errorf("person RECV = %+v", recvs[0])
+	}
+	if recvs[1].ChannelID != "g1" || string(recvs[1].Payload) != "hi g1" || recvs[1].MessageSeq != 1 {
+		t.Errorf("group RECV = %+v", recvs[1])
+	}
+
+	if n := len(b.Unacked("c")); n != 2 {
+		t.Fatalf("%d unacked for c, want 2", n)
+	}
+	if err := c.WriteFrame(&msproto.RecvackPacket{MessageID: recvs[0].MessageID, MessageSeq: recvs[0].MessageSeq}); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, func() bool { return len(b.Unacked("c")) == 1 }, "RECVACK not recorded")
+}
+
+func TestBrokerSlowReceiver(t *testing.T) {
+	b := newBroker(t, broker.WithQueueSize(2))
+	sender := connect(t, b, "a")
+	// 不读取的接收方
+	connect(t, b, "slow")
+	senderFrames := frames(sender)
+
+	for i := 1; i <= 10; i++ {
+		if err := sender.WriteFrame(&msproto.SendPacket{ClientSeq: uint64(i), ClientMsgNo: "m", ChannelID: "slow", ChannelType: msproto.ChannelTypePerson, Payload: []byte("hi")}); err != nil {
+			t.Fatal(err)
+		}
+		// 慢的接收方不会阻塞发送方
+		if ack, ok := next(t, senderFrames).(*msproto.SendackPacket); !ok || ack.ReasonCode != msproto.ReasonSuccess {
+			t.Fatalf("SENDACK %d = %v", i, ack)
+		}
+	}
+	eventually(t, func() bool { return b.Online("slow") == 0 }, "slow receiver not disconnected")
+	if n := len(b.Unacked("slow")); n == 0 {
+		t.Error("messages for the disconnected receiver were dropped from Unacked")
+	}
+	if b.Online("a") != 1 {
+		t.Error("sender disconnected")
+	}
+}
+
+func TestBrokerMsgKey(t *testing.T) {
+	for _, version := range []uint8{5, crypto.HMACVersion} {
+		b := newBroker(t)
+		a := connect(t, b, "a", client.WithEncrypt(true), client.WithVersion(version))
+		c := connect(t, b, "c", client.WithEncrypt(true), client.WithVersion(version))
+		aFrames, cFrames := frames(a), frames(c)
+
+		if err := a.WriteFrame(&msproto.SendPacket{ClientSeq: 1, ClientMsgNo: "m1", ChannelID: "c", ChannelType: msproto.ChannelTypePerson, Payload: []byte("hi")}); err != nil {
+			t.Fatal(err)
+		}
+		if ack, ok := next(t, aFrames).(*msproto.SendackPacket); !ok || ack.ReasonCode != msproto.ReasonSuccess {
+			t.Fatalf("v%d: SENDACK = %v, want success", version, ack)
+		}
+		// RECV由broker重新加密签名，接收方校验MsgKey后解密
+		if recv, ok := next(t, cFrames).(*msproto.RecvPacket); !ok || string(recv.Payload) != "hi" || recv.MsgKey == "" {
+			t.Fatalf("v%d: RECV = %v", version, recv)
+		}
+
+		// 签名之后修改ChannelID，服务端校验MsgKey失败
+		data, err := a.Codec().EncodeFrame(&msproto.SendPacket{ClientSeq: 2, ClientMsgNo: "m2", ChannelID: "c", ChannelType: msproto.ChannelTypePerson, Payload: []byte("hi")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		proto := a.Codec().Proto()
+		frame, _, err := proto.DecodeFrame(data, version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tampered := frame.(*msproto.SendPacket)
+		tampered.ChannelID = "x"
+		if data, err = proto.EncodeFrame(tampered, version); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = a.Conn().Write(data); err != nil {
+			t.Fatal(err)
+		}
+		ack, ok := next(t, aFrames).(*msproto.SendackPacket)
+		if !ok || ack.ClientSeq != 2 || ack.ReasonCode != msproto.ReasonMsgKeyError {
+			t.Fatalf("v%d: SENDACK = %v, want ReasonMsgKeyError for ClientSeq 2", version, ack)
+		}
+		// 连接保持可用
+		if err = a.WriteFrame(&msproto.SendPacket{ClientSeq: 3, ClientMsgNo: "m3", ChannelID: "c", ChannelType: msproto.ChannelTypePerson, Payload: []byte("again")}); err != nil {
+			t.Fatal(err)
+		}
+		if ack, ok = next(t, aFrames).(*msproto.SendackPacket); !ok || ack.ReasonCode != msproto.ReasonSuccess {
+			t.Fatalf("v%d: SENDACK after a rejected SEND = %v", version, ack)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package broker
+
+import (
+	"sync"
+
+	msproto "github.com/mushanyux/MSIMGoProto"
+	"github.com/mushanyux/MSIMGoProto/server"
+)
+
+// session 一个连接的推送队列，按顺序异步推送，避免慢的接收方阻塞发送方
+// 在OnConnect中创建以便立即接收消息，CONNACK发送后start开始推送
+type session struct {
+	conn *server.Conn
+
+	queue     chan msproto.Frame
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newSession(conn *server.Conn, queueSize int) *session {
+	s := &session{
+		conn:  conn,
+		queue: make(chan msproto.Frame, queueSize),
+		done:  make(chan struct{}),
+	}
+	return s
+}
+
+// start 开始推送
+func (s *session) start() {
+	go s.loop()
+}
+
+// push 加入推送队列，不会阻塞
+// 队列满说明接收方跟不上，断开连接，未回执的消息保留在Unacked中
+func (s *session) push(frame msproto.Frame) {
+	select {
+	case <-s.done:
+	case s.queue <- frame:
+	default:
+		_ = s.conn.Close()
+	}
+}
+
+func (s *session) close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+}
+
+func (s *session) loop() {
+	for {
+		select {
+		case frame := <-s.queue:
+			if err := s.conn.WriteFrame(frame); err != nil {
+				_ = s.conn.Close()
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
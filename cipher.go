@@ -0,0 +1,160 @@
+package msproto
+
+import (
+	"fmt"
+)
+
+// PayloadCipher 消息内容加解密
+// Codec设置了PayloadCipher后，编码时自动加密SEND和RECV的Payload，解码时自动解密，Setting中带有SettingNoEncrypt的包除外
+type PayloadCipher interface {
+	Encrypt(payload []byte) ([]byte, error)
+	Decrypt(payload []byte) ([]byte, error)
+}
+
+// FrameSigner 可选接口，PayloadCipher实现此接口时，编码时在加密Payload之后计算SEND和RECV的MsgKey，
+// 解码时在解密Payload之前校验MsgKey
+type FrameSigner interface {
+	Sign(frame Frame, version uint8) error
+	Verify(frame Frame, version uint8) error
+}
+
+// PayloadError Payload加解密失败
+// 解码时Frame为解码得到的包（Payload仍为密文），服务端可以据此回复原因码为ReasonPayloadDecodeError的SENDACK
+type PayloadError struct {
+	Frame Frame
+	Err   error
+}
+
+func (e *PayloadError) Error() string {
+	frameType := "UNKNOWN"
+	if e.Frame != nil {
+		frameType = e.Frame.GetFrameType().String()
+	}
+	return fmt.Sprintf("%s payload cipher failed: %v", frameType, e.Err)
+}
+
+func (e *PayloadError) Unwrap() error {
+	return e.Err
+}
+
+// ReasonCode 对应的原因码
+func (e *PayloadError) ReasonCode() ReasonCode {
+	return ReasonPayloadDecodeError
+}
+
+// MsgKeyError MsgKey校验失败，Frame为解码得到的包（Payload仍为密文），服务端可以据此回复原因码为ReasonMsgKeyError的SENDACK
+type MsgKeyError struct {
+	Frame Frame
+	Err   error
+}
+
+func (e *MsgKeyError) Error() string {
+	frameType := "UNKNOWN"
+	if e.Frame != nil {
+		frameType = e.Frame.GetFrameType().String()
+	}
+	return fmt.Sprintf("%s msg key verify failed: %v", frameType, e.Err)
+}
+
+func (e *MsgKeyError) Unwrap() error {
+	return e.Err
+}
+
+// ReasonCode 对应的原因码
+func (e *MsgKeyError) ReasonCode() ReasonCode {
+	return ReasonMsgKeyError
+}
+
+// encryptFrame 返回Payload加密（以及签名）后的副本，不需要加密的包原样返回
+func encryptFrame(cipher PayloadCipher, frame Frame, version uint8) (Frame, error) {
+	encrypted, err := encryptPayload(cipher, frame)
+	if err != nil || encrypted == frame {
+		return encrypted, err
+	}
+	if signer, ok := cipher.(FrameSigner); ok {
+		if err = signer.Sign(encrypted, version); err != nil {
+			return nil, &MsgKeyError{Frame: frame, Err: err}
+		}
+	}
+	return encrypted, nil
+}
+
+// encryptPayload 返回Payload加密后的副本，不需要加密的包原样返回
+func encryptPayload(cipher PayloadCipher, frame Frame) (Frame, error) {
+	if cipher == nil {
+		return frame, nil
+	}
+	switch p := frame.(type) {
+	case *SendPacket:
+		if p == nil || p.Setting.IsSet(SettingNoEncrypt) {
+			return frame, nil
+		}
+		payload, err := cipher.Encrypt(p.Payload)
+		if err != nil {
+			return nil, &PayloadError{Frame: frame, Err: err}
+		}
+		encrypted := *p
+		encrypted.Payload = payload
+		return &encrypted, nil
+	case *RecvPacket:
+		if p == nil || p.Setting.IsSet(SettingNoEncrypt) {
+			return frame, nil
+		}
+		payload, err := cipher.Encrypt(p.Payload)
+		if err != nil {
+			return nil, &PayloadError{Frame: frame, Err: err}
+		}
+		encrypted := *p
+		encrypted.Payload = payload
+		return &encrypted, nil
+	}
+	return frame, nil
+}
+
+// encryptFrames 批量加密
+func encryptFrames(cipher PayloadCipher, frames []Frame, version uint8) ([]Frame, error) {
+	if cipher == nil {
+		return frames, nil
+	}
+	encrypted := make([]Frame, len(frames))
+	for i, frame := range frames {
+		var err error
+		if encrypted[i], err = encryptFrame(cipher, frame, version); err != nil {
+			return nil, err
+		}
+	}
+	return encrypted, nil
+}
+
+// decryptFrame 校验MsgKey并解密刚解码得到的包的Payload
+func decryptFrame(cipher PayloadCipher, frame Frame, version uint8) error {
+	if cipher == nil {
+		return nil
+	}
+	var payload *[]byte
+	switch p := frame.(type) {
+	case *SendPacket:
+		if p.Setting.IsSet(SettingNoEncrypt) {
+			return nil
+		}
+		payload = &p.Payload
+	case *RecvPacket:
+		if p.Setting.IsSet(SettingNoEncrypt) {
+			return nil
+		}
+		payload = &p.Payload
+	default:
+		return nil
+	}
+	if signer, ok := cipher.(FrameSigner); ok {
+		if err := signer.Verify(frame, version); err != nil {
+			return &MsgKeyError{Frame: frame, Err: err}
+		}
+	}
+	plain, err := cipher.Decrypt(*payload)
+	if err != nil {
+		return &PayloadError{Frame: frame, Err: err}
+	}
+	*payload = plain
+	return nil
+}
@@ -0,0 +1,307 @@
+// Package client MSProto客户端，负责建立连接以及CONNECT/CONNACK握手
+package client
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	msproto "github.com/mushanyux/MSIMGoProto"
+	"github.com/mushanyux/MSIMGoProto/crypto"
+	"github.com/pkg/errors"
+)
+
+// Options 客户端配置
+type Options struct {
+	DeviceFlag msproto.DeviceFlag // 设备标示(同标示同账号互踢)
+	DeviceID   string             // 设备ID
+	ClientKey  *crypto.KeyPair    // 客户端密钥对，设置后通过密钥交换加密Payload
+	Encrypt    bool               // 是否通过密钥交换加密Payload，没有设置ClientKey时自动生成
+	TimeDiff   int64              // 已知的客户端时间与服务端的差值（毫秒），CONNECT的ClientTimestamp为本地时间减去此值
+	Version    uint8              // 客户端提议的协议版本
+	Timeout    time.Duration      // 建立连接和等待CONNACK的超时时间
+	Proto      *msproto.MSProto   // 协议对象
+}
+
+// NewOptions 默认配置
+func NewOptions() *Options {
+	return &Options{
+		DeviceFlag: msproto.APP,
+		Version:    msproto.LatestVersion,
+		Timeout:    10 * time.Second,
+	}
+}
+
+type Option func(*Options)
+
+// WithDeviceFlag 设备标示
+func WithDeviceFlag(deviceFlag msproto.DeviceFlag) Option {
+	return func(o *Options) {
+		o.DeviceFlag = deviceFlag
+	}
+}
+
+// WithDeviceID 设备ID
+func WithDeviceID(deviceID string) Option {
+	return func(o *Options) {
+		o.DeviceID = deviceID
+	}
+}
+
+// WithClientKey 客户端密钥对，公钥作为CONNECT的ClientKey，设置后加密Payload
+func WithClientKey(clientKey *crypto.KeyPair) Option {
+	return func(o *Options) {
+		o.ClientKey = clientKey
+	}
+}
+
+// WithEncrypt 是否通过密钥交换加密Payload
+func WithEncrypt(encrypt bool) Option {
+	return func(o *Options) {
+		o.Encrypt = encrypt
+	}
+}
+
+// WithTimeDiff 已知的客户端时间与服务端的差值（毫秒），用于校正CONNECT的ClientTimestamp
+func WithTimeDiff(timeDiff int64) Option {
+	return func(o *Options) {
+		o.TimeDiff = timeDiff
+	}
+}
+
+// WithVersion 客户端提议的协议版本
+func WithVersion(version uint8) Option {
+	return func(o *Options) {
+		o.Version = version
+	}
+}
+
+// WithTimeout 建立连接和等待CONNACK的超时时间
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *Options) {
+		o.Timeout = timeout
+	}
+}
+
+// WithProto 协议对象，默认开启CopyPayload，读取到的包可以安全地保存
+func WithProto(proto *msproto.MSProto) Option {
+	return func(o *Options) {
+		o.Proto = proto
+	}
+}
+
+// ConnackError 服务端拒绝连接
+type ConnackError struct {
+	ReasonCode msproto.ReasonCode
+	TimeDiff   int64 // CONNACK中客户端时间与服务端的差值，单位毫秒
+}
+
+func (e *ConnackError) Error() string {
+	return fmt.Sprintf("connect refused: %s", e.ReasonCode)
+}
+
+// Session 已完成握手的连接
+type Session struct {
+	conn    net.Conn
+	uid     string
+	codec   *msproto.Codec
+	reader  *msproto.FrameReader
+	connack *msproto.ConnackPacket
+	secret  *crypto.Secret
+
+	writeLock sync.Mutex
+}
+
+// Dial 连接addr并完成握手
+func Dial(addr string, uid, token string, opts ...Option) (*Session, error) {
+	o := newOptions(opts)
+	conn, err := net.DialTimeout("tcp", addr, o.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	return handshake(conn, uid, token, o)
+}
+
+// Connect 在已建立的conn上完成握手，握手失败时会关闭conn
+func Connect(conn net.Conn, uid, token string, opts ...Option) (*Session, error) {
+	return handshake(conn, uid, token, newOptions(opts))
+}
+
+func newOptions(opts []Option) *Options {
+	o := NewOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.Proto == nil {
+		o.Proto = msproto.New(msproto.WithCopyPayload(true))
+	}
+	return o
+}
+
+func handshake(conn net.Conn, uid, token string, o *Options) (*Session, error) {
+	connect := &msproto.ConnectPacket{
+		Version:         o.Version,
+		DeviceID:        o.DeviceID,
+		DeviceFlag:      o.DeviceFlag,
+		ClientTimestamp: time.Now().UnixMilli() - o.TimeDiff,
+		UID:             uid,
+		Token:           token,
+	}
+	keyPair := o.ClientKey
+	if keyPair == nil && o.Encrypt {
+		var err error
+		if keyPair, err = crypto.GenerateKeyPair(); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	if keyPair != nil {
+		connect.ClientKey = keyPair.PublicKey()
+	}
+	if o.Timeout > 0 {
+		if err := conn.SetDeadline(time.Now().Add(o.Timeout)); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	connack, err := exchange(conn, connect, o.Proto)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if connack.ReasonCode != msproto.ReasonSuccess {
+		_ = conn.Close()
+		return nil, &ConnackError{ReasonCode: connack.ReasonCode, TimeDiff: connack.TimeDiff}
+	}
+	codec, err := o.Proto.ClientCodec(connect, connack)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	var secret *crypto.Secret
+	if keyPair != nil {
+		if codec, secret, err = encryptCodec(codec, keyPair, connack); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	if err = conn.SetDeadline(time.Time{}); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return &Session{
+		conn:    conn,
+		uid:     uid,
+		codec:   codec,
+		reader:  codec.NewFrameReader(conn),
+		connack: connack,
+		secret:  secret,
+	}, nil
+}
+
+// encryptCodec 根据CONNACK中的ServerKey和Salt计算密钥，返回加密Payload的编解码器
+func encryptCodec(codec *msproto.Codec, keyPair *crypto.KeyPair, connack *msproto.ConnackPacket) (*msproto.Codec, *crypto.Secret, error) {
+	if connack.ServerKey == "" {
+		return nil, nil, errors.New("server key is empty")
+	}
+	secret, err := crypto.ClientSecret(keyPair, connack)
+	if err != nil {
+		return nil, nil, err
+	}
+	cipher, err := crypto.NewAESCipher(secret)
+	if err != nil {
+		return nil, nil, err
+	}
+	return codec.WithPayloadCipher(cipher), secret, nil
+}
+
+// exchange 发送CONNECT并等待CONNACK
+// CONNACK通过DecodePacketWithConn读取，不会多读CONNACK之后的数据
+func exchange(conn net.Conn, connect *msproto.ConnectPacket, proto *msproto.MSProto) (*msproto.ConnackPacket, error) {
+	data, err := proto.EncodeFrame(connect, connect.Version)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = conn.Write(data); err != nil {
+		return nil, err
+	}
+	frame, err := proto.DecodePacketWithConn(conn, connect.Version)
+	if err != nil {
+		return nil, err
+	}
+	connack, ok := frame.(*msproto.ConnackPacket)
+	if !ok {
+		return nil, errors.Errorf("expect CONNACK, got %s", proto.FrameTypeName(frame.GetFrameType()))
+	}
+	return connack, nil
+}
+
+// UID 用户ID
+func (s *Session) UID() string {
+	return s.uid
+}
+
+// Connack 服务端返回的CONNACK
+func (s *Session) Connack() *msproto.ConnackPacket {
+	return s.connack
+}
+
+// TimeDiff 客户端时间与服务器的差值，单位毫秒，设置了Options.TimeDiff时为校正后的差值
+func (s *Session) TimeDiff() int64 {
+	return s.connack.TimeDiff
+}
+
+// NodeId 服务端节点Id
+func (s *Session) NodeId() uint64 {
+	return s.connack.NodeId
+}
+
+// Secret 密钥交换得到的密钥，没有开启加密时为nil
+func (s *Session) Secret() *crypto.Secret {
+	return s.secret
+}
+
+// Codec 绑定协商版本的编解码器
+func (s *Session) Codec() *msproto.Codec {
+	return s.codec
+}
+
+// Conn 底层连接
+func (s *Session) Conn() net.Conn {
+	return s.conn
+}
+
+// WriteFrame 编码并发送一个包，可以并发调用
+func (s *Session) WriteFrame(frame msproto.Frame) error {
+	data, err := s.codec.EncodeFrame(frame)
+	if err != nil {
+		return err
+	}
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+	_, err = s.conn.Write(data)
+	return err
+}
+
+// WriteFrames 将多个包编码后一次性发送，可以并发调用
+func (s *Session) WriteFrames(frames []msproto.Frame) error {
+	data, err := s.codec.EncodeFrames(frames)
+	if err != nil {
+		return err
+	}
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+	_, err = s.conn.Write(data)
+	return err
+}
+
+// ReadFrame 读取一个包，不能并发调用
+func (s *Session) ReadFrame() (msproto.Frame, error) {
+	return s.reader.ReadFrame()
+}
+
+// Close 关闭连接
+func (s *Session) Close() error {
+	return s.conn.Close()
+}
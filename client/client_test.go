@@ -0,0 +1,154 @@
+package client_test
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	msproto "github.com/mushanyux/MSIMGoProto"
+	"github.com/mushanyux/MSIMGoProto/broker"
+	"github.com/mushanyux/MSIMGoProto/client"
+	"github.com/mushanyux/MSIMGoProto/crypto"
+)
+
+func newBroker(t *testing.T, opts ...broker.Option) *broker.Broker {
+	t.Helper()
+	b := broker.New(opts...)
+	t.Cleanup(func() { _ = b.Close() })
+	return b
+}
+
+func connect(t *testing.T, b *broker.Broker, uid string, opts ...client.Option) *client.Session {
+	t.Helper()
+	s, err := client.Connect(b.Pipe(), uid, uid+"-token", opts...)
+	if err != nil {
+		t.Fatalf("connect %s: %v", uid, err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+	return s
+}
+
+func tokenAuth(c *msproto.ConnectPacket) msproto.ReasonCode {
+	if c.Token != c.UID+"-token" {
+		return msproto.ReasonAuthFail
+	}
+	return msproto.ReasonSuccess
+}
+
+func TestConnectHandshake(t *testing.T) {
+	serverNow := time.Now().Add(-time.Hour)
+	b := newBroker(t, broker.WithAuth(tokenAuth), broker.WithNodeId(7), broker.WithNow(func() time.Time { return serverNow }))
+
+	s := connect(t, b, "a", client.WithVersion(4))
+	if got := s.Codec().Version(); got != 4 {
+		t.Fatalf("negotiated version = %d, want 4", got)
+	}
+	if !s.Connack().HasServerVersion || s.Connack().ServerVersion != 4 {
+		t.Fatalf("connack server version = %v/%d, want true/4", s.Connack().HasServerVersion, s.Connack().ServerVersion)
+	}
+	if s.NodeId() != 7 {
+		t.Fatalf("NodeId = %d, want 7", s.NodeId())
+	}
+	if diff := time.Duration(s.TimeDiff()) * time.Millisecond; diff < time.Hour || diff > time.Hour+time.Minute {
+		t.Fatalf("TimeDiff = %s, want about 1h", diff)
+	}
+	if s.UID() != "a" || s.Secret() != nil {
+		t.Fatalf("UID = %q, Secret = %v", s.UID(), s.Secret())
+	}
+
+	latest := connect(t, b, "b")
+	if got := latest.Codec().Version(); got != msproto.LatestVersion {
+		t.Fatalf("negotiated version = %d, want %d", got, msproto.LatestVersion)
+	}
+
+	// 不同版本的连接之间可以正常收发
+	if err := s.WriteFrame(&msproto.SendPacket{ClientSeq: 1, ClientMsgNo: "m1", ChannelID: "b", ChannelType: msproto.ChannelTypePerson, Payload: []byte("hi")}); err != nil {
+		t.Fatal(err)
+	}
+	frame, err := s.ReadFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ack, ok := frame.(*msproto.SendackPacket); !ok || ack.ReasonCode != msproto.ReasonSuccess || ack.ClientSeq != 1 {
+		t.Fatalf("got %v, want successful SENDACK for ClientSeq 1", frame)
+	}
+	frame, err = latest.ReadFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recv, ok := frame.(*msproto.RecvPacket); !ok || string(recv.Payload) != "hi" || recv.FromUID != "a" {
+		t.Fatalf("got %v, want RECV from a", frame)
+	}
+}
+
+func TestConnectClientKey(t *testing.T) {
+	b := newBroker(t)
+	keyPair, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 只设置ClientKey，不需要同时开启Encrypt
+	s := connect(t, b, "a", client.WithClientKey(keyPair))
+	plain := connect(t, b, "b")
+	if s.Secret() == nil {
+		t.Fatal("no secret negotiated with a client key")
+	}
+	secret, err := crypto.ClientSecret(keyPair, s.Connack())
+	if err != nil || string(secret.Key) != string(s.Secret().Key) {
+		t.Fatalf("secret not derived from the given key pair: %v", err)
+	}
+
+	if err = s.WriteFrame(&msproto.SendPacket{ClientSeq: 1, ClientMsgNo: "m1", ChannelID: "b", ChannelType: msproto.ChannelTypePerson, Payload: []byte("hi")}); err != nil {
+		t.Fatal(err)
+	}
+	frame, err := s.ReadFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ack, ok := frame.(*msproto.SendackPacket); !ok || ack.ReasonCode != msproto.ReasonSuccess {
+		t.Fatalf("got %v, want successful SENDACK", frame)
+	}
+	frame, err = plain.ReadFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recv, ok := frame.(*msproto.RecvPacket); !ok || string(recv.Payload) != "hi" {
+		t.Fatalf("got %v, want decrypted RECV", frame)
+	}
+}
+
+func TestConnectRefused(t *testing.T) {
+	b := newBroker(t, broker.WithAuth(tokenAuth))
+	_, err := client.Connect(b.Pipe(), "a", "bad")
+	var connackErr *client.ConnackError
+	if !errors.As(err, &connackErr) || connackErr.ReasonCode != msproto.ReasonAuthFail {
+		t.Fatalf("err = %v, want ConnackError ReasonAuthFail", err)
+	}
+	if !client.IsFatal(err) {
+		t.Fatal("auth failure should be fatal")
+	}
+}
+
+func TestConnectTimeout(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	defer serverConn.Close()
+	// 服务端读取CONNECT后不回复
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			if _, err := serverConn.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+	start := time.Now()
+	_, err := client.Connect(clientConn, "a", "a-token", client.WithTimeout(50*time.Millisecond))
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatalf("err = %v, want timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("handshake took %s", elapsed)
+	}
+}
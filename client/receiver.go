@@ -0,0 +1,362 @@
+package client
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	msproto "github.com/mushanyux/MSIMGoProto"
+)
+
+// Gap 频道的MessageSeq不连续，[From, To]之间的消息还没有收到，需要同步
+type Gap struct {
+	ChannelID   string
+	ChannelType uint8
+	From        uint32 // 缺失的第一个序列号
+	To          uint32 // 缺失的最后一个序列号
+	Abandoned   bool   // 超过MaxPending后放弃等待，之后再收到这些序列号时不会交给应用，只能通过同步获取
+}
+
+// ReceiverOptions 接收器配置
+type ReceiverOptions struct {
+	AckInterval time.Duration // 批量回执的间隔，为0时收到消息立即回执
+	DedupeSize  int           // 用于去重的最近消息ID数量
+	MaxPending  uint32        // 每个频道最多等待多少个序列号填补缺失，超过后放弃等待最早的缺失并以Abandoned的Gap报告，为0时不限制
+	OnGap       func(gap Gap) // 发现序列号缺失时回调
+}
+
+// NewReceiverOptions 默认配置
+func NewReceiverOptions() *ReceiverOptions {
+	return &ReceiverOptions{
+		DedupeSize: 1024,
+		MaxPending: 1024,
+	}
+}
+
+type ReceiverOption func(*ReceiverOptions)
+
+// WithAckInterval 批量回执的间隔
+func WithAckInterval(interval time.Duration) ReceiverOption {
+	return func(o *ReceiverOptions) {
+		o.AckInterval = interval
+	}
+}
+
+// WithDedupeSize 用于去重的最近消息ID数量
+func WithDedupeSize(size int) ReceiverOption {
+	return func(o *ReceiverOptions) {
+		o.DedupeSize = size
+	}
+}
+
+// WithMaxPending 每个频道最多等待多少个序列号填补缺失
+func WithMaxPending(maxPending uint32) ReceiverOption {
+	return func(o *ReceiverOptions) {
+		o.MaxPending = maxPending
+	}
+}
+
+// WithGapHandler 发现序列号缺失时回调
+func WithGapHandler(onGap func(gap Gap)) ReceiverOption {
+	return func(o *ReceiverOptions) {
+		o.OnGap = onGap
+	}
+}
+
+type channelKey struct {
+	channelID   string
+	channelType uint8
+}
+
+// channelSeq 频道的序列号状态
+type channelSeq struct {
+	last    uint32              // 最后一个连续的序列号
+	highest uint32              // 收到过的最大序列号
+	floor   uint32              // 收到的第一个序列号，更小的序列号没有收到过；SetLastSeq之后为0
+	pending map[uint32]struct{} // 已收到但不连续的序列号
+}
+
+// Receiver 接收RECV，自动回执RECVACK，去除重复投递的消息，并跟踪每个频道连续的MessageSeq
+type Receiver struct {
+	opts *ReceiverOptions
+
+	mu       sync.Mutex
+	w        FrameWriter
+	acks     []msproto.Frame
+	channels map[channelKey]*channelSeq
+	seen     map[int64]struct{}
+	seenRing []int64
+	seenNext int
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewReceiver 创建接收器，AckInterval大于0时启动批量回执的goroutine，不再使用时需要Close
+func NewReceiver(w FrameWriter, opts ...ReceiverOption) *Receiver {
+	o := NewReceiverOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+	r := &Receiver{
+		opts:     o,
+		w:        w,
+		channels: map[channelKey]*channelSeq{},
+		seen:     map[int64]struct{}{},
+		stop:     make(chan struct{}),
+	}
+	if o.DedupeSize > 0 {
+		r.seenRing = make([]int64, 0, o.DedupeSize)
+	}
+	if o.AckInterval > 0 {
+		go r.loopFlush()
+	}
+	return r
+}
+
+// HandleRecv 处理收到的RECV并回执，返回消息是否需要交给应用
+// 最近处理过的MessageID或者序列号已处理过的消息同样会回执，但返回false
+// 去重不看DUP标志：服务端重发的消息可能是第一次到达客户端，只按MessageID和MessageSeq判断
+// 没有SetLastSeq时，序列号小于频道收到的第一个序列号的消息只按MessageID去重
+func (r *Receiver) HandleRecv(p *msproto.RecvPacket) (bool, error) {
+	if p == nil {
+		return false, msproto.ErrNilFrame
+	}
+	ack := &msproto.RecvackPacket{
+		MessageID:  p.MessageID,
+		MessageSeq: p.MessageSeq,
+	}
+
+	r.mu.Lock()
+	deliver := !r.isDuplicate(p)
+	var gaps []Gap
+	if deliver {
+		r.markSeen(p.MessageID)
+		gaps = r.advance(p)
+	}
+	var err error
+	if r.opts.AckInterval > 0 {
+		r.acks = append(r.acks, ack)
+	} else {
+		w := r.w
+		r.mu.Unlock()
+		err = w.WriteFrame(ack)
+		r.mu.Lock()
+	}
+	r.mu.Unlock()
+
+	if r.opts.OnGap != nil {
+		for _, gap := range gaps {
+			r.opts.OnGap(gap)
+		}
+	}
+	return deliver, err
+}
+
+// LastSeq 频道最后一个连续的序列号
+func (r *Receiver) LastSeq(channelID string, channelType uint8) uint32 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if c, ok := r.channels[channelKey{channelID, channelType}]; ok {
+		return c.last
+	}
+	return 0
+}
+
+// SetLastSeq 设置频道最后一个连续的序列号，例如从本地存储恢复或者同步完缺失的消息之后
+func (r *Receiver) SetLastSeq(channelID string, channelType uint8, seq uint32) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c := r.channel(channelKey{channelID, channelType})
+	c.last = seq
+	c.floor = 0
+	c.drain()
+}
+
+// SetWriter 替换回执使用的连接，用于重连
+func (r *Receiver) SetWriter(w FrameWriter) {
+	r.mu.Lock()
+	r.w = w
+	r.mu.Unlock()
+}
+
+// Flush 立即发送所有未发送的回执
+func (r *Receiver) Flush() error {
+	r.mu.Lock()
+	acks := r.acks
+	r.acks = nil
+	w := r.w
+	r.mu.Unlock()
+	if len(acks) == 0 {
+		return nil
+	}
+	if fw, ok := w.(framesWriter); ok {
+		return fw.WriteFrames(acks)
+	}
+	for _, ack := range acks {
+		if err := w.WriteFrame(ack); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close 停止批量回执并发送剩余的回执
+func (r *Receiver) Close() error {
+	r.stopOnce.Do(func() {
+		close(r.stop)
+	})
+	return r.Flush()
+}
+
+func (r *Receiver) loopFlush() {
+	ticker := time.NewTicker(r.opts.AckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			// 写失败时回执丢失，服务端会重新投递
+			_ = r.Flush()
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// isDuplicate 重发的消息或者序列号已经处理过的消息
+func (r *Receiver) isDuplicate(p *msproto.RecvPacket) bool {
+	if _, ok := r.seen[p.MessageID]; ok && p.MessageID != 0 {
+		return true
+	}
+	if p.MessageSeq == 0 {
+		return false
+	}
+	c, ok := r.channels[channelKey{p.ChannelID, p.ChannelType}]
+	if !ok {
+		return false
+	}
+	// 起点之前的序列号没有收到过，可能是乱序晚到的消息
+	if p.MessageSeq < c.floor {
+		return false
+	}
+	if p.MessageSeq <= c.last {
+		return true
+	}
+	_, ok = c.pending[p.MessageSeq]
+	return ok
+}
+
+func (r *Receiver) markSeen(messageID int64) {
+	if messageID == 0 || cap(r.seenRing) == 0 {
+		return
+	}
+	if len(r.seenRing) < cap(r.seenRing) {
+		r.seenRing = append(r.seenRing, messageID)
+	} else {
+		delete(r.seen, r.seenRing[r.seenNext])
+		r.seenRing[r.seenNext] = messageID
+		r.seenNext = (r.seenNext + 1) % len(r.seenRing)
+	}
+	r.seen[messageID] = struct{}{}
+}
+
+// advance 推进频道的序列号，序列号跳跃时返回缺失的区间
+// 没有记录的频道以收到的第一个序列号作为起点，起点之前晚到的消息直接交给应用，不影响last
+// highest与last相差超过MaxPending时放弃等待最早的缺失，last直接前移，pending最多保留MaxPending个序列号
+// 被放弃的缺失以Abandoned的Gap再报告一次，之后再收到这些序列号时按已处理回执，由应用通过同步获取
+func (r *Receiver) advance(p *msproto.RecvPacket) []Gap {
+	if p.MessageSeq == 0 {
+		return nil
+	}
+	key := channelKey{p.ChannelID, p.ChannelType}
+	c, ok := r.channels[key]
+	if !ok {
+		c = r.channel(key)
+		c.last = p.MessageSeq
+		c.highest = p.MessageSeq
+		c.floor = p.MessageSeq
+		return nil
+	}
+	if p.MessageSeq < c.floor {
+		return nil
+	}
+	var gaps []Gap
+	// 小于highest的序列号是在填补已经报告过的缺失
+	if p.MessageSeq > c.highest+1 {
+		gaps = append(gaps, Gap{
+			ChannelID:   p.ChannelID,
+			ChannelType: p.ChannelType,
+			From:        c.highest + 1,
+			To:          p.MessageSeq - 1,
+		})
+	}
+	if p.MessageSeq > c.highest {
+		c.highest = p.MessageSeq
+	}
+	c.pending[p.MessageSeq] = struct{}{}
+	if max := r.opts.MaxPending; max > 0 && c.highest-c.last > max {
+		for _, gap := range c.abandon(c.highest - max) {
+			gap.ChannelID = p.ChannelID
+			gap.ChannelType = p.ChannelType
+			gaps = append(gaps, gap)
+		}
+	}
+	c.drain()
+	return gaps
+}
+
+func (r *Receiver) channel(key channelKey) *channelSeq {
+	c, ok := r.channels[key]
+	if !ok {
+		c = &channelSeq{pending: map[uint32]struct{}{}}
+		r.channels[key] = c
+	}
+	return c
+}
+
+// abandon 放弃等待last之后到seq为止的缺失，last前移到seq，返回被放弃的区间
+func (c *channelSeq) abandon(seq uint32) []Gap {
+	received := make([]uint32, 0, len(c.pending))
+	for s := range c.pending {
+		if s <= seq {
+			received = append(received, s)
+		}
+	}
+	sort.Slice(received, func(i, j int) bool { return received[i] < received[j] })
+	var gaps []Gap
+	from := c.last + 1
+	for _, s := range received {
+		if s > from {
+			gaps = append(gaps, Gap{From: from, To: s - 1, Abandoned: true})
+		}
+		from = s + 1
+	}
+	if from <= seq {
+		gaps = append(gaps, Gap{From: from, To: seq, Abandoned: true})
+	}
+	c.last = seq
+	return gaps
+}
+
+// drain 将已收到的连续序列号合并到last
+func (c *channelSeq) drain() {
+	for seq := range c.pending {
+		if seq <= c.last {
+			delete(c.pending, seq)
+		}
+	}
+	for {
+		if _, ok := c.pending[c.last+1]; !ok {
+			break
+		}
+		delete(c.pending, c.last+1)
+		c.last++
+	}
+	if c.highest < c.last {
+		c.highest = c.last
+	}
+}
+
+type framesWriter interface {
+	WriteFrames(frames []msproto.Frame) error
+}
@@ -0,0 +1,245 @@
+package client_test
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	msproto "github.com/mushanyux/MSIMGoProto"
+	"github.com/mushanyux/MSIMGoProto/client"
+)
+
+// ackRecorder 记录写入的RECVACK
+type ackRecorder struct {
+	mu      sync.Mutex
+	acks    []*msproto.RecvackPacket
+	batches int
+}
+
+func (a *ackRecorder) WriteFrame(frame msproto.Frame) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.acks = append(a.acks, frame.(*msproto.RecvackPacket))
+	return nil
+}
+
+func (a *ackRecorder) WriteFrames(frames []msproto.Frame) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.batches++
+	for _, frame := range frames {
+		a.acks = append(a.acks, frame.(*msproto.RecvackPacket))
+	}
+	return nil
+}
+
+func (a *ackRecorder) seqs() []uint32 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	seqs := make([]uint32, 0, len(a.acks))
+	for _, ack := range a.acks {
+		seqs = append(seqs, ack.MessageSeq)
+	}
+	return seqs
+}
+
+func recv(seq uint32, dup bool) *msproto.RecvPacket {
+	return &msproto.RecvPacket{
+		Framer:      msproto.Framer{DUP: dup},
+		MessageID:   int64(1000 + seq),
+		MessageSeq:  seq,
+		ChannelID:   "g1",
+		ChannelType: 2,
+	}
+}
+
+func TestReceiverDedupeAndGap(t *testing.T) {
+	w := &ackRecorder{}
+	var gaps []client.Gap
+	r := client.NewReceiver(w, client.WithGapHandler(func(gap client.Gap) {
+		gaps = append(gaps, gap)
+	}))
+	defer r.Close()
+
+	tests := []struct {
+		packet  *msproto.RecvPacket
+		deliver bool
+		lastSeq uint32
+	}{
+		{recv(1, false), true, 1},
+		{recv(2, false), true, 2},
+		{recv(5, false), true, 2},
+		{recv(3, false), true, 3},
+		{recv(5, false), false, 3},
+		// 去重不看DUP，第一次到达的重发同样交给应用
+		{recv(4, true), true, 5},
+		{recv(4, true), false, 5},
+		{recv(2, false), false, 5},
+	}
+	for i, tt := range tests {
+		deliver, err := r.HandleRecv(tt.packet)
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if deliver != tt.deliver {
+			t.Errorf("#%d seq %d: deliver = %v, want %v", i, tt.packet.MessageSeq, deliver, tt.deliver)
+		}
+		if last := r.LastSeq("g1", 2); last != tt.lastSeq {
+			t.Errorf("#%d seq %d: LastSeq = %d, want %d", i, tt.packet.MessageSeq, last, tt.lastSeq)
+		}
+	}
+	want := []client.Gap{{ChannelID: "g1", ChannelType: 2, From: 3, To: 4}}
+	if !reflect.DeepEqual(gaps, want) {
+		t.Errorf("gaps = %+v, want %+v", gaps, want)
+	}
+	// 每个RECV都需要回执，包括重复的
+	if seqs := w.seqs(); !reflect.DeepEqual(seqs, []uint32{1, 2, 5, 3, 5, 4, 4, 2}) {
+		t.Errorf("acked seqs = %v", seqs)
+	}
+}
+
+func TestReceiverMaxPending(t *testing.T) {
+	var gaps []client.Gap
+	r := client.NewReceiver(&ackRecorder{}, client.WithMaxPending(4), client.WithGapHandler(func(gap client.Gap) {
+		gaps = append(gaps, gap)
+	}))
+	defer r.Close()
+
+	for _, seq := range []uint32{1, 3, 4, 5} {
+		r.HandleRecv(recv(seq, false))
+	}
+	if last := r.LastSeq("g1", 2); last != 1 {
+		t.Fatalf("LastSeq = %d, want 1 while waiting for seq 2", last)
+	}
+	// highest-last超过MaxPending，放弃等待2
+	r.HandleRecv(recv(6, false))
+	if last := r.LastSeq("g1", 2); last != 6 {
+		t.Fatalf("LastSeq = %d, want 6", last)
+	}
+	if deliver, _ := r.HandleRecv(recv(2, false)); deliver {
+		t.Error("seq 2 arrived after being given up, want it handled by sync")
+	}
+
+	// 一次跳跃超过MaxPending时last直接前移
+	r.HandleRecv(recv(1000, false))
+	if last := r.LastSeq("g1", 2); last != 996 {
+		t.Fatalf("LastSeq = %d, want 996", last)
+	}
+	if deliver, _ := r.HandleRecv(recv(998, false)); !deliver {
+		t.Error("seq 998 within MaxPending not delivered")
+	}
+	want := []client.Gap{
+		{ChannelID: "g1", ChannelType: 2, From: 2, To: 2},
+		{ChannelID: "g1", ChannelType: 2, From: 2, To: 2, Abandoned: true},
+		{ChannelID: "g1", ChannelType: 2, From: 7, To: 999},
+		{ChannelID: "g1", ChannelType: 2, From: 7, To: 996, Abandoned: true},
+	}
+	if !reflect.DeepEqual(gaps, want) {
+		t.Errorf("gaps = %+v, want %+v", gaps, want)
+	}
+
+	r.SetLastSeq("g1", 2, 999)
+	if last := r.LastSeq("g1", 2); last != 1000 {
+		t.Errorf("LastSeq after SetLastSeq = %d, want 1000", last)
+	}
+}
+
+func TestReceiverAbandonedRanges(t *testing.T) {
+	var gaps []client.Gap
+	r := client.NewReceiver(&ackRecorder{}, client.WithMaxPending(4), client.WithGapHandler(func(gap client.Gap) {
+		if gap.Abandoned {
+			gaps = append(gaps, gap)
+		}
+	}))
+	defer r.Close()
+
+	// 只报告放弃时还没有收到的序列号
+	for _, seq := range []uint32{1, 3, 5, 8, 10} {
+		r.HandleRecv(recv(seq, false))
+	}
+	if last := r.LastSeq("g1", 2); last != 6 {
+		t.Fatalf("LastSeq = %d, want 6", last)
+	}
+	want := []client.Gap{
+		{ChannelID: "g1", ChannelType: 2, From: 2, To: 2, Abandoned: true},
+		{ChannelID: "g1", ChannelType: 2, From: 4, To: 4, Abandoned: true},
+		{ChannelID: "g1", ChannelType: 2, From: 6, To: 6, Abandoned: true},
+	}
+	if !reflect.DeepEqual(gaps, want) {
+		t.Errorf("abandoned gaps = %+v, want %+v", gaps, want)
+	}
+}
+
+func TestReceiverBeforeBaseline(t *testing.T) {
+	w := &ackRecorder{}
+	var gaps []client.Gap
+	r := client.NewReceiver(w, client.WithGapHandler(func(gap client.Gap) {
+		gaps = append(gaps, gap)
+	}))
+	defer r.Close()
+
+	tests := []struct {
+		packet  *msproto.RecvPacket
+		deliver bool
+		lastSeq uint32
+	}{
+		// 第一个收到的序列号作为起点
+		{recv(5, false), true, 5},
+		// 起点之前乱序晚到的消息没有收到过，交给应用
+		{recv(3, false), true, 5},
+		{recv(4, true), true, 5},
+		{recv(3, true), false, 5},
+		{recv(6, false), true, 6},
+		{recv(5, true), false, 6},
+		{recv(1, false), true, 6},
+	}
+	for i, tt := range tests {
+		deliver, err := r.HandleRecv(tt.packet)
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if deliver != tt.deliver {
+			t.Errorf("#%d seq %d: deliver = %v, want %v", i, tt.packet.MessageSeq, deliver, tt.deliver)
+		}
+		if last := r.LastSeq("g1", 2); last != tt.lastSeq {
+			t.Errorf("#%d seq %d: LastSeq = %d, want %d", i, tt.packet.MessageSeq, last, tt.lastSeq)
+		}
+	}
+	if len(gaps) != 0 {
+		t.Errorf("gaps = %+v, want none", gaps)
+	}
+	if seqs := w.seqs(); !reflect.DeepEqual(seqs, []uint32{5, 3, 4, 3, 6, 5, 1}) {
+		t.Errorf("acked seqs = %v", seqs)
+	}
+
+	// SetLastSeq之后last之前的序列号都已经处理过
+	r = client.NewReceiver(&ackRecorder{})
+	defer r.Close()
+	r.SetLastSeq("g1", 2, 5)
+	if deliver, _ := r.HandleRecv(recv(3, false)); deliver {
+		t.Error("seq 3 delivered after SetLastSeq(5)")
+	}
+	if deliver, _ := r.HandleRecv(recv(6, false)); !deliver {
+		t.Error("seq 6 not delivered after SetLastSeq(5)")
+	}
+}
+
+func TestReceiverBatchAck(t *testing.T) {
+	w := &ackRecorder{}
+	r := client.NewReceiver(w, client.WithAckInterval(time.Hour))
+	for seq := uint32(1); seq <= 3; seq++ {
+		if _, err := r.HandleRecv(recv(seq, false)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if seqs := w.seqs(); len(seqs) != 0 {
+		t.Fatalf("acked before flush: %v", seqs)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if seqs := w.seqs(); !reflect.DeepEqual(seqs, []uint32{1, 2, 3}) || w.batches != 1 {
+		t.Errorf("acked seqs = %v in %d batches, want [1 2 3] in 1", seqs, w.batches)
+	}
+}
@@ -0,0 +1,305 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	msproto "github.com/mushanyux/MSIMGoProto"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrSendTimeout 重试次数用完后仍没有收到SENDACK
+	ErrSendTimeout = errors.New("send timeout")
+	// ErrTrackerClosed 跟踪器已关闭
+	ErrTrackerClosed = errors.New("send tracker closed")
+)
+
+// FrameWriter 发送包，Session实现了此接口
+type FrameWriter interface {
+	WriteFrame(frame msproto.Frame) error
+}
+
+// SendError 服务端返回的SENDACK不成功
+type SendError struct {
+	ReasonCode msproto.ReasonCode
+}
+
+func (e *SendError) Error() string {
+	return fmt.Sprintf("send failed: %s", e.ReasonCode)
+}
+
+// TrackerOptions 发送跟踪器配置
+type TrackerOptions struct {
+	AckTimeout time.Duration // 等待SENDACK的超时时间，超时后重发
+	MaxRetries int           // 最大重发次数，超过后以ErrSendTimeout失败
+}
+
+// NewTrackerOptions 默认配置
+func NewTrackerOptions() *TrackerOptions {
+	return &TrackerOptions{
+		AckTimeout: 5 * time.Second,
+		MaxRetries: 3,
+	}
+}
+
+type TrackerOption func(*TrackerOptions)
+
+// WithAckTimeout 等待SENDACK的超时时间
+func WithAckTimeout(timeout time.Duration) TrackerOption {
+	return func(o *TrackerOptions) {
+		o.AckTimeout = timeout
+	}
+}
+
+// WithMaxRetries 最大重发次数
+func WithMaxRetries(maxRetries int) TrackerOption {
+	return func(o *TrackerOptions) {
+		o.MaxRetries = maxRetries
+	}
+}
+
+// SendFuture 一次发送的结果
+type SendFuture struct {
+	packet  *msproto.SendPacket
+	resend  *msproto.SendPacket // 重发使用的DUP包
+	retries int
+	timer   *time.Timer // 第一次写入完成后创建
+
+	done    chan struct{}
+	sendack *msproto.SendackPacket
+	err     error
+}
+
+// Packet 发送的包
+func (f *SendFuture) Packet() *msproto.SendPacket {
+	return f.packet
+}
+
+// Done 收到SENDACK或者失败后关闭
+func (f *SendFuture) Done() <-chan struct{} {
+	return f.done
+}
+
+// Result 发送结果，需要在Done关闭后调用
+// ReasonCode不是ReasonSuccess时同时返回SENDACK和*SendError
+func (f *SendFuture) Result() (*msproto.SendackPacket, error) {
+	return f.sendack, f.err
+}
+
+// Wait 等待发送结果
+func (f *SendFuture) Wait(ctx context.Context) (*msproto.SendackPacket, error) {
+	select {
+	case <-f.done:
+		return f.Result()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// SendTracker 跟踪已发送但还没有收到SENDACK的SEND，按ClientSeq关联SENDACK，超时后以DUP重发
+type SendTracker struct {
+	opts *TrackerOptions
+
+	mu       sync.Mutex
+	w        FrameWriter
+	nextSeq  uint64
+	inflight map[uint64]*SendFuture
+	closed   bool
+}
+
+// NewSendTracker 创建发送跟踪器
+func NewSendTracker(w FrameWriter, opts ...TrackerOption) *SendTracker {
+	o := NewTrackerOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+	return &SendTracker{
+		opts:     o,
+		w:        w,
+		inflight: map[uint64]*SendFuture{},
+	}
+}
+
+// Send 发送SEND并返回结果
+// ClientSeq为0时自动分配，ClientMsgNo为空时自动生成；发送后不要再修改p
+func (t *SendTracker) Send(p *msproto.SendPacket) (*SendFuture, error) {
+	if p == nil {
+		return nil, msproto.ErrNilFrame
+	}
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return nil, ErrTrackerClosed
+	}
+	if p.ClientSeq == 0 {
+		t.nextSeq++
+		p.ClientSeq = t.nextSeq
+	} else if p.ClientSeq > t.nextSeq {
+		t.nextSeq = p.ClientSeq
+	}
+	if _, ok := t.inflight[p.ClientSeq]; ok {
+		t.mu.Unlock()
+		return nil, errors.Errorf("client seq %d is already in flight", p.ClientSeq)
+	}
+	if p.ClientMsgNo == "" {
+		p.ClientMsgNo = newClientMsgNo()
+	}
+	f := &SendFuture{
+		packet: p,
+		done:   make(chan struct{}),
+	}
+	t.inflight[p.ClientSeq] = f
+	w := t.w
+	clientSeq := p.ClientSeq
+	t.mu.Unlock()
+
+	if err := w.WriteFrame(p); err != nil {
+		t.fail(clientSeq, err)
+		return nil, err
+	}
+	// 第一次写入完成后才开始计时，避免写入较慢时超时重发的DUP包和原包同时写入
+	t.mu.Lock()
+	if _, ok := t.inflight[clientSeq]; ok {
+		f.timer = time.AfterFunc(t.opts.AckTimeout, func() {
+			t.timeout(clientSeq)
+		})
+	}
+	t.mu.Unlock()
+	return f, nil
+}
+
+// HandleSendack 处理收到的SENDACK，返回是否匹配到了在途的SEND
+func (t *SendTracker) HandleSendack(p *msproto.SendackPacket) bool {
+	if p == nil {
+		return false
+	}
+	t.mu.Lock()
+	f, ok := t.inflight[p.ClientSeq]
+	if ok {
+		delete(t.inflight, p.ClientSeq)
+	}
+	t.mu.Unlock()
+	if !ok {
+		return false
+	}
+	var err error
+	if p.ReasonCode != msproto.ReasonSuccess {
+		err = &SendError{ReasonCode: p.ReasonCode}
+	}
+	f.resolve(p, err)
+	return true
+}
+
+// SetWriter 替换发送使用的连接，用于重连
+func (t *SendTracker) SetWriter(w FrameWriter) {
+	t.mu.Lock()
+	t.w = w
+	t.mu.Unlock()
+}
+
+// Resend 立即以DUP重发所有在途的SEND，用于重连之后，不计入重试次数
+func (t *SendTracker) Resend() error {
+	t.mu.Lock()
+	w := t.w
+	packets := make([]*msproto.SendPacket, 0, len(t.inflight))
+	for _, f := range t.inflight {
+		if f.timer == nil {
+			// 第一次写入还没有完成，完成后由超时重发
+			continue
+		}
+		f.timer.Reset(t.opts.AckTimeout)
+		packets = append(packets, f.resendPacket())
+	}
+	t.mu.Unlock()
+	for _, p := range packets {
+		if err := w.WriteFrame(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Pending 在途的SEND数量
+func (t *SendTracker) Pending() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.inflight)
+}
+
+// Close 关闭跟踪器，所有在途的SEND以ErrTrackerClosed失败
+func (t *SendTracker) Close() {
+	t.mu.Lock()
+	t.closed = true
+	inflight := t.inflight
+	t.inflight = map[uint64]*SendFuture{}
+	t.mu.Unlock()
+	for _, f := range inflight {
+		f.resolve(nil, ErrTrackerClosed)
+	}
+}
+
+// timeout 超时后重发，超过最大重发次数时失败
+func (t *SendTracker) timeout(clientSeq uint64) {
+	t.mu.Lock()
+	f, ok := t.inflight[clientSeq]
+	if !ok {
+		t.mu.Unlock()
+		return
+	}
+	if f.retries >= t.opts.MaxRetries {
+		delete(t.inflight, clientSeq)
+		t.mu.Unlock()
+		f.resolve(nil, ErrSendTimeout)
+		return
+	}
+	f.retries++
+	f.timer.Reset(t.opts.AckTimeout)
+	w := t.w
+	p := f.resendPacket()
+	t.mu.Unlock()
+
+	// 写失败时等待下一次超时再重发
+	_ = w.WriteFrame(p)
+}
+
+func (t *SendTracker) fail(clientSeq uint64, err error) {
+	t.mu.Lock()
+	f, ok := t.inflight[clientSeq]
+	if ok {
+		delete(t.inflight, clientSeq)
+	}
+	t.mu.Unlock()
+	if ok {
+		f.resolve(nil, err)
+	}
+}
+
+func (f *SendFuture) resolve(sendack *msproto.SendackPacket, err error) {
+	if f.timer != nil {
+		f.timer.Stop()
+	}
+	f.sendack = sendack
+	f.err = err
+	close(f.done)
+}
+
+// resendPacket 复制一份DUP为true的包用于重发，已经交给连接发送的包不会被修改
+func (f *SendFuture) resendPacket() *msproto.SendPacket {
+	if f.resend == nil {
+		dup := *f.packet
+		dup.DUP = true
+		f.resend = &dup
+	}
+	return f.resend
+}
+
+func newClientMsgNo() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
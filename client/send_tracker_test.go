@@ -0,0 +1,232 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	msproto "github.com/mushanyux/MSIMGoProto"
+	"github.com/mushanyux/MSIMGoProto/client"
+)
+
+// readLoop 在后台读取s上的包并交给handle，直到连接断开
+func readLoop(s *client.Session, handle func(msproto.Frame)) {
+	go func() {
+		for {
+			frame, err := s.ReadFrame()
+			if err != nil {
+				return
+			}
+			handle(frame)
+		}
+	}()
+}
+
+// lossyWriter 丢弃前drop个包，并记录所有写入的SEND
+type lossyWriter struct {
+	w client.FrameWriter
+
+	mu      sync.Mutex
+	drop    int
+	written []*msproto.SendPacket
+}
+
+func (l *lossyWriter) WriteFrame(frame msproto.Frame) error {
+	l.mu.Lock()
+	if p, ok := frame.(*msproto.SendPacket); ok {
+		l.written = append(l.written, p)
+	}
+	drop := l.drop > 0
+	if drop {
+		l.drop--
+	}
+	l.mu.Unlock()
+	if drop {
+		return nil
+	}
+	return l.w.WriteFrame(frame)
+}
+
+func (l *lossyWriter) sends() []*msproto.SendPacket {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]*msproto.SendPacket(nil), l.written...)
+}
+
+func wait(t *testing.T, f *client.SendFuture) (*msproto.SendackPacket, error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return f.Wait(ctx)
+}
+
+func TestSendTrackerSendack(t *testing.T) {
+	b := newBroker(t)
+	a := connect(t, b, "a")
+	connect(t, b, "b")
+	tracker := client.NewSendTracker(a)
+	defer tracker.Close()
+	readLoop(a, func(frame msproto.Frame) {
+		if ack, ok := frame.(*msproto.SendackPacket); ok {
+			tracker.HandleSendack(ack)
+		}
+	})
+
+	futures := make([]*client.SendFuture, 3)
+	for i := range futures {
+		f, err := tracker.Send(&msproto.SendPacket{ChannelID: "b", ChannelType: msproto.ChannelTypePerson, Payload: []byte("hi")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		futures[i] = f
+	}
+	for i, f := range futures {
+		if f.Packet().ClientSeq != uint64(i+1) || f.Packet().ClientMsgNo == "" {
+			t.Fatalf("ClientSeq = %d, ClientMsgNo = %q", f.Packet().ClientSeq, f.Packet().ClientMsgNo)
+		}
+		ack, err := wait(t, f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ack.ClientSeq != f.Packet().ClientSeq || ack.MessageSeq != uint32(i+1) {
+			t.Fatalf("SENDACK %v does not match ClientSeq %d", ack, f.Packet().ClientSeq)
+		}
+	}
+	if n := tracker.Pending(); n != 0 {
+		t.Fatalf("Pending = %d, want 0", n)
+	}
+
+	// 失败的原因码通过SendError返回
+	f, err := tracker.Send(&msproto.SendPacket{ChannelID: "no-such-group", ChannelType: msproto.ChannelTypeGroup})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = wait(t, f)
+	var sendErr *client.SendError
+	if !errors.As(err, &sendErr) || sendErr.ReasonCode != msproto.ReasonChannelNotExist {
+		t.Fatalf("err = %v, want SendError ReasonChannelNotExist", err)
+	}
+}
+
+func TestSendTrackerRetransmit(t *testing.T) {
+	b := newBroker(t)
+	a := connect(t, b, "a")
+	connect(t, b, "b")
+	w := &lossyWriter{w: a, drop: 1}
+	tracker := client.NewSendTracker(w, client.WithAckTimeout(100*time.Millisecond), client.WithMaxRetries(3))
+	defer tracker.Close()
+	readLoop(a, func(frame msproto.Frame) {
+		if ack, ok := frame.(*msproto.SendackPacket); ok {
+			tracker.HandleSendack(ack)
+		}
+	})
+
+	p := &msproto.SendPacket{ChannelID: "b", ChannelType: msproto.ChannelTypePerson}
+	f, err := tracker.Send(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = wait(t, f); err != nil {
+		t.Fatal(err)
+	}
+	sends := w.sends()
+	if len(sends) != 2 {
+		t.Fatalf("%d SENDs written, want 2", len(sends))
+	}
+	if sends[0].DUP || !sends[1].DUP {
+		t.Fatalf("DUP = %v, %v, want false, true", sends[0].DUP, sends[1].DUP)
+	}
+	if sends[1].ClientSeq != sends[0].ClientSeq || sends[1].ClientMsgNo != sends[0].ClientMsgNo {
+		t.Fatal("retransmission changed ClientSeq or ClientMsgNo")
+	}
+	if p.DUP {
+		t.Fatal("retransmission modified the original packet")
+	}
+}
+
+func TestSendTrackerTimeout(t *testing.T) {
+	w := &lossyWriter{drop: 1 << 30}
+	tracker := client.NewSendTracker(w, client.WithAckTimeout(10*time.Millisecond), client.WithMaxRetries(2))
+	f, err := tracker.Send(&msproto.SendPacket{ChannelID: "b", ChannelType: msproto.ChannelTypePerson})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = wait(t, f); !errors.Is(err, client.ErrSendTimeout) {
+		t.Fatalf("err = %v, want %v", err, client.ErrSendTimeout)
+	}
+	if n := len(w.sends()); n != 3 {
+		t.Fatalf("%d SENDs written, want 1 + 2 retries", n)
+	}
+
+	pending, err := tracker.Send(&msproto.SendPacket{ChannelID: "b", ChannelType: msproto.ChannelTypePerson})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker.Close()
+	if _, err = wait(t, pending); !errors.Is(err, client.ErrTrackerClosed) {
+		t.Fatalf("err = %v, want %v", err, client.ErrTrackerClosed)
+	}
+	if _, err = tracker.Send(&msproto.SendPacket{}); !errors.Is(err, client.ErrTrackerClosed) {
+		t.Fatalf("Send after Close err = %v, want %v", err, client.ErrTrackerClosed)
+	}
+}
+
+// slowWriter 第一次写入阻塞delay，记录每次写入开始和结束的顺序
+type slowWriter struct {
+	delay time.Duration
+
+	mu     sync.Mutex
+	writes int
+	events []string
+}
+
+func (s *slowWriter) WriteFrame(frame msproto.Frame) error {
+	s.mu.Lock()
+	s.writes++
+	first := s.writes == 1
+	s.events = append(s.events, "start")
+	s.mu.Unlock()
+	if first {
+		time.Sleep(s.delay)
+	}
+	s.mu.Lock()
+	s.events = append(s.events, "end")
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *slowWriter) log() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.events...)
+}
+
+func TestSendTrackerSlowWrite(t *testing.T) {
+	// 第一次写入比超时时间长得多
+	w := &slowWriter{delay: 50 * time.Millisecond}
+	tracker := client.NewSendTracker(w, client.WithAckTimeout(10*time.Millisecond), client.WithMaxRetries(1))
+	defer tracker.Close()
+	f, err := tracker.Send(&msproto.SendPacket{ChannelID: "b", ChannelType: msproto.ChannelTypePerson})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if events := w.log(); len(events) != 2 {
+		t.Fatalf("writes during the first write: %v", events)
+	}
+	// 第一次写入完成后开始计时，超时后重发
+	if _, err = wait(t, f); !errors.Is(err, client.ErrSendTimeout) {
+		t.Fatalf("err = %v, want %v", err, client.ErrSendTimeout)
+	}
+	events := w.log()
+	want := []string{"start", "end", "start", "end"}
+	if len(events) != len(want) {
+		t.Fatalf("write events = %v, want %v", events, want)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Fatalf("write events = %v, want %v", events, want)
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	msproto "github.com/mushanyux/MSIMGoProto"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrSubTimeout 规定时间内没有收到SUBACK
+	ErrSubTimeout = errors.New("sub timeout")
+	// ErrSubManagerClosed 订阅管理已关闭
+	ErrSubManagerClosed = errors.New("sub manager closed")
+)
+
+// SubError 服务端返回的SUBACK不成功
+type SubError struct {
+	Action     msproto.Action
+	ReasonCode msproto.ReasonCode
+}
+
+func (e *SubError) Error() string {
+	if e.Action == msproto.UnSubscribe {
+		return fmt.Sprintf("unsubscribe failed: %s", e.ReasonCode)
+	}
+	return fmt.Sprintf("subscribe failed: %s", e.ReasonCode)
+}
+
+// Subscription 一个订阅
+type Subscription struct {
+	ChannelID   string
+	ChannelType uint8
+	Param       string
+}
+
+// SubManagerOptions 订阅管理配置
+type SubManagerOptions struct {
+	AckTimeout time.Duration // 等待SUBACK的超时时间
+}
+
+// NewSubManagerOptions 默认配置
+func NewSubManagerOptions() *SubManagerOptions {
+	return &SubManagerOptions{
+		AckTimeout: 10 * time.Second,
+	}
+}
+
+type SubManagerOption func(*SubManagerOptions)
+
+// WithSubAckTimeout 等待SUBACK的超时时间
+func WithSubAckTimeout(timeout time.Duration) SubManagerOption {
+	return func(o *SubManagerOptions) {
+		o.AckTimeout = timeout
+	}
+}
+
+// SubFuture 一次订阅或取消订阅的结果
+type SubFuture struct {
+	packet *msproto.SubPacket
+	timer  *time.Timer
+
+	done   chan struct{}
+	suback *msproto.SubackPacket
+	err    error
+}
+
+// Packet 发送的包
+func (f *SubFuture) Packet() *msproto.SubPacket {
+	return f.packet
+}
+
+// Done 收到SUBACK或者失败后关闭
+func (f *SubFuture) Done() <-chan struct{} {
+	return f.done
+}
+
+// Result 订阅结果，需要在Done关闭后调用
+// ReasonCode不是ReasonSuccess时同时返回SUBACK和*SubError
+func (f *SubFuture) Result() (*msproto.SubackPacket, error) {
+	return f.suback, f.err
+}
+
+// Wait 等待订阅结果
+func (f *SubFuture) Wait(ctx context.Context) (*msproto.SubackPacket, error) {
+	select {
+	case <-f.done:
+		return f.Result()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (f *SubFuture) resolve(suback *msproto.SubackPacket, err error) {
+	f.timer.Stop()
+	f.suback = suback
+	f.err = err
+	close(f.done)
+}
+
+// SubManager 订阅管理，生成SubNo，按SubNo关联SUBACK，维护已生效的订阅并在重连后重新订阅
+type SubManager struct {
+	opts *SubManagerOptions
+
+	mu      sync.Mutex
+	w       FrameWriter
+	nextNo  uint64
+	pending map[string]*SubFuture
+	active  map[channelKey]Subscription
+	closed  bool
+}
+
+// NewSubManager 创建订阅管理
+func NewSubManager(w FrameWriter, opts ...SubManagerOption) *SubManager {
+	o := NewSubManagerOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+	return &SubManager{
+		opts:    o,
+		w:       w,
+		pending: map[string]*SubFuture{},
+		active:  map[channelKey]Subscription{},
+	}
+}
+
+// Subscribe 订阅频道
+func (m *SubManager) Subscribe(channelID string, channelType uint8, param string) (*SubFuture, error) {
+	return m.send(&msproto.SubPacket{
+		ChannelID:   channelID,
+		ChannelType: channelType,
+		Action:      msproto.Subscribe,
+		Param:       param,
+	})
+}
+
+// Unsubscribe 取消订阅频道
+func (m *SubManager) Unsubscribe(channelID string, channelType uint8) (*SubFuture, error) {
+	return m.send(&msproto.SubPacket{
+		ChannelID:   channelID,
+		ChannelType: channelType,
+		Action:      msproto.UnSubscribe,
+	})
+}
+
+// HandleSuback 处理收到的SUBACK，返回是否匹配到了等待中的SUB
+func (m *SubManager) HandleSuback(p *msproto.SubackPacket) bool {
+	if p == nil {
+		return false
+	}
+	m.mu.Lock()
+	f, ok := m.pending[p.SubNo]
+	if !ok {
+		m.mu.Unlock()
+		return false
+	}
+	delete(m.pending, p.SubNo)
+	sub := f.packet
+	key := channelKey{sub.ChannelID, sub.ChannelType}
+	var err error
+	switch {
+	case p.ReasonCode != msproto.ReasonSuccess:
+		// 订阅失败说明服务端没有此订阅
+		if sub.Action == msproto.Subscribe {
+			delete(m.active, key)
+		}
+		err = &SubError{Action: sub.Action, ReasonCode: p.ReasonCode}
+	case sub.Action == msproto.Subscribe:
+		m.active[key] = Subscription{
+			ChannelID:   sub.ChannelID,
+			ChannelType: sub.ChannelType,
+			Param:       sub.Param,
+		}
+	default:
+		delete(m.active, key)
+	}
+	m.mu.Unlock()
+	f.resolve(p, err)
+	return true
+}
+
+// Active 已生效的订阅
+func (m *SubManager) Active() []Subscription {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	subs := make([]Subscription, 0, len(m.active))
+	for _, sub := range m.active {
+		subs = append(subs, sub)
+	}
+	return subs
+}
+
+// SetWriter 替换发送使用的连接
+func (m *SubManager) SetWriter(w FrameWriter) {
+	m.mu.Lock()
+	m.w = w
+	m.mu.Unlock()
+}
+
+// Resubscribe 重新发送等待中的SUB，并重新订阅已生效但没有在等待中的频道，用于重连之后
+func (m *SubManager) Resubscribe() error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return ErrSubManagerClosed
+	}
+	w := m.w
+	packets := make([]*msproto.SubPacket, 0, len(m.pending)+len(m.active))
+	waiting := map[channelKey]struct{}{}
+	for _, f := range m.pending {
+		f.timer.Reset(m.opts.AckTimeout)
+		packets = append(packets, f.packet)
+		waiting[channelKey{f.packet.ChannelID, f.packet.ChannelType}] = struct{}{}
+	}
+	for key, sub := range m.active {
+		if _, ok := waiting[key]; ok {
+			continue
+		}
+		f := m.track(&msproto.SubPacket{
+			ChannelID:   sub.ChannelID,
+			ChannelType: sub.ChannelType,
+			Action:      msproto.Subscribe,
+			Param:       sub.Param,
+		})
+		packets = append(packets, f.packet)
+	}
+	m.mu.Unlock()
+
+	for _, p := range packets {
+		if err := w.WriteFrame(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HandleEvent 可以作为Supervisor的事件回调，连接建立后自动切换连接并重新订阅
+func (m *SubManager) HandleEvent(event Event) {
+	if event.State != StateConnected || event.Session == nil {
+		return
+	}
+	m.SetWriter(event.Session)
+	// 写失败时连接会断开，重连后再次重新订阅
+	_ = m.Resubscribe()
+}
+
+// Close 关闭订阅管理，等待中的SUB以ErrSubManagerClosed失败
+func (m *SubManager) Close() {
+	m.mu.Lock()
+	m.closed = true
+	pending := m.pending
+	m.pending = map[string]*SubFuture{}
+	m.mu.Unlock()
+	for _, f := range pending {
+		f.resolve(nil, ErrSubManagerClosed)
+	}
+}
+
+func (m *SubManager) send(p *msproto.SubPacket) (*SubFuture, error) {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil, ErrSubManagerClosed
+	}
+	f := m.track(p)
+	w := m.w
+	m.mu.Unlock()
+
+	if err := w.WriteFrame(p); err != nil {
+		m.fail(p.SubNo, err)
+		return nil, err
+	}
+	return f, nil
+}
+
+// track 分配SubNo并登记等待SUBACK，调用者需要持有锁
+func (m *SubManager) track(p *msproto.SubPacket) *SubFuture {
+	m.nextNo++
+	p.SubNo = strconv.FormatUint(m.nextNo, 10)
+	f := &SubFuture{
+		packet: p,
+		done:   make(chan struct{}),
+	}
+	subNo := p.SubNo
+	f.timer = time.AfterFunc(m.opts.AckTimeout, func() {
+		m.fail(subNo, ErrSubTimeout)
+	})
+	m.pending[subNo] = f
+	return f
+}
+
+func (m *SubManager) fail(subNo string, err error) {
+	m.mu.Lock()
+	f, ok := m.pending[subNo]
+	if ok {
+		delete(m.pending, subNo)
+	}
+	m.mu.Unlock()
+	if ok {
+		f.resolve(nil, err)
+	}
+}
@@ -0,0 +1,177 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	msproto "github.com/mushanyux/MSIMGoProto"
+	"github.com/mushanyux/MSIMGoProto/client"
+)
+
+// discardWriter 丢弃所有包
+type discardWriter struct{}
+
+func (discardWriter) WriteFrame(frame msproto.Frame) error {
+	return nil
+}
+
+func waitSub(t *testing.T, f *client.SubFuture) (*msproto.SubackPacket, error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return f.Wait(ctx)
+}
+
+func TestSubManagerSubscribe(t *testing.T) {
+	b := newBroker(t)
+	a := connect(t, b, "a")
+	sender := connect(t, b, "b")
+	m := client.NewSubManager(a)
+	defer m.Close()
+
+	recvs := make(chan *msproto.RecvPacket, 1)
+	readLoop(a, func(frame msproto.Frame) {
+		switch p := frame.(type) {
+		case *msproto.SubackPacket:
+			m.HandleSuback(p)
+		case *msproto.RecvPacket:
+			recvs <- p
+		}
+	})
+	readLoop(sender, func(msproto.Frame) {})
+
+	f, err := m.Subscribe("live1", msproto.ChannelTypeLive, "p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Packet().SubNo == "" {
+		t.Fatal("SubNo not assigned")
+	}
+	suback, err := waitSub(t, f)
+	if err != nil || suback.SubNo != f.Packet().SubNo {
+		t.Fatalf("Subscribe = %v, %v", suback, err)
+	}
+	want := []client.Subscription{{ChannelID: "live1", ChannelType: msproto.ChannelTypeLive, Param: "p1"}}
+	if active := m.Active(); !reflect.DeepEqual(active, want) {
+		t.Fatalf("Active = %+v, want %+v", active, want)
+	}
+
+	// 订阅后收到频道的消息
+	if err = sender.WriteFrame(&msproto.SendPacket{ClientSeq: 1, ClientMsgNo: "m1", ChannelID: "live1", ChannelType: msproto.ChannelTypeLive, Payload: []byte("hi")}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case recv := <-recvs:
+		if recv.ChannelID != "live1" || string(recv.Payload) != "hi" {
+			t.Fatalf("got %v, want RECV on live1", recv)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no RECV after subscribing")
+	}
+
+	f, err = m.Unsubscribe("live1", msproto.ChannelTypeLive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = waitSub(t, f); err != nil {
+		t.Fatal(err)
+	}
+	if active := m.Active(); len(active) != 0 {
+		t.Fatalf("Active = %+v after unsubscribe, want none", active)
+	}
+}
+
+func TestSubManagerResubscribe(t *testing.T) {
+	b := newBroker(t)
+	sender := connect(t, b, "b")
+	readLoop(sender, func(msproto.Frame) {})
+	m := client.NewSubManager(discardWriter{})
+	defer m.Close()
+
+	var first *client.SubFuture
+	connected := 0
+	sup := client.NewSupervisor(pipeDialer(b, "a"),
+		client.WithBackoff(time.Millisecond, time.Millisecond),
+		client.WithOnEvent(func(event client.Event) {
+			m.HandleEvent(event)
+			if event.State != client.StateConnected {
+				return
+			}
+			connected++
+			if connected == 1 {
+				var err error
+				if first, err = m.Subscribe("live1", msproto.ChannelTypeLive, "p1"); err != nil {
+					t.Error(err)
+				}
+			}
+		}),
+	)
+
+	var resubs []*msproto.SubackPacket
+	var recv *msproto.RecvPacket
+	err := sup.Run(context.Background(), func(s *client.Session) error {
+		for {
+			frame, err := s.ReadFrame()
+			if err != nil {
+				return err
+			}
+			switch p := frame.(type) {
+			case *msproto.SubackPacket:
+				if !m.HandleSuback(p) {
+					t.Errorf("SUBACK %s not matched", p.SubNo)
+				}
+				if connected == 1 {
+					// 订阅生效后断开，等待重连
+					return nil
+				}
+				resubs = append(resubs, p)
+				// 新连接的订阅生效后才能收到频道消息
+				if err = sender.WriteFrame(&msproto.SendPacket{ClientSeq: 1, ClientMsgNo: "m1", ChannelID: "live1", ChannelType: msproto.ChannelTypeLive, Payload: []byte("again")}); err != nil {
+					return err
+				}
+			case *msproto.RecvPacket:
+				recv = p
+				return &client.DisconnectError{ReasonCode: msproto.ReasonConnectKick}
+			}
+		}
+	})
+	if code, _ := client.ReasonCodeOf(err); code != msproto.ReasonConnectKick {
+		t.Fatalf("Run = %v", err)
+	}
+	if _, err = first.Result(); err != nil {
+		t.Fatalf("first subscribe: %v", err)
+	}
+	if connected != 2 || len(resubs) != 1 {
+		t.Fatalf("connected %d times with %d resubscriptions, want 2 and 1", connected, len(resubs))
+	}
+	if resubs[0].SubNo == first.Packet().SubNo || resubs[0].ChannelID != "live1" {
+		t.Errorf("resubscribe SUBACK = %+v, want a new SubNo for live1", resubs[0])
+	}
+	if recv == nil || string(recv.Payload) != "again" {
+		t.Errorf("RECV = %v, want the message sent after resubscribing", recv)
+	}
+	if active := m.Active(); len(active) != 1 || active[0].Param != "p1" {
+		t.Errorf("Active = %+v, want live1 with its param", active)
+	}
+}
+
+func TestSubManagerTimeout(t *testing.T) {
+	m := client.NewSubManager(discardWriter{}, client.WithSubAckTimeout(20*time.Millisecond))
+	defer m.Close()
+	f, err := m.Subscribe("live1", msproto.ChannelTypeLive, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = waitSub(t, f); !errors.Is(err, client.ErrSubTimeout) {
+		t.Fatalf("err = %v, want ErrSubTimeout", err)
+	}
+	if m.HandleSuback(&msproto.SubackPacket{SubNo: f.Packet().SubNo}) {
+		t.Error("late SUBACK matched a timed out SUB")
+	}
+	if active := m.Active(); len(active) != 0 {
+		t.Errorf("Active = %+v, want none", active)
+	}
+}
@@ -0,0 +1,264 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"sync/atomic"
+	"time"
+
+	msproto "github.com/mushanyux/MSIMGoProto"
+	"github.com/pkg/errors"
+)
+
+// DisconnectError 服务端发送了DISCONNECT
+type DisconnectError struct {
+	ReasonCode msproto.ReasonCode
+	Reason     string
+}
+
+func (e *DisconnectError) Error() string {
+	return fmt.Sprintf("disconnected: %s %s", e.ReasonCode, e.Reason)
+}
+
+// State 连接状态
+type State int
+
+const (
+	// StateConnecting 正在连接
+	StateConnecting State = iota
+	// StateConnected 已连接
+	StateConnected
+	// StateBackoff 连接断开，等待重连
+	StateBackoff
+	// StateStopped 不再重连
+	StateStopped
+)
+
+func (s State) String() string {
+	switch s {
+	case StateConnecting:
+		return "Connecting"
+	case StateConnected:
+		return "Connected"
+	case StateBackoff:
+		return "Backoff"
+	case StateStopped:
+		return "Stopped"
+	}
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+// Event 状态变化事件
+type Event struct {
+	State   State
+	Attempt int           // 连续失败的次数
+	Delay   time.Duration // StateBackoff时等待的时间
+	Err     error         // 导致断开或者停止的错误
+	Session *Session      // StateConnected时的连接
+}
+
+// SupervisorOptions 重连配置
+type SupervisorOptions struct {
+	MinBackoff       time.Duration // 第一次重连的等待时间
+	MaxBackoff       time.Duration // 最长等待时间
+	Multiplier       float64       // 每次失败后等待时间的倍数
+	Jitter           float64       // 随机抖动的比例，0.2表示在等待时间的±20%内随机
+	RateLimitBackoff time.Duration // 被限流（ReasonRateLimit）时最少等待的时间
+	OnEvent          func(event Event)
+}
+
+// NewSupervisorOptions 默认配置
+func NewSupervisorOptions() *SupervisorOptions {
+	return &SupervisorOptions{
+		MinBackoff:       500 * time.Millisecond,
+		MaxBackoff:       30 * time.Second,
+		Multiplier:       2,
+		Jitter:           0.2,
+		RateLimitBackoff: 30 * time.Second,
+	}
+}
+
+type SupervisorOption func(*SupervisorOptions)
+
+// WithBackoff 最短和最长等待时间
+func WithBackoff(minBackoff, maxBackoff time.Duration) SupervisorOption {
+	return func(o *SupervisorOptions) {
+		o.MinBackoff = minBackoff
+		o.MaxBackoff = maxBackoff
+	}
+}
+
+// WithMultiplier 每次失败后等待时间的倍数
+func WithMultiplier(multiplier float64) SupervisorOption {
+	return func(o *SupervisorOptions) {
+		o.Multiplier = multiplier
+	}
+}
+
+// WithJitter 随机抖动的比例
+func WithJitter(jitter float64) SupervisorOption {
+	return func(o *SupervisorOptions) {
+		o.Jitter = jitter
+	}
+}
+
+// WithRateLimitBackoff 被限流时最少等待的时间
+func WithRateLimitBackoff(backoff time.Duration) SupervisorOption {
+	return func(o *SupervisorOptions) {
+		o.RateLimitBackoff = backoff
+	}
+}
+
+// WithOnEvent 状态变化回调
+func WithOnEvent(onEvent func(event Event)) SupervisorOption {
+	return func(o *SupervisorOptions) {
+		o.OnEvent = onEvent
+	}
+}
+
+// DialFunc 建立连接并完成握手
+type DialFunc func(ctx context.Context) (*Session, error)
+
+// TCPDialer 通过TCP连接addr的DialFunc
+func TCPDialer(addr string, uid, token string, opts ...Option) DialFunc {
+	timeout := newOptions(opts).Timeout
+	return Dialer(func(ctx context.Context) (net.Conn, error) {
+		dialer := &net.Dialer{Timeout: timeout}
+		return dialer.DialContext(ctx, "tcp", addr)
+	}, uid, token, opts...)
+}
+
+// Dialer 通过dial建立连接并完成握手的DialFunc
+// 累计每次CONNACK（包括被拒绝的）中的TimeDiff，校正之后CONNECT的ClientTimestamp，
+// 客户端时钟偏差导致CONNECT被服务端防重放拒绝后，重连时可以通过校验
+func Dialer(dial func(ctx context.Context) (net.Conn, error), uid, token string, opts ...Option) DialFunc {
+	var timeDiff atomic.Int64
+	timeDiff.Store(newOptions(opts).TimeDiff)
+	return func(ctx context.Context) (*Session, error) {
+		conn, err := dial(ctx)
+		if err != nil {
+			return nil, err
+		}
+		o := newOptions(opts)
+		o.TimeDiff = timeDiff.Load()
+		session, err := handshake(conn, uid, token, o)
+		var connackErr *ConnackError
+		switch {
+		case err == nil:
+			timeDiff.Add(session.TimeDiff())
+		case errors.As(err, &connackErr):
+			timeDiff.Add(connackErr.TimeDiff)
+		}
+		return session, err
+	}
+}
+
+// Supervisor 连接断开后按原因码决定是否重连，重连使用带随机抖动的指数退避
+type Supervisor struct {
+	dial DialFunc
+	opts *SupervisorOptions
+}
+
+// NewSupervisor 创建重连管理
+func NewSupervisor(dial DialFunc, opts ...SupervisorOption) *Supervisor {
+	o := NewSupervisorOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+	return &Supervisor{
+		dial: dial,
+		opts: o,
+	}
+}
+
+// Run 建立连接并调用serve，serve返回后（连接断开）根据错误决定是否重连
+// serve收到DISCONNECT时应当返回*DisconnectError，以便按原因码处理
+// 遇到不可重连的错误或者ctx结束时返回
+func (s *Supervisor) Run(ctx context.Context, serve func(session *Session) error) error {
+	attempt := 0
+	for {
+		s.emit(Event{State: StateConnecting, Attempt: attempt})
+		session, err := s.dial(ctx)
+		if err == nil {
+			attempt = 0
+			s.emit(Event{State: StateConnected, Session: session})
+			err = serve(session)
+			_ = session.Close()
+			if err == nil {
+				err = errors.New("session closed")
+			}
+		}
+		if ctx.Err() != nil {
+			s.emit(Event{State: StateStopped, Attempt: attempt, Err: ctx.Err()})
+			return ctx.Err()
+		}
+		if IsFatal(err) {
+			s.emit(Event{State: StateStopped, Attempt: attempt, Err: err})
+			return err
+		}
+		attempt++
+		delay := s.backoff(attempt, err)
+		s.emit(Event{State: StateBackoff, Attempt: attempt, Delay: delay, Err: err})
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			s.emit(Event{State: StateStopped, Attempt: attempt, Err: ctx.Err()})
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff 第attempt次失败后的等待时间
+func (s *Supervisor) backoff(attempt int, err error) time.Duration {
+	delay := float64(s.opts.MinBackoff)
+	for i := 1; i < attempt && delay < float64(s.opts.MaxBackoff); i++ {
+		delay *= s.opts.Multiplier
+	}
+	if s.opts.MaxBackoff > 0 && delay > float64(s.opts.MaxBackoff) {
+		delay = float64(s.opts.MaxBackoff)
+	}
+	if s.opts.Jitter > 0 {
+		delay += delay * s.opts.Jitter * (rand.Float64()*2 - 1)
+	}
+	d := time.Duration(delay)
+	if code, ok := ReasonCodeOf(err); ok && code == msproto.ReasonRateLimit && d < s.opts.RateLimitBackoff {
+		d = s.opts.RateLimitBackoff
+	}
+	return d
+}
+
+func (s *Supervisor) emit(event Event) {
+	if s.opts.OnEvent != nil {
+		s.opts.OnEvent(event)
+	}
+}
+
+// ReasonCodeOf 取出CONNACK或者DISCONNECT中的原因码
+func ReasonCodeOf(err error) (msproto.ReasonCode, bool) {
+	var connackErr *ConnackError
+	if errors.As(err, &connackErr) {
+		return connackErr.ReasonCode, true
+	}
+	var disconnectErr *DisconnectError
+	if errors.As(err, &disconnectErr) {
+		return disconnectErr.ReasonCode, true
+	}
+	return 0, false
+}
+
+// IsFatal 是否是不应该重连的错误（认证失败、被踢、被封禁）
+func IsFatal(err error) bool {
+	code, ok := ReasonCodeOf(err)
+	if !ok {
+		return false
+	}
+	switch code {
+	case msproto.ReasonAuthFail, msproto.ReasonConnectKick, msproto.ReasonBan:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,188 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	msproto "github.com/mushanyux/MSIMGoProto"
+	"github.com/mushanyux/MSIMGoProto/broker"
+	"github.com/mushanyux/MSIMGoProto/client"
+	"github.com/mushanyux/MSIMGoProto/server"
+)
+
+func pipeDialer(b *broker.Broker, uid string, opts ...client.Option) client.DialFunc {
+	return client.Dialer(func(ctx context.Context) (net.Conn, error) {
+		return b.Pipe(), nil
+	}, uid, uid+"-token", opts...)
+}
+
+func TestSupervisorReconnect(t *testing.T) {
+	var attempts atomic.Int32
+	b := newBroker(t, broker.WithAuth(func(c *msproto.ConnectPacket) msproto.ReasonCode {
+		switch attempts.Add(1) {
+		case 1:
+			return msproto.ReasonSystemError
+		case 2:
+			return msproto.ReasonRateLimit
+		}
+		return msproto.ReasonSuccess
+	}))
+
+	var events []client.Event
+	sup := client.NewSupervisor(pipeDialer(b, "a"),
+		client.WithBackoff(time.Millisecond, 4*time.Millisecond),
+		client.WithJitter(0),
+		client.WithRateLimitBackoff(20*time.Millisecond),
+		client.WithOnEvent(func(event client.Event) {
+			events = append(events, event)
+		}),
+	)
+	served := 0
+	err := sup.Run(context.Background(), func(s *client.Session) error {
+		served++
+		if b.Online("a") == 0 {
+			t.Errorf("session %d not registered on the broker", served)
+		}
+		if served == 1 {
+			// 连接断开，重连
+			return nil
+		}
+		return &client.DisconnectError{ReasonCode: msproto.ReasonConnectKick, Reason: "kicked"}
+	})
+
+	var disconnectErr *client.DisconnectError
+	if !errors.As(err, &disconnectErr) || disconnectErr.ReasonCode != msproto.ReasonConnectKick {
+		t.Fatalf("Run = %v, want the kick DisconnectError", err)
+	}
+	if served != 2 {
+		t.Fatalf("served %d sessions, want 2", served)
+	}
+
+	want := []struct {
+		state   client.State
+		attempt int
+	}{
+		{client.StateConnecting, 0},
+		{client.StateBackoff, 1},
+		{client.StateConnecting, 1},
+		{client.StateBackoff, 2},
+		{client.StateConnecting, 2},
+		{client.StateConnected, 0},
+		// 连接成功后重新计数
+		{client.StateBackoff, 1},
+		{client.StateConnecting, 1},
+		{client.StateConnected, 0},
+		{client.StateStopped, 0},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events %v, want %d", len(events), events, len(want))
+	}
+	for i, w := range want {
+		if events[i].State != w.state || events[i].Attempt != w.attempt {
+			t.Errorf("event %d = %s/%d, want %s/%d", i, events[i].State, events[i].Attempt, w.state, w.attempt)
+		}
+	}
+	if code, _ := client.ReasonCodeOf(events[1].Err); code != msproto.ReasonSystemError || events[1].Delay != time.Millisecond {
+		t.Errorf("first backoff = %v after %v, want 1ms after ReasonSystemError", events[1].Delay, events[1].Err)
+	}
+	if code, _ := client.ReasonCodeOf(events[3].Err); code != msproto.ReasonRateLimit || events[3].Delay != 20*time.Millisecond {
+		t.Errorf("rate limited backoff = %v after %v, want 20ms after ReasonRateLimit", events[3].Delay, events[3].Err)
+	}
+	if events[5].Session == nil {
+		t.Error("StateConnected event without a session")
+	}
+}
+
+func TestSupervisorFatalConnack(t *testing.T) {
+	b := newBroker(t, broker.WithAuth(tokenAuth))
+	dials := 0
+	// token错误，认证失败后不再重连
+	sup := client.NewSupervisor(func(ctx context.Context) (*client.Session, error) {
+		dials++
+		return client.Connect(b.Pipe(), "a", "bad")
+	}, client.WithBackoff(time.Millisecond, time.Millisecond))
+
+	err := sup.Run(context.Background(), func(s *client.Session) error {
+		t.Error("serve called after a failed handshake")
+		return nil
+	})
+	if !client.IsFatal(err) || dials != 1 {
+		t.Fatalf("Run = %v after %d dials, want a fatal error after 1", err, dials)
+	}
+}
+
+func TestSupervisorContextCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	dials := 0
+	sup := client.NewSupervisor(func(ctx context.Context) (*client.Session, error) {
+		dials++
+		if dials == 3 {
+			cancel()
+		}
+		return nil, errors.New("connection refused")
+	}, client.WithBackoff(time.Millisecond, time.Millisecond), client.WithOnEvent(func(event client.Event) {
+		if event.State == client.StateStopped && !errors.Is(event.Err, context.Canceled) {
+			t.Errorf("stopped with %v, want context.Canceled", event.Err)
+		}
+	}))
+
+	done := make(chan error, 1)
+	go func() {
+		done <- sup.Run(ctx, func(s *client.Session) error { return nil })
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) || dials != 3 {
+			t.Fatalf("Run = %v after %d dials, want context.Canceled after 3", err, dials)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+}
+
+func TestSupervisorReplayClockSkew(t *testing.T) {
+	// 服务端时间比客户端快一小时，第一次CONNECT不在防重放的时间窗口内
+	serverNow := func() time.Time { return time.Now().Add(time.Hour) }
+	b := newBroker(t,
+		broker.WithNow(serverNow),
+		broker.WithReplayGuard(server.NewReplayGuard(server.WithReplayNow(serverNow))),
+	)
+
+	var events []client.Event
+	sup := client.NewSupervisor(pipeDialer(b, "a"),
+		client.WithBackoff(time.Millisecond, time.Millisecond),
+		client.WithOnEvent(func(event client.Event) {
+			events = append(events, event)
+		}),
+	)
+	err := sup.Run(context.Background(), func(s *client.Session) error {
+		if diff := time.Duration(s.TimeDiff()) * time.Millisecond; diff < -time.Minute || diff > time.Minute {
+			t.Errorf("TimeDiff after correction = %s, want about 0", diff)
+		}
+		return &client.DisconnectError{ReasonCode: msproto.ReasonConnectKick}
+	})
+	if code, _ := client.ReasonCodeOf(err); code != msproto.ReasonConnectKick {
+		t.Fatalf("Run = %v", err)
+	}
+
+	want := []client.State{client.StateConnecting, client.StateBackoff, client.StateConnecting, client.StateConnected, client.StateStopped}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events %v, want %d", len(events), events, len(want))
+	}
+	for i, state := range want {
+		if events[i].State != state {
+			t.Errorf("event %d = %s, want %s", i, events[i].State, state)
+		}
+	}
+	var connackErr *client.ConnackError
+	if !errors.As(events[1].Err, &connackErr) || connackErr.ReasonCode != msproto.ReasonSystemError {
+		t.Fatalf("first attempt failed with %v, want ConnackError ReasonSystemError", events[1].Err)
+	}
+	if diff := time.Duration(connackErr.TimeDiff) * time.Millisecond; diff > -time.Hour+time.Minute || diff < -time.Hour-time.Minute {
+		t.Errorf("rejected CONNACK TimeDiff = %s, want about -1h", diff)
+	}
+}
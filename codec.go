@@ -0,0 +1,195 @@
+package msproto
+
+import (
+	"io"
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+// Negotiate 协商协议版本，取客户端版本和服务端支持的最高版本中较小的一个，结果不超过LatestVersion
+func Negotiate(clientVersion, serverSupported uint8) (uint8, error) {
+	if clientVersion == 0 {
+		return 0, errors.Wrap(ErrUnsupportedVersion, "client version is 0")
+	}
+	if serverSupported == 0 {
+		return 0, errors.Wrap(ErrUnsupportedVersion, "server version is 0")
+	}
+	version := min(clientVersion, serverSupported)
+	if version > LatestVersion {
+		return LatestVersion, nil
+	}
+	return version, nil
+}
+
+// Codec 绑定了协议版本的编解码器，一个连接使用一个Codec，避免同一个连接上混用不同的版本
+type Codec struct {
+	proto   *MSProto
+	version uint8
+	cipher  PayloadCipher
+}
+
+// NewCodec 创建绑定version的编解码器
+func (l *MSProto) NewCodec(version uint8) (*Codec, error) {
+	if err := l.checkVersion(version); err != nil {
+		return nil, err
+	}
+	return &Codec{
+		proto:   l,
+		version: version,
+	}, nil
+}
+
+// ServerCodec 服务端收到CONNECT后协商版本，将协商后的版本写入connack的ServerVersion，并返回绑定该版本的编解码器
+// CONNECT的格式与版本无关，服务端可以用自己支持的任意版本解码CONNECT
+func (l *MSProto) ServerCodec(connect *ConnectPacket, connack *ConnackPacket) (*Codec, error) {
+	if connect == nil || connack == nil {
+		return nil, ErrNilFrame
+	}
+	version, err := Negotiate(connect.Version, l.Options().MaxVersion)
+	if err != nil {
+		return nil, err
+	}
+	codec, err := l.NewCodec(version)
+	if err != nil {
+		return nil, err
+	}
+	connack.HasServerVersion = true
+	connack.ServerVersion = version
+	return codec, nil
+}
+
+// ClientCodec 客户端收到CONNACK后根据服务端版本得到绑定协商版本的编解码器
+// 服务端没有返回版本时使用客户端在CONNECT中提议的版本
+func (l *MSProto) ClientCodec(connect *ConnectPacket, connack *ConnackPacket) (*Codec, error) {
+	if connect == nil || connack == nil {
+		return nil, ErrNilFrame
+	}
+	version := connect.Version
+	if connack.HasServerVersion {
+		var err error
+		if version, err = Negotiate(connect.Version, connack.ServerVersion); err != nil {
+			return nil, err
+		}
+	}
+	return l.NewCodec(version)
+}
+
+// Version 协商后的协议版本
+func (c *Codec) Version() uint8 {
+	return c.version
+}
+
+// Proto 协议对象
+func (c *Codec) Proto() *MSProto {
+	return c.proto
+}
+
+// WithPayloadCipher 返回使用cipher加解密SEND和RECV的Payload的编解码器，cipher为nil时不加解密
+func (c *Codec) WithPayloadCipher(cipher PayloadCipher) *Codec {
+	return &Codec{
+		proto:   c.proto,
+		version: c.version,
+		cipher:  cipher,
+	}
+}
+
+// PayloadCipher Payload加解密
+func (c *Codec) PayloadCipher() PayloadCipher {
+	return c.cipher
+}
+
+// DecodeFrame 解码包 返回frame 和 数据大小 和 error
+// MsgKey校验失败时返回*MsgKeyError，Payload解密失败时返回*PayloadError，数据大小仍为包的大小
+func (c *Codec) DecodeFrame(data []byte) (Frame, int, error) {
+	frame, n, err := c.proto.DecodeFrame(data, c.version)
+	if err != nil {
+		return nil, n, err
+	}
+	if err = decryptFrame(c.cipher, frame, c.version); err != nil {
+		return nil, n, err
+	}
+	return frame, n, nil
+}
+
+// DecodeFrameInto 解码到已有的包
+func (c *Codec) DecodeFrameInto(data []byte, frame Frame) (int, error) {
+	n, err := c.proto.DecodeFrameInto(data, frame, c.version)
+	if err != nil {
+		return n, err
+	}
+	return n, decryptFrame(c.cipher, frame, c.version)
+}
+
+// DecodePacketWithConn 从conn中解码一个包
+func (c *Codec) DecodePacketWithConn(conn io.Reader) (Frame, error) {
+	frame, err := c.proto.DecodePacketWithConn(conn, c.version)
+	if err != nil {
+		return nil, err
+	}
+	if err = decryptFrame(c.cipher, frame, c.version); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+// NewFrameReader 创建帧读取器
+func (c *Codec) NewFrameReader(r io.Reader) *FrameReader {
+	fr := NewFrameReader(r, c.proto, c.version)
+	fr.cipher = c.cipher
+	return fr
+}
+
+// EncodeFrame 编码包
+func (c *Codec) EncodeFrame(frame Frame) ([]byte, error) {
+	frame, err := encryptFrame(c.cipher, frame, c.version)
+	if err != nil {
+		return nil, err
+	}
+	return c.proto.EncodeFrame(frame, c.version)
+}
+
+// WriteFrame 编码包，并写入writer
+func (c *Codec) WriteFrame(w Writer, frame Frame) error {
+	frame, err := encryptFrame(c.cipher, frame, c.version)
+	if err != nil {
+		return err
+	}
+	return c.proto.WriteFrame(w, frame, c.version)
+}
+
+// FrameSize 包编码后的总大小
+func (c *Codec) FrameSize(frame Frame) (int, error) {
+	frame, err := encryptFrame(c.cipher, frame, c.version)
+	if err != nil {
+		return 0, err
+	}
+	return c.proto.FrameSize(frame, c.version)
+}
+
+// EncodeFrames 将多个包编码到一块连续的内存中
+func (c *Codec) EncodeFrames(frames []Frame) ([]byte, error) {
+	frames, err := encryptFrames(c.cipher, frames, c.version)
+	if err != nil {
+		return nil, err
+	}
+	return c.proto.EncodeFrames(frames, c.version)
+}
+
+// EncodeFramesBuffers 将多个包分别编码，每个包对应net.Buffers中的一个元素
+func (c *Codec) EncodeFramesBuffers(frames []Frame) (net.Buffers, error) {
+	frames, err := encryptFrames(c.cipher, frames, c.version)
+	if err != nil {
+		return nil, err
+	}
+	return c.proto.EncodeFramesBuffers(frames, c.version)
+}
+
+// WriteFrames 将多个包编码后通过net.Buffers.WriteTo写入w
+func (c *Codec) WriteFrames(w io.Writer, frames []Frame) error {
+	frames, err := encryptFrames(c.cipher, frames, c.version)
+	if err != nil {
+		return err
+	}
+	return c.proto.WriteFrames(w, frames, c.version)
+}
@@ -0,0 +1,157 @@
+package msproto
+
+import (
+	"math"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		client, server uint8
+		want           uint8
+		err            error
+	}{
+		{4, 6, 4, nil},
+		{6, 4, 4, nil},
+		{5, 5, 5, nil},
+		{1, LatestVersion, 1, nil},
+		{0, LatestVersion, 0, ErrUnsupportedVersion},
+		{LatestVersion, 0, 0, ErrUnsupportedVersion},
+		{0, 0, 0, ErrUnsupportedVersion},
+		// 超过LatestVersion时使用LatestVersion
+		{LatestVersion + 1, LatestVersion, LatestVersion, nil},
+		{LatestVersion + 3, LatestVersion + 2, LatestVersion, nil},
+		{math.MaxUint8, math.MaxUint8, LatestVersion, nil},
+	}
+	for _, tt := range tests {
+		got, err := Negotiate(tt.client, tt.server)
+		if !errors.Is(err, tt.err) || got != tt.want {
+			t.Errorf("Negotiate(%d, %d) = %d, %v, want %d, %v", tt.client, tt.server, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestConnackVersion(t *testing.T) {
+	tests := []struct {
+		name          string
+		clientVersion uint8
+		serverMax     uint8
+		negotiated    uint8
+		hasNodeId     bool
+	}{
+		{"same version", LatestVersion, LatestVersion, LatestVersion, true},
+		{"old client", 3, LatestVersion, 3, false},
+		{"old server", LatestVersion, 3, 3, false},
+		{"client at 4", 4, LatestVersion, 4, true},
+		{"server at 4", LatestVersion, 4, 4, true},
+		{"client above latest", LatestVersion + 1, LatestVersion, LatestVersion, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 严格模式下多余或缺少的NodeId都会导致解码失败
+			server := New(WithVersionRange(1, tt.serverMax), WithStrict(true))
+			client := New(WithVersionRange(1, math.MaxUint8), WithStrict(true))
+			connect := &ConnectPacket{Version: tt.clientVersion, UID: "u"}
+
+			connack := &ConnackPacket{ReasonCode: ReasonSuccess, TimeDiff: 1, NodeId: 42}
+			serverCodec, err := server.ServerCodec(connect, connack)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if serverCodec.Version() != tt.negotiated || !connack.HasServerVersion || connack.ServerVersion != tt.negotiated {
+				t.Fatalf("server codec v%d, CONNACK ServerVersion %d, want %d", serverCodec.Version(), connack.ServerVersion, tt.negotiated)
+			}
+			data, err := serverCodec.EncodeFrame(connack)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// 客户端按CONNECT中的版本解码CONNACK
+			frame, n, err := client.DecodeFrame(data, tt.clientVersion)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := frame.(*ConnackPacket)
+			if n != len(data) || got.ServerVersion != tt.negotiated || got.TimeDiff != 1 {
+				t.Fatalf("decoded %+v from %d of %d bytes", got, n, len(data))
+			}
+			if wantNodeId := tt.hasNodeId; (got.NodeId == 42) != wantNodeId {
+				t.Fatalf("NodeId = %d, want present %v", got.NodeId, wantNodeId)
+			}
+			clientCodec, err := client.ClientCodec(connect, got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if clientCodec.Version() != tt.negotiated {
+				t.Fatalf("client codec v%d, want %d", clientCodec.Version(), tt.negotiated)
+			}
+		})
+	}
+}
+
+func TestConnackWithoutServerVersion(t *testing.T) {
+	// 不返回服务端版本的CONNACK按客户端提议的版本判断NodeId
+	proto := New(WithStrict(true))
+	for _, version := range []uint8{3, 4, LatestVersion} {
+		data, err := proto.EncodeFrame(&ConnackPacket{ReasonCode: ReasonSuccess, NodeId: 42}, version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		frame, _, err := proto.DecodeFrame(data, version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		connack := frame.(*ConnackPacket)
+		if connack.HasServerVersion || (connack.NodeId == 42) != (version >= 4) {
+			t.Errorf("v%d: %+v", version, connack)
+		}
+		codec, err := proto.ClientCodec(&ConnectPacket{Version: version}, connack)
+		if err != nil || codec.Version() != version {
+			t.Errorf("v%d: ClientCodec = %v, %v", version, codec, err)
+		}
+	}
+}
+
+func TestCodecVersion(t *testing.T) {
+	proto := New()
+	if _, err := New(WithVersionRange(4, LatestVersion)).NewCodec(3); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Fatalf("NewCodec(3) = %v, want ErrUnsupportedVersion", err)
+	}
+	if _, err := proto.ServerCodec(&ConnectPacket{}, &ConnackPacket{}); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Fatalf("ServerCodec with version 0 = %v, want ErrUnsupportedVersion", err)
+	}
+	if _, err := proto.ClientCodec(&ConnectPacket{Version: 4}, &ConnackPacket{Framer: Framer{HasServerVersion: true}}); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Fatalf("ClientCodec with ServerVersion 0 = %v, want ErrUnsupportedVersion", err)
+	}
+	if _, err := proto.ServerCodec(nil, &ConnackPacket{}); !errors.Is(err, ErrNilFrame) {
+		t.Fatalf("ServerCodec(nil) = %v, want ErrNilFrame", err)
+	}
+
+	// 绑定的版本决定ClientSeq的宽度
+	send := &SendPacket{ClientSeq: math.MaxUint32 + 1, ChannelID: "c", ChannelType: ChannelTypePerson}
+	v4, err := proto.NewCodec(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = v4.EncodeFrame(send); !errors.Is(err, ErrFieldOverflow) {
+		t.Fatalf("v4 EncodeFrame = %v, want ErrFieldOverflow", err)
+	}
+	v5, err := proto.NewCodec(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := v5.EncodeFrame(send)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame, _, err := v5.DecodeFrame(data)
+	if err != nil || frame.(*SendPacket).ClientSeq != send.ClientSeq {
+		t.Fatalf("v5 round trip = %v, %v", frame, err)
+	}
+	// 用另一个版本解码得到不同的字段
+	if frame, _, err = v4.DecodeFrame(data); err == nil && frame.(*SendPacket).ClientSeq == send.ClientSeq {
+		t.Fatal("v4 codec decoded a v5 ClientSeq")
+	}
+}
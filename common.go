@@ -40,6 +40,23 @@ func FramerFromUint8(v uint8) Framer {
 	return p
 }
 
+// framerOf 获取包的Framer，frame不是Framer时根据Frame接口重新构造
+func framerOf(frame Frame) Framer {
+	if f, ok := frame.(Framer); ok {
+		return f
+	}
+	return Framer{
+		FrameType:        frame.GetFrameType(),
+		RemainingLength:  frame.GetRemainingLength(),
+		NoPersist:        frame.GetNoPersist(),
+		RedDot:           frame.GetRedDot(),
+		SyncOnce:         frame.GetsyncOnce(),
+		DUP:              frame.GetDUP(),
+		HasServerVersion: frame.GetHasServerVersion(),
+		FrameSize:        frame.GetFrameSize(),
+	}
+}
+
 // GetFrameType GetFrameType
 func (f Framer) GetFrameType() FrameType {
 	return f.FrameType
@@ -319,6 +336,7 @@ const (
 	SettingByteSize         = 1 // setting固定大小
 	StringFixLenByteSize    = 2 // 字符串可变大小
 	ClientSeqByteSize       = 4 // clientSeq的大小
+	ClientSeq64ByteSize     = 8 // 协议版本5及以上clientSeq的大小
 	ChannelTypeByteSize     = 1 // channelType的大小
 	VersionByteSize         = 1 // version的大小
 	DeviceFlagByteSize      = 1
@@ -2,8 +2,6 @@ package msproto
 
 import (
 	"fmt"
-
-	"github.com/pkg/errors"
 )
 
 // ConnackPacket 连接回执包
@@ -17,6 +15,17 @@ type ConnackPacket struct {
 	NodeId        uint64     // 节点Id
 }
 
+// Reset 重置包，用于复用
+func (c *ConnackPacket) Reset() {
+	c.Framer = Framer{}
+	c.ServerVersion = 0
+	c.ServerKey = ""
+	c.Salt = ""
+	c.TimeDiff = 0
+	c.ReasonCode = 0
+	c.NodeId = 0
+}
+
 // GetFrameType 获取包类型
 func (c ConnackPacket) GetFrameType() FrameType {
 	return CONNACK
@@ -25,21 +34,32 @@ func (c ConnackPacket) String() string {
 	return fmt.Sprintf("TimeDiff: %d ReasonCode:%s", c.TimeDiff, c.ReasonCode.String())
 }
 
-func encodeConnack(connack *ConnackPacket, enc *Encoder, version uint8) error {
+// connackVersion CONNACK中版本相关字段使用的版本
+// 带有服务端版本时，客户端提议的版本可能高于协商后的版本，以两者中较小的为准
+func connackVersion(hasServerVersion bool, serverVersion uint8, version uint8) uint8 {
+	if hasServerVersion && serverVersion > 0 && serverVersion < version {
+		return serverVersion
+	}
+	return version
+}
+
+func encodeConnack(frame Frame, enc *Encoder, version uint8) error {
+	connack := frame.(*ConnackPacket)
 	if connack.GetHasServerVersion() {
-		enc.WriteUint8(connack.ServerVersion)
+		enc.Field("ServerVersion").WriteUint8(connack.ServerVersion)
 	}
-	enc.WriteInt64(connack.TimeDiff)
-	_ = enc.WriteByte(connack.ReasonCode.Byte())
-	enc.WriteString(connack.ServerKey)
-	enc.WriteString(connack.Salt)
-	if version >= 4 {
-		enc.WriteUint64(connack.NodeId)
+	enc.Field("TimeDiff").WriteInt64(connack.TimeDiff)
+	_ = enc.Field("ReasonCode").WriteByte(connack.ReasonCode.Byte())
+	enc.Field("ServerKey").WriteString(connack.ServerKey)
+	enc.Field("Salt").WriteString(connack.Salt)
+	if connackVersion(connack.GetHasServerVersion(), connack.ServerVersion, version) >= 4 {
+		enc.Field("NodeId").WriteUint64(connack.NodeId)
 	}
-	return nil
+	return enc.Err()
 }
 
-func encodeConnackSize(packet *ConnackPacket, version uint8) int {
+func encodeConnackSize(frame Frame, version uint8) int {
+	packet := frame.(*ConnackPacket)
 	size := 0
 	if packet.GetHasServerVersion() {
 		size += VersionByteSize
@@ -48,41 +68,48 @@ func encodeConnackSize(packet *ConnackPacket, version uint8) int {
 	size += ReasonCodeByteSize
 	size += (len(packet.ServerKey) + StringFixLenByteSize)
 	size += (len(packet.Salt) + StringFixLenByteSize)
-	if version >= 4 {
+	if connackVersion(packet.GetHasServerVersion(), packet.ServerVersion, version) >= 4 {
 		size += NodeIdByteSize
 	}
 	return size
 }
 
 func decodeConnack(frame Frame, data []byte, version uint8) (Frame, error) {
-	dec := NewDecoder(data)
 	connackPacket := &ConnackPacket{}
-	connackPacket.Framer = frame.(Framer)
+	if err := decodeConnackInto(connackPacket, framerOf(frame), NewDecoder(data), version); err != nil {
+		return nil, err
+	}
+	return connackPacket, nil
+}
 
+// decodeConnackInto 解码到已有的包
+func decodeConnackInto(connackPacket *ConnackPacket, framer Framer, dec *Decoder, version uint8) error {
+	connackPacket.Reset()
+	connackPacket.Framer = framer
 	var err error
-	if frame.GetHasServerVersion() {
+	if framer.HasServerVersion {
 		if connackPacket.ServerVersion, err = dec.Uint8(); err != nil {
-			return nil, errors.Wrap(err, "解码version失败！")
+			return newDecodeError(CONNACK, "ServerVersion", dec.Offset(), err)
 		}
 	}
 	if connackPacket.TimeDiff, err = dec.Int64(); err != nil {
-		return nil, errors.Wrap(err, "解码TimeDiff失败！")
+		return newDecodeError(CONNACK, "TimeDiff", dec.Offset(), err)
 	}
 	var reasonCode uint8
 	if reasonCode, err = dec.Uint8(); err != nil {
-		return nil, errors.Wrap(err, "解码ReasonCode失败！")
+		return newDecodeError(CONNACK, "ReasonCode", dec.Offset(), err)
 	}
 	connackPacket.ReasonCode = ReasonCode(reasonCode)
 	if connackPacket.ServerKey, err = dec.String(); err != nil {
-		return nil, errors.Wrap(err, "解码ServerKey失败！")
+		return newDecodeError(CONNACK, "ServerKey", dec.Offset(), err)
 	}
 	if connackPacket.Salt, err = dec.String(); err != nil {
-		return nil, errors.Wrap(err, "解码Salt失败！")
+		return newDecodeError(CONNACK, "Salt", dec.Offset(), err)
 	}
-	if version >= 4 {
+	if connackVersion(framer.HasServerVersion, connackPacket.ServerVersion, version) >= 4 {
 		if connackPacket.NodeId, err = dec.Uint64(); err != nil {
-			return nil, errors.Wrap(err, "解码NodeId失败！")
+			return newDecodeError(CONNACK, "NodeId", dec.Offset(), err)
 		}
 	}
-	return connackPacket, nil
+	return nil
 }
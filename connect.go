@@ -2,8 +2,6 @@ package msproto
 
 import (
 	"fmt"
-
-	"github.com/pkg/errors"
 )
 
 // ConnectPacket 连接包
@@ -18,6 +16,18 @@ type ConnectPacket struct {
 	Token           string     // token
 }
 
+// Reset 重置包，用于复用
+func (c *ConnectPacket) Reset() {
+	c.Framer = Framer{}
+	c.Version = 0
+	c.ClientKey = ""
+	c.DeviceID = ""
+	c.DeviceFlag = 0
+	c.ClientTimestamp = 0
+	c.UID = ""
+	c.Token = ""
+}
+
 // GetFrameType 包类型
 func (c ConnectPacket) GetFrameType() FrameType {
 	return CONNECT
@@ -28,55 +38,65 @@ func (c ConnectPacket) String() string {
 }
 
 func decodeConnect(frame Frame, data []byte, version uint8) (Frame, error) {
-	dec := NewDecoder(data)
 	connectPacket := &ConnectPacket{}
-	connectPacket.Framer = frame.(Framer)
+	if err := decodeConnectInto(connectPacket, framerOf(frame), NewDecoder(data), version); err != nil {
+		return nil, err
+	}
+	return connectPacket, nil
+}
+
+// decodeConnectInto 解码到已有的包
+func decodeConnectInto(connectPacket *ConnectPacket, framer Framer, dec *Decoder, version uint8) error {
+	connectPacket.Reset()
+	connectPacket.Framer = framer
 	var err error
 	if connectPacket.Version, err = dec.Uint8(); err != nil {
-		return nil, errors.Wrap(err, "解码version失败！")
+		return newDecodeError(CONNECT, "Version", dec.Offset(), err)
 	}
 	var deviceFlag uint8
 	if deviceFlag, err = dec.Uint8(); err != nil {
-		return nil, errors.Wrap(err, "解码DeviceFlag失败！")
+		return newDecodeError(CONNECT, "DeviceFlag", dec.Offset(), err)
 	}
 	connectPacket.DeviceFlag = DeviceFlag(deviceFlag)
 	if connectPacket.DeviceID, err = dec.String(); err != nil {
-		return nil, errors.Wrap(err, "解码DeviceId失败！")
+		return newDecodeError(CONNECT, "DeviceID", dec.Offset(), err)
 	}
 	if connectPacket.UID, err = dec.String(); err != nil {
-		return nil, errors.Wrap(err, "解码UID失败！")
+		return newDecodeError(CONNECT, "UID", dec.Offset(), err)
 	}
 	if connectPacket.Token, err = dec.String(); err != nil {
-		return nil, errors.Wrap(err, "解码Token失败！")
+		return newDecodeError(CONNECT, "Token", dec.Offset(), err)
 	}
 	if connectPacket.ClientTimestamp, err = dec.Int64(); err != nil {
-		return nil, errors.Wrap(err, "解码ClientTimestamp失败！")
+		return newDecodeError(CONNECT, "ClientTimestamp", dec.Offset(), err)
 	}
 	if connectPacket.ClientKey, err = dec.String(); err != nil {
-		return nil, errors.Wrap(err, "解码ClientKey失败！")
+		return newDecodeError(CONNECT, "ClientKey", dec.Offset(), err)
 	}
-	return connectPacket, err
+	return nil
 }
 
-func encodeConnect(connectPacket *ConnectPacket, enc *Encoder, _ uint8) error {
+func encodeConnect(frame Frame, enc *Encoder, _ uint8) error {
+	connectPacket := frame.(*ConnectPacket)
 	// 协议版本
-	enc.WriteUint8(connectPacket.Version)
+	enc.Field("Version").WriteUint8(connectPacket.Version)
 	// 设备标示
-	enc.WriteUint8(connectPacket.DeviceFlag.ToUint8())
+	enc.Field("DeviceFlag").WriteUint8(connectPacket.DeviceFlag.ToUint8())
 	// DeviceId
-	enc.WriteString(connectPacket.DeviceID)
+	enc.Field("DeviceID").WriteString(connectPacket.DeviceID)
 	// 用户uid
-	enc.WriteString(connectPacket.UID)
+	enc.Field("UID").WriteString(connectPacket.UID)
 	// 用户token
-	enc.WriteString(connectPacket.Token)
+	enc.Field("Token").WriteString(connectPacket.Token)
 	// 客户端时间戳
-	enc.WriteInt64(connectPacket.ClientTimestamp)
+	enc.Field("ClientTimestamp").WriteInt64(connectPacket.ClientTimestamp)
 	// clientKey
-	enc.WriteString(connectPacket.ClientKey)
-	return nil
+	enc.Field("ClientKey").WriteString(connectPacket.ClientKey)
+	return enc.Err()
 }
 
-func encodeConnectSize(connectPacket *ConnectPacket, _ uint8) int {
+func encodeConnectSize(frame Frame, _ uint8) int {
+	connectPacket := frame.(*ConnectPacket)
 	var size = 0
 	size += VersionByteSize
 	size += DeviceFlagByteSize
@@ -0,0 +1,99 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+
+	msproto "github.com/mushanyux/MSIMGoProto"
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidPadding PKCS7填充错误，通常是密钥不一致或者数据被篡改
+var ErrInvalidPadding = errors.New("invalid padding")
+
+// AESCipher 使用协商的密钥对Payload做AES-CBC（PKCS7填充）加密后base64编码，与WuKongIM兼容
+// 实现了msproto.PayloadCipher和msproto.FrameSigner，设置到Codec上后自动加解密Payload并计算、校验MsgKey
+type AESCipher struct {
+	secret *Secret
+	block  cipher.Block
+	iv     []byte
+}
+
+// NewAESCipher 使用协商的密钥创建
+func NewAESCipher(secret *Secret) (*AESCipher, error) {
+	if secret == nil {
+		return nil, errors.New("secret is nil")
+	}
+	if len(secret.IV) != aes.BlockSize {
+		return nil, errors.Wrapf(ErrInvalidSalt, "iv length %d", len(secret.IV))
+	}
+	block, err := aes.NewCipher(secret.Key)
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidKey, err.Error())
+	}
+	return &AESCipher{
+		secret: secret,
+		block:  block,
+		iv:     secret.IV,
+	}, nil
+}
+
+// Encrypt 加密
+func (c *AESCipher) Encrypt(payload []byte) ([]byte, error) {
+	padding := aes.BlockSize - len(payload)%aes.BlockSize
+	data := make([]byte, len(payload)+padding)
+	copy(data, payload)
+	copy(data[len(payload):], bytes.Repeat([]byte{byte(padding)}, padding))
+	cipher.NewCBCEncrypter(c.block, c.iv).CryptBlocks(data, data)
+	out := make([]byte, base64.StdEncoding.EncodedLen(len(data)))
+	base64.StdEncoding.Encode(out, data)
+	return out, nil
+}
+
+// Sign 计算SEND和RECV的MsgKey
+func (c *AESCipher) Sign(frame msproto.Frame, version uint8) error {
+	switch p := frame.(type) {
+	case *msproto.SendPacket:
+		return SignSend(c.secret, p, version)
+	case *msproto.RecvPacket:
+		return SignRecv(c.secret, p, version)
+	}
+	return nil
+}
+
+// Verify 校验SEND和RECV的MsgKey
+func (c *AESCipher) Verify(frame msproto.Frame, version uint8) error {
+	switch p := frame.(type) {
+	case *msproto.SendPacket:
+		return VerifySend(c.secret, p, version)
+	case *msproto.RecvPacket:
+		return VerifyRecv(c.secret, p, version)
+	}
+	return nil
+}
+
+// Decrypt 解密
+func (c *AESCipher) Decrypt(payload []byte) ([]byte, error) {
+	data := make([]byte, base64.StdEncoding.DecodedLen(len(payload)))
+	n, err := base64.StdEncoding.Decode(data, payload)
+	if err != nil {
+		return nil, err
+	}
+	data = data[:n]
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, errors.Errorf("invalid ciphertext length %d", len(data))
+	}
+	cipher.NewCBCDecrypter(c.block, c.iv).CryptBlocks(data, data)
+	padding := int(data[len(data)-1])
+	if padding == 0 || padding > aes.BlockSize || padding > len(data) {
+		return nil, ErrInvalidPadding
+	}
+	for _, b := range data[len(data)-padding:] {
+		if int(b) != padding {
+			return nil, ErrInvalidPadding
+		}
+	}
+	return data[:len(data)-padding], nil
+}
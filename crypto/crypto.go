@@ -0,0 +1,168 @@
+// Package crypto CONNECT/CONNACK中ClientKey、ServerKey、Salt的密钥交换
+//
+// 与WuKongIM兼容：双方通过X25519得到共享密钥shared，
+// AES密钥为 hex(MD5(base64(shared))) 的前16个字符，IV为CONNACK中的Salt（16个字符），
+// ClientKey和ServerKey为32字节公钥的标准base64编码。
+//
+// 测试向量（私钥为32字节，十六进制表示）：
+//
+//	client private: 0101010101010101010101010101010101010101010101010101010101010101
+//	server private: 0202020202020202020202020202020202020202020202020202020202020202
+//	client key:     pOCSkrZRwni5dyxWn1+puxPZBrRqtoyd+dwrRAn4ogk=
+//	server key:     zo060cy2M+x7cMF4FKXHbs0CloUFDTRHRboFhw5YfVk=
+//	salt:           abcdefghijklmnop
+//	aes key:        03bfeb655145e421
+//	aes iv:         abcdefghijklmnop
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/ecdh"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"math/big"
+
+	msproto "github.com/mushanyux/MSIMGoProto"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrClientKeyIsEmpty CONNECT中没有ClientKey
+	ErrClientKeyIsEmpty = errors.New("client key is empty")
+	// ErrInvalidKey 公钥或私钥格式错误
+	ErrInvalidKey = errors.New("invalid key")
+	// ErrInvalidSalt Salt长度不足
+	ErrInvalidSalt = errors.New("invalid salt")
+)
+
+// SaltSize Salt的长度，同时也是IV的长度
+const SaltSize = aes.BlockSize
+
+// KeyPair X25519密钥对
+type KeyPair struct {
+	privateKey *ecdh.PrivateKey
+}
+
+// GenerateKeyPair 生成随机密钥对
+func GenerateKeyPair() (*KeyPair, error) {
+	privateKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyPair{privateKey: privateKey}, nil
+}
+
+// NewKeyPair 通过32字节私钥创建密钥对
+func NewKeyPair(privateKey []byte) (*KeyPair, error) {
+	key, err := ecdh.X25519().NewPrivateKey(privateKey)
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidKey, err.Error())
+	}
+	return &KeyPair{privateKey: key}, nil
+}
+
+// PrivateKey 32字节私钥
+func (k *KeyPair) PrivateKey() []byte {
+	return k.privateKey.Bytes()
+}
+
+// PublicKey base64编码的公钥，用于ClientKey或ServerKey
+func (k *KeyPair) PublicKey() string {
+	return base64.StdEncoding.EncodeToString(k.privateKey.PublicKey().Bytes())
+}
+
+// SharedSecret 与对方base64编码的公钥计算共享密钥
+func (k *KeyPair) SharedSecret(peerPublicKey string) ([]byte, error) {
+	keyBytes, err := base64.StdEncoding.DecodeString(peerPublicKey)
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidKey, err.Error())
+	}
+	peerKey, err := ecdh.X25519().NewPublicKey(keyBytes)
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidKey, err.Error())
+	}
+	shared, err := k.privateKey.ECDH(peerKey)
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidKey, err.Error())
+	}
+	return shared, nil
+}
+
+// Secret 协商得到的AES密钥和IV
+type Secret struct {
+	Key []byte // AES-128密钥
+	IV  []byte // CBC模式的IV
+}
+
+// DeriveSecret 由共享密钥和Salt得到AES密钥和IV
+func DeriveSecret(shared []byte, salt string) (*Secret, error) {
+	if len(salt) < SaltSize {
+		return nil, errors.Wrapf(ErrInvalidSalt, "salt length %d", len(salt))
+	}
+	sum := md5.Sum([]byte(base64.StdEncoding.EncodeToString(shared)))
+	return &Secret{
+		Key: []byte(hex.EncodeToString(sum[:])[:16]),
+		IV:  []byte(salt[:SaltSize]),
+	}, nil
+}
+
+// ServerExchange 服务端收到CONNECT后生成服务端密钥对和Salt，写入connack的ServerKey和Salt，并返回协商的密钥
+// ClientKey为空时connack的ReasonCode被设置为ReasonClientKeyIsEmpty并返回ErrClientKeyIsEmpty
+func ServerExchange(connect *msproto.ConnectPacket, connack *msproto.ConnackPacket) (*Secret, error) {
+	if connect == nil || connack == nil {
+		return nil, msproto.ErrNilFrame
+	}
+	if connect.ClientKey == "" {
+		connack.ReasonCode = msproto.ReasonClientKeyIsEmpty
+		return nil, ErrClientKeyIsEmpty
+	}
+	serverKey, err := GenerateKeyPair()
+	if err != nil {
+		return nil, err
+	}
+	salt, err := RandomSalt()
+	if err != nil {
+		return nil, err
+	}
+	secret, err := exchange(serverKey, connect.ClientKey, salt)
+	if err != nil {
+		return nil, err
+	}
+	connack.ServerKey = serverKey.PublicKey()
+	connack.Salt = salt
+	return secret, nil
+}
+
+// ClientSecret 客户端收到CONNACK后，用CONNECT中ClientKey对应的密钥对计算协商的密钥
+func ClientSecret(clientKey *KeyPair, connack *msproto.ConnackPacket) (*Secret, error) {
+	if connack == nil {
+		return nil, msproto.ErrNilFrame
+	}
+	return exchange(clientKey, connack.ServerKey, connack.Salt)
+}
+
+func exchange(keyPair *KeyPair, peerPublicKey string, salt string) (*Secret, error) {
+	shared, err := keyPair.SharedSecret(peerPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return DeriveSecret(shared, salt)
+}
+
+const saltLetters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// RandomSalt 生成16个字符的随机Salt
+func RandomSalt() (string, error) {
+	b := make([]byte, SaltSize)
+	max := big.NewInt(int64(len(saltLetters)))
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = saltLetters[n.Int64()]
+	}
+	return string(b), nil
+}
@@ -0,0 +1,231 @@
+package crypto_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	msproto "github.com/mushanyux/MSIMGoProto"
+	"github.com/mushanyux/MSIMGoProto/crypto"
+)
+
+// 包文档中的测试向量
+const (
+	vectorClientKey = "pOCSkrZRwni5dyxWn1+puxPZBrRqtoyd+dwrRAn4ogk="
+	vectorServerKey = "zo060cy2M+x7cMF4FKXHbs0CloUFDTRHRboFhw5YfVk="
+	vectorSalt      = "abcdefghijklmnop"
+	vectorAESKey    = "03bfeb655145e421"
+)
+
+func vectorKeyPairs(t *testing.T) (client, server *crypto.KeyPair) {
+	t.Helper()
+	client, err := crypto.NewKeyPair(bytes.Repeat([]byte{0x01}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err = crypto.NewKeyPair(bytes.Repeat([]byte{0x02}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, server
+}
+
+func vectorSecret(t *testing.T) *crypto.Secret {
+	t.Helper()
+	client, server := vectorKeyPairs(t)
+	secret, err := crypto.ClientSecret(client, &msproto.ConnackPacket{ServerKey: server.PublicKey(), Salt: vectorSalt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return secret
+}
+
+func TestKeyExchangeVector(t *testing.T) {
+	client, server := vectorKeyPairs(t)
+	if got := client.PublicKey(); got != vectorClientKey {
+		t.Errorf("client key = %s, want %s", got, vectorClientKey)
+	}
+	if got := server.PublicKey(); got != vectorServerKey {
+		t.Errorf("server key = %s, want %s", got, vectorServerKey)
+	}
+
+	clientShared, err := client.SharedSecret(vectorServerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverShared, err := server.SharedSecret(vectorClientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(clientShared, serverShared) {
+		t.Fatal("client and server derived different shared secrets")
+	}
+	secret, err := crypto.DeriveSecret(serverShared, vectorSalt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(secret.Key) != vectorAESKey || string(secret.IV) != vectorSalt {
+		t.Errorf("aes key/iv = %s/%s, want %s/%s", secret.Key, secret.IV, vectorAESKey, vectorSalt)
+	}
+	if got := vectorSecret(t); string(got.Key) != vectorAESKey {
+		t.Errorf("ClientSecret key = %s, want %s", got.Key, vectorAESKey)
+	}
+}
+
+func TestServerExchange(t *testing.T) {
+	client, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	connack := &msproto.ConnackPacket{}
+	serverSecret, err := crypto.ServerExchange(&msproto.ConnectPacket{ClientKey: client.PublicKey()}, connack)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(connack.Salt) != crypto.SaltSize || connack.ServerKey == "" {
+		t.Fatalf("connack salt/server key = %q/%q", connack.Salt, connack.ServerKey)
+	}
+	clientSecret, err := crypto.ClientSecret(client, connack)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(clientSecret.Key, serverSecret.Key) || !bytes.Equal(clientSecret.IV, serverSecret.IV) {
+		t.Fatal("client and server secrets differ")
+	}
+
+	connack = &msproto.ConnackPacket{}
+	if _, err = crypto.ServerExchange(&msproto.ConnectPacket{}, connack); !errors.Is(err, crypto.ErrClientKeyIsEmpty) {
+		t.Fatalf("err = %v, want ErrClientKeyIsEmpty", err)
+	}
+	if connack.ReasonCode != msproto.ReasonClientKeyIsEmpty {
+		t.Errorf("ReasonCode = %s, want %s", connack.ReasonCode, msproto.ReasonClientKeyIsEmpty)
+	}
+}
+
+func TestInvalidKeys(t *testing.T) {
+	if _, err := crypto.NewKeyPair(make([]byte, 31)); !errors.Is(err, crypto.ErrInvalidKey) {
+		t.Errorf("NewKeyPair(31 bytes) = %v, want ErrInvalidKey", err)
+	}
+	client, _ := vectorKeyPairs(t)
+	for _, key := range []string{"not base64!", base64.StdEncoding.EncodeToString(make([]byte, 16))} {
+		if _, err := client.SharedSecret(key); !errors.Is(err, crypto.ErrInvalidKey) {
+			t.Errorf("SharedSecret(%q) = %v, want ErrInvalidKey", key, err)
+		}
+	}
+	if _, err := crypto.DeriveSecret(make([]byte, 32), "short"); !errors.Is(err, crypto.ErrInvalidSalt) {
+		t.Errorf("DeriveSecret(short salt) = %v, want ErrInvalidSalt", err)
+	}
+}
+
+func TestAESCipherVector(t *testing.T) {
+	c, err := crypto.NewAESCipher(vectorSecret(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := c.Encrypt([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Piu1u4MjVOWRcCeNZz5tRg=="; string(encrypted) != want {
+		t.Errorf("Encrypt(hello) = %s, want %s", encrypted, want)
+	}
+
+	// 每个长度都能还原，包括正好是整块的长度
+	for n := 0; n <= 2*aes.BlockSize+1; n++ {
+		payload := bytes.Repeat([]byte{'x'}, n)
+		encrypted, err = c.Encrypt(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decrypted, err := c.Decrypt(encrypted)
+		if err != nil || !bytes.Equal(decrypted, payload) {
+			t.Fatalf("round trip of %d bytes = %q, %v", n, decrypted, err)
+		}
+	}
+}
+
+func TestAESCipherDecryptInvalid(t *testing.T) {
+	secret := vectorSecret(t)
+	c, err := crypto.NewAESCipher(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 不经过Encrypt，直接加密填充错误的明文
+	encryptRaw := func(plain []byte) []byte {
+		block, err := aes.NewCipher(secret.Key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := append([]byte(nil), plain...)
+		cipher.NewCBCEncrypter(block, secret.IV).CryptBlocks(data, data)
+		return []byte(base64.StdEncoding.EncodeToString(data))
+	}
+	padded := func(tail ...byte) []byte {
+		return append(bytes.Repeat([]byte{'x'}, aes.BlockSize-len(tail)), tail...)
+	}
+
+	for name, payload := range map[string][]byte{
+		"zero padding":         encryptRaw(padded(0x00)),
+		"padding too large":    encryptRaw(padded(0x11)),
+		"inconsistent padding": encryptRaw(padded(0x03, 0x02)),
+	} {
+		if _, err := c.Decrypt(payload); !errors.Is(err, crypto.ErrInvalidPadding) {
+			t.Errorf("%s: err = %v, want ErrInvalidPadding", name, err)
+		}
+	}
+	for name, payload := range map[string][]byte{
+		"not base64":    []byte("not base64!"),
+		"empty":         {},
+		"partial block": []byte(base64.StdEncoding.EncodeToString(make([]byte, 10))),
+	} {
+		if _, err := c.Decrypt(payload); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+func TestMsgKeyVector(t *testing.T) {
+	secret := vectorSecret(t)
+	tests := []struct {
+		version uint8
+		want    string
+	}{
+		// hex(MD5(base64(AES(data))))
+		{5, "668e175e6e9ddbbf59d329a1548dcbd2"},
+		// hex(HMAC-SHA256(AES密钥, data))
+		{crypto.HMACVersion, "a4ae926647b38c19c52b635ab2135a33b12ab5e0cb06bc4d8a72ac5aae6f9888"},
+	}
+	for _, tt := range tests {
+		got, err := crypto.MsgKey(secret, []byte("hello"), tt.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("MsgKey(v%d) = %s, want %s", tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestSignSend(t *testing.T) {
+	secret := vectorSecret(t)
+	for version, other := range map[uint8]uint8{5: crypto.HMACVersion, crypto.HMACVersion: 5} {
+		p := &msproto.SendPacket{ClientSeq: 1, ClientMsgNo: "m1", ChannelID: "u2", ChannelType: msproto.ChannelTypePerson, Payload: []byte("hi")}
+		if err := crypto.SignSend(secret, p, version); err != nil {
+			t.Fatal(err)
+		}
+		if err := crypto.VerifySend(secret, p, version); err != nil {
+			t.Fatalf("v%d: %v", version, err)
+		}
+		// 使用另一个版本的算法校验失败
+		if err := crypto.VerifySend(secret, p, other); !errors.Is(err, crypto.ErrMsgKeyMismatch) {
+			t.Errorf("v%d verified as v%d: %v", version, other, err)
+		}
+		p.ChannelID = "u3"
+		if err := crypto.VerifySend(secret, p, version); !errors.Is(err, crypto.ErrMsgKeyMismatch) {
+			t.Errorf("v%d: tampered SEND err = %v, want ErrMsgKeyMismatch", version, err)
+		}
+	}
+}
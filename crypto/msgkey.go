@@ -0,0 +1,94 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+
+	msproto "github.com/mushanyux/MSIMGoProto"
+	"github.com/pkg/errors"
+)
+
+// HMACVersion 从此协议版本开始MsgKey使用HMAC-SHA256
+const HMACVersion uint8 = 6
+
+// ErrMsgKeyMismatch MsgKey与内容不匹配，消息可能被篡改
+var ErrMsgKeyMismatch = errors.New("msg key mismatch")
+
+// MsgKey 计算data的MsgKey
+// 协议版本低于HMACVersion时与WuKongIM兼容：hex(MD5(base64(AES(data))))；
+// 否则为 hex(HMAC-SHA256(AES密钥, data))
+func MsgKey(secret *Secret, data []byte, version uint8) (string, error) {
+	if secret == nil {
+		return "", errors.New("secret is nil")
+	}
+	if version >= HMACVersion {
+		mac := hmac.New(sha256.New, secret.Key)
+		mac.Write(data)
+		return hex.EncodeToString(mac.Sum(nil)), nil
+	}
+	c, err := NewAESCipher(secret)
+	if err != nil {
+		return "", err
+	}
+	encrypted, err := c.Encrypt(data)
+	if err != nil {
+		return "", err
+	}
+	sum := md5.Sum(encrypted)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// SignSend 计算SEND的MsgKey，需要在加密Payload之后调用
+func SignSend(secret *Secret, p *msproto.SendPacket, version uint8) error {
+	if p == nil {
+		return msproto.ErrNilFrame
+	}
+	msgKey, err := MsgKey(secret, []byte(p.VerityString()), version)
+	if err != nil {
+		return err
+	}
+	p.MsgKey = msgKey
+	return nil
+}
+
+// VerifySend 校验SEND的MsgKey，需要在解密Payload之前调用
+func VerifySend(secret *Secret, p *msproto.SendPacket, version uint8) error {
+	if p == nil {
+		return msproto.ErrNilFrame
+	}
+	return verify(secret, []byte(p.VerityString()), p.MsgKey, version)
+}
+
+// SignRecv 计算RECV的MsgKey，需要在加密Payload之后调用
+func SignRecv(secret *Secret, p *msproto.RecvPacket, version uint8) error {
+	if p == nil {
+		return msproto.ErrNilFrame
+	}
+	msgKey, err := MsgKey(secret, []byte(p.VerityString()), version)
+	if err != nil {
+		return err
+	}
+	p.MsgKey = msgKey
+	return nil
+}
+
+// VerifyRecv 校验RECV的MsgKey，需要在解密Payload之前调用
+func VerifyRecv(secret *Secret, p *msproto.RecvPacket, version uint8) error {
+	if p == nil {
+		return msproto.ErrNilFrame
+	}
+	return verify(secret, []byte(p.VerityString()), p.MsgKey, version)
+}
+
+func verify(secret *Secret, data []byte, msgKey string, version uint8) error {
+	expect, err := MsgKey(secret, data, version)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal([]byte(expect), []byte(msgKey)) {
+		return ErrMsgKeyMismatch
+	}
+	return nil
+}
@@ -1,11 +1,21 @@
 package msproto
 
-import "fmt"
+import (
+	"fmt"
+	"io"
+	"unsafe"
+)
+
+// errShortRead 包体长度不足，可以通过errors.Is(err, io.ErrUnexpectedEOF)判断
+func errShortRead(expect, length int) error {
+	return fmt.Errorf("Decoder couldn't read expect bytes %d of %d: %w", expect, length, io.ErrUnexpectedEOF)
+}
 
 // Decoder 解码
 type Decoder struct {
-	p      []byte
-	offset int
+	p        []byte
+	offset   int
+	zeroCopy bool // 解码出的字符串直接引用p，不复制
 }
 
 // NewDecoder NewDecoder
@@ -20,10 +30,15 @@ func (d *Decoder) Len() int {
 	return len(d.p) - d.offset
 }
 
+// Offset 已读取的字节数
+func (d *Decoder) Offset() int {
+	return d.offset
+}
+
 // Uint8 Uint8
 func (d *Decoder) Uint8() (uint8, error) {
 	if d.offset+1 > len(d.p) {
-		return 0, fmt.Errorf("Decoder couldn't read expect bytes %d of %d", d.offset+1, len(d.p))
+		return 0, errShortRead(d.offset+1, len(d.p))
 	}
 	b := d.p[d.offset]
 	d.offset += 1
@@ -33,7 +48,7 @@ func (d *Decoder) Uint8() (uint8, error) {
 // Int16 Int16
 func (d *Decoder) Int16() (int16, error) {
 	if d.offset+2 > len(d.p) {
-		return 0, fmt.Errorf("Decoder couldn't read expect bytes %d of %d", d.offset+2, len(d.p))
+		return 0, errShortRead(d.offset+2, len(d.p))
 	}
 	b := d.p[d.offset : d.offset+2]
 	d.offset += 2
@@ -51,8 +66,11 @@ func (d *Decoder) Uint16() (uint16, error) {
 
 // Bytes Bytes
 func (d *Decoder) Bytes(num int) ([]byte, error) {
+	if num < 0 {
+		return nil, fmt.Errorf("num is less than 0, num: %d", num)
+	}
 	if d.offset+num > len(d.p) {
-		return nil, fmt.Errorf("Decoder couldn't read expect bytes %d of %d", d.offset+num, len(d.p))
+		return nil, errShortRead(d.offset+num, len(d.p))
 	}
 	b := d.p[d.offset : d.offset+num]
 	d.offset += num
@@ -63,7 +81,7 @@ func (d *Decoder) Bytes(num int) ([]byte, error) {
 // Int64 Int64
 func (d *Decoder) Int64() (int64, error) {
 	if d.offset+8 > len(d.p) {
-		return 0, fmt.Errorf("Decoder couldn't read expect bytes %d of %d", d.offset+8, len(d.p))
+		return 0, errShortRead(d.offset+8, len(d.p))
 	}
 	b := d.p[d.offset : d.offset+8]
 	d.offset += 8
@@ -73,7 +91,7 @@ func (d *Decoder) Int64() (int64, error) {
 // Uint64 Uint64
 func (d *Decoder) Uint64() (uint64, error) {
 	if d.offset+8 > len(d.p) {
-		return 0, fmt.Errorf("Decoder couldn't read expect bytes %d of %d", d.offset+8, len(d.p))
+		return 0, errShortRead(d.offset+8, len(d.p))
 	}
 	b := d.p[d.offset : d.offset+8]
 	d.offset += 8
@@ -83,7 +101,7 @@ func (d *Decoder) Uint64() (uint64, error) {
 // Int32 Int32
 func (d *Decoder) Int32() (int32, error) {
 	if d.offset+4 > len(d.p) {
-		return 0, fmt.Errorf("Decoder couldn't read expect bytes %d of %d", d.offset+4, len(d.p))
+		return 0, errShortRead(d.offset+4, len(d.p))
 	}
 	b := d.p[d.offset : d.offset+4]
 	d.offset += 4
@@ -102,6 +120,8 @@ func (d *Decoder) Uint32() (uint32, error) {
 func (d *Decoder) String() (string, error) {
 	if buf, err := d.Binary(); err != nil {
 		return "", err
+	} else if d.zeroCopy && len(buf) > 0 {
+		return unsafe.String(&buf[0], len(buf)), nil
 	} else {
 		return string(buf), nil
 	}
@@ -116,18 +136,21 @@ func (d *Decoder) StringAll() (string, error) {
 	}
 }
 
-// Binary Binary
+// Binary Binary 读取失败时不移动偏移，Offset仍然是字段的开始位置
 func (d *Decoder) Binary() ([]byte, error) {
+	start := d.offset
 	size, err := d.Int16()
 	if err != nil {
 		return nil, err
 	}
 	if size < 0 {
+		d.offset = start
 		return nil, fmt.Errorf("size is less than 0, size: %d", size)
 
 	}
 	if d.offset+int(size) > len(d.p) {
-		return nil, fmt.Errorf("Decoder couldn't read expect bytes %d of %d", d.offset+int(size), len(d.p))
+		d.offset = start
+		return nil, errShortRead(start+StringFixLenByteSize+int(size), len(d.p))
 	}
 	b := d.p[d.offset : d.offset+int(size)]
 	d.offset += int(size)
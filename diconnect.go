@@ -2,8 +2,6 @@ package msproto
 
 import (
 	"fmt"
-
-	"github.com/pkg/errors"
 )
 
 // DisconnectPacket 断开连接数据包
@@ -13,6 +11,13 @@ type DisconnectPacket struct {
 	Reason     string     // 断开原因
 }
 
+// Reset 重置包，用于复用
+func (c *DisconnectPacket) Reset() {
+	c.Framer = Framer{}
+	c.ReasonCode = 0
+	c.Reason = ""
+}
+
 // GetFrameType 包类型
 func (c DisconnectPacket) GetFrameType() FrameType {
 	return DISCONNECT
@@ -23,30 +28,40 @@ func (c DisconnectPacket) String() string {
 }
 
 func decodeDisConnect(frame Frame, data []byte, version uint8) (Frame, error) {
-	dec := NewDecoder(data)
 	disConnectPacket := &DisconnectPacket{}
-	disConnectPacket.Framer = frame.(Framer)
+	if err := decodeDisConnectInto(disConnectPacket, framerOf(frame), NewDecoder(data), version); err != nil {
+		return nil, err
+	}
+	return disConnectPacket, nil
+}
+
+// decodeDisConnectInto 解码到已有的包
+func decodeDisConnectInto(disConnectPacket *DisconnectPacket, framer Framer, dec *Decoder, version uint8) error {
+	disConnectPacket.Reset()
+	disConnectPacket.Framer = framer
 	var err error
 	var reasonCode uint8
 	if reasonCode, err = dec.Uint8(); err != nil {
-		return nil, errors.Wrap(err, "解码reasonCode失败！")
+		return newDecodeError(DISCONNECT, "ReasonCode", dec.Offset(), err)
 	}
 	disConnectPacket.ReasonCode = ReasonCode(reasonCode)
 	if disConnectPacket.Reason, err = dec.String(); err != nil {
-		return nil, errors.Wrap(err, "解码reason失败！")
+		return newDecodeError(DISCONNECT, "Reason", dec.Offset(), err)
 	}
-	return disConnectPacket, err
+	return nil
 }
 
-func encodeDisConnect(disConnectPacket *DisconnectPacket, enc *Encoder, _ uint8) error {
+func encodeDisConnect(frame Frame, enc *Encoder, _ uint8) error {
+	disConnectPacket := frame.(*DisconnectPacket)
 	// 原因代码
-	enc.WriteUint8(disConnectPacket.ReasonCode.Byte())
+	enc.Field("ReasonCode").WriteUint8(disConnectPacket.ReasonCode.Byte())
 	// 原因
-	enc.WriteString(disConnectPacket.Reason)
-	return nil
+	enc.Field("Reason").WriteString(disConnectPacket.Reason)
+	return enc.Err()
 }
 
-func encodeDisConnectSize(packet *DisconnectPacket, _ uint8) int {
+func encodeDisConnectSize(frame Frame, _ uint8) int {
+	packet := frame.(*DisconnectPacket)
 
 	return ReasonCodeByteSize + len(packet.Reason) + StringFixLenByteSize
 }
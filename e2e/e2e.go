@@ -0,0 +1,241 @@
+// Package e2e SettingSignal的端到端加密，X3DH建立会话，双棘轮加密每条消息
+//
+// 接收方预先生成身份密钥、签名的预共享密钥和一次性预共享密钥，通过业务服务发布PreKeyBundle；
+// 发起方取得对方的PreKeyBundle后调用ProcessBundle建立会话，
+// 之后设置了SettingSignal的SEND由EncryptSend加密Payload，收到的RECV由DecryptRecv解密。
+// 发起方在收到对方的消息之前，每条消息都携带X3DH信息，接收方收到后自动建立会话。
+//
+// 端到端加密只支持个人频道，对方为SEND的ChannelID或者RECV的FromUID。
+// 端到端加密在传输层的Payload加密之前进行，两者互不影响。
+package e2e
+
+import (
+	"bytes"
+	"sync"
+
+	msproto "github.com/mushanyux/MSIMGoProto"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrNotFound KeyStore中没有对应的密钥或会话
+	ErrNotFound = errors.New("not found")
+	// ErrNoSession 与对方还没有可用于发送的会话
+	ErrNoSession = errors.New("no session")
+	// ErrInvalidKey 公钥或私钥格式错误
+	ErrInvalidKey = errors.New("invalid key")
+	// ErrInvalidBundle PreKeyBundle格式错误或签名校验失败
+	ErrInvalidBundle = errors.New("invalid pre key bundle")
+	// ErrInvalidMessage 消息格式错误
+	ErrInvalidMessage = errors.New("invalid message")
+	// ErrDecrypt 解密失败，密钥不一致或者消息被篡改
+	ErrDecrypt = errors.New("decrypt failed")
+	// ErrReplayedPreKey X3DH临时公钥已经用于建立过会话，PreKey消息被重放
+	ErrReplayedPreKey = errors.New("replayed pre key message")
+	// ErrTooManySkipped 跳过的消息过多
+	ErrTooManySkipped = errors.New("too many skipped messages")
+	// ErrUnsupportedChannel 端到端加密只支持个人频道
+	ErrUnsupportedChannel = errors.New("unsupported channel type")
+)
+
+// Manager 管理与各个用户的端到端加密会话，可以并发调用
+type Manager struct {
+	store KeyStore
+	mu    sync.Mutex // 会话的读取、更新、保存需要作为一个整体
+}
+
+// NewManager 创建会话管理
+func NewManager(store KeyStore) *Manager {
+	return &Manager{
+		store: store,
+	}
+}
+
+// Store 密钥存储
+func (m *Manager) Store() KeyStore {
+	return m.store
+}
+
+// ProcessBundle 通过对方的PreKeyBundle建立会话，已有的会话会被替换
+func (m *Manager) ProcessBundle(peer string, bundle *PreKeyBundle) error {
+	identity, err := m.store.IdentityKey()
+	if err != nil {
+		return err
+	}
+	identityPublic, err := identity.PublicKey()
+	if err != nil {
+		return err
+	}
+	shared, baseKey, err := x3dhInitiator(identity, bundle)
+	if err != nil {
+		return err
+	}
+	state, err := newInitiatorState(shared, bundle.SignedPreKey)
+	if err != nil {
+		return err
+	}
+	state.RemoteIdentity = append([]byte{}, bundle.IdentityKey...)
+	state.AssociatedData = append(append([]byte{}, identityPublic...), bundle.IdentityKey...)
+	state.BaseKey = baseKey
+	state.PreKey = &PreKeyHeader{
+		IdentityKey:     identityPublic,
+		BaseKey:         baseKey,
+		SignedPreKeyID:  bundle.SignedPreKeyID,
+		OneTimePreKeyID: bundle.OneTimePreKeyID,
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.store.StoreSession(peer, state)
+}
+
+// HasSession 是否已有与peer的会话
+func (m *Manager) HasSession(peer string) (bool, error) {
+	_, err := m.store.Session(peer)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Encrypt 加密发送给peer的数据
+func (m *Manager) Encrypt(peer string, plaintext []byte) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	state, err := m.store.Session(peer)
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrNoSession
+	}
+	if err != nil {
+		return nil, err
+	}
+	state = state.clone()
+	data, err := state.encrypt(plaintext)
+	if err != nil {
+		return nil, err
+	}
+	if err = m.store.StoreSession(peer, state); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Decrypt 解密peer发来的数据，携带X3DH信息的消息会建立新的会话
+// 临时公钥已经建立过会话的X3DH信息以ErrReplayedPreKey拒绝，旧的PreKey消息不能覆盖当前会话
+// 解密失败时会话不变
+func (m *Manager) Decrypt(peer string, data []byte) ([]byte, error) {
+	msg, err := parseMessage(data)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	state, err := m.store.Session(peer)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	established := msg.preKey != nil && (state == nil || !bytes.Equal(state.BaseKey, msg.preKey.BaseKey))
+	if established {
+		used, err := m.store.BaseKeyUsed(msg.preKey.BaseKey)
+		if err != nil {
+			return nil, err
+		}
+		if used {
+			return nil, ErrReplayedPreKey
+		}
+		if state, err = m.respond(msg.preKey); err != nil {
+			return nil, err
+		}
+	} else if state == nil {
+		return nil, ErrNoSession
+	} else {
+		state = state.clone()
+	}
+
+	plaintext, err := state.decrypt(msg)
+	if err != nil {
+		return nil, err
+	}
+	if msg.preKey == nil {
+		// 收到了对方的消息，说明对方已建立会话，不再需要携带X3DH信息
+		state.PreKey = nil
+	}
+	if err = m.store.StoreSession(peer, state); err != nil {
+		return nil, err
+	}
+	if established {
+		if err = m.store.MarkBaseKeyUsed(msg.preKey.BaseKey); err != nil {
+			return nil, err
+		}
+	}
+	if msg.preKey != nil && msg.preKey.OneTimePreKeyID != 0 {
+		if err = m.store.RemoveOneTimePreKey(msg.preKey.OneTimePreKeyID); err != nil {
+			return nil, err
+		}
+	}
+	return plaintext, nil
+}
+
+// respond 作为接收方通过X3DH信息建立会话
+func (m *Manager) respond(preKey *PreKeyHeader) (*SessionState, error) {
+	identity, err := m.store.IdentityKey()
+	if err != nil {
+		return nil, err
+	}
+	identityPublic, err := identity.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	signedPreKey, err := m.store.SignedPreKey(preKey.SignedPreKeyID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "signed pre key %d", preKey.SignedPreKeyID)
+	}
+	var oneTimePreKey *OneTimePreKey
+	if preKey.OneTimePreKeyID != 0 {
+		if oneTimePreKey, err = m.store.OneTimePreKey(preKey.OneTimePreKeyID); err != nil {
+			return nil, errors.Wrapf(err, "one-time pre key %d", preKey.OneTimePreKeyID)
+		}
+	}
+	shared, err := x3dhResponder(identity, signedPreKey, oneTimePreKey, preKey.IdentityKey, preKey.BaseKey)
+	if err != nil {
+		return nil, err
+	}
+	state := newResponderState(shared, signedPreKey.Private)
+	state.RemoteIdentity = append([]byte{}, preKey.IdentityKey...)
+	state.AssociatedData = append(append([]byte{}, preKey.IdentityKey...), identityPublic...)
+	state.BaseKey = append([]byte{}, preKey.BaseKey...)
+	return state, nil
+}
+
+// EncryptSend SEND设置了SettingSignal时加密Payload
+func (m *Manager) EncryptSend(p *msproto.SendPacket) error {
+	if !p.Setting.IsSet(msproto.SettingSignal) {
+		return nil
+	}
+	if p.ChannelType != msproto.ChannelTypePerson {
+		return errors.Wrapf(ErrUnsupportedChannel, "channel type %d", p.ChannelType)
+	}
+	payload, err := m.Encrypt(p.ChannelID, p.Payload)
+	if err != nil {
+		return err
+	}
+	p.Payload = payload
+	return nil
+}
+
+// DecryptRecv RECV设置了SettingSignal时解密Payload
+func (m *Manager) DecryptRecv(p *msproto.RecvPacket) error {
+	if !p.Setting.IsSet(msproto.SettingSignal) {
+		return nil
+	}
+	if p.ChannelType != msproto.ChannelTypePerson {
+		return errors.Wrapf(ErrUnsupportedChannel, "channel type %d", p.ChannelType)
+	}
+	payload, err := m.Decrypt(p.FromUID, p.Payload)
+	if err != nil {
+		return err
+	}
+	p.Payload = payload
+	return nil
+}
@@ -0,0 +1,156 @@
+package e2e_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mushanyux/MSIMGoProto/e2e"
+)
+
+type peer struct {
+	store   *e2e.MemoryStore
+	manager *e2e.Manager
+}
+
+func newPeer(t *testing.T) *peer {
+	t.Helper()
+	store, err := e2e.NewMemoryStore(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &peer{store: store, manager: e2e.NewManager(store)}
+}
+
+// bundleWithoutOneTimePreKey 只包含预共享密钥的公钥集合，X3DH可以被重复计算
+func (p *peer) bundleWithoutOneTimePreKey(t *testing.T) *e2e.PreKeyBundle {
+	t.Helper()
+	identity, _ := p.store.IdentityKey()
+	signedPreKey, err := e2e.GenerateSignedPreKey(identity, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.store.AddSignedPreKey(signedPreKey)
+	bundle, err := e2e.NewPreKeyBundle(identity, signedPreKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bundle
+}
+
+func encrypt(t *testing.T, p *peer, to, plaintext string) []byte {
+	t.Helper()
+	data, err := p.manager.Encrypt(to, []byte(plaintext))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func decrypt(t *testing.T, p *peer, from string, data []byte, want string) {
+	t.Helper()
+	plaintext, err := p.manager.Decrypt(from, data)
+	if err != nil {
+		t.Fatalf("decrypt %q: %v", want, err)
+	}
+	if string(plaintext) != want {
+		t.Fatalf("decrypted %q, want %q", plaintext, want)
+	}
+}
+
+func TestSession(t *testing.T) {
+	alice, bob := newPeer(t), newPeer(t)
+	if _, err := alice.manager.Encrypt("bob", []byte("x")); !errors.Is(err, e2e.ErrNoSession) {
+		t.Fatalf("err = %v, want ErrNoSession", err)
+	}
+	bundle, err := bob.store.NewBundle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = alice.manager.ProcessBundle("bob", bundle); err != nil {
+		t.Fatal(err)
+	}
+
+	m1 := encrypt(t, alice, "bob", "one")
+	m2 := encrypt(t, alice, "bob", "two")
+	// 乱序到达的PreKey消息属于同一个会话
+	decrypt(t, bob, "alice", m2, "two")
+	decrypt(t, bob, "alice", m1, "one")
+	if _, err = bob.store.OneTimePreKey(bundle.OneTimePreKeyID); !errors.Is(err, e2e.ErrNotFound) {
+		t.Errorf("one-time pre key not removed: %v", err)
+	}
+	if _, err = bob.manager.Decrypt("alice", m1); err == nil {
+		t.Error("decrypted a message twice")
+	}
+
+	reply := encrypt(t, bob, "alice", "reply")
+	tampered := append([]byte(nil), reply...)
+	tampered[len(tampered)-1] ^= 1
+	if _, err = alice.manager.Decrypt("bob", tampered); !errors.Is(err, e2e.ErrDecrypt) {
+		t.Fatalf("tampered message err = %v, want ErrDecrypt", err)
+	}
+	decrypt(t, alice, "bob", reply, "reply")
+	decrypt(t, bob, "alice", encrypt(t, alice, "bob", "three"), "three")
+}
+
+func TestReplayedPreKeyMessage(t *testing.T) {
+	alice, bob := newPeer(t), newPeer(t)
+	bundle := bob.bundleWithoutOneTimePreKey(t)
+
+	if err := alice.manager.ProcessBundle("bob", bundle); err != nil {
+		t.Fatal(err)
+	}
+	old := encrypt(t, alice, "bob", "old session")
+	decrypt(t, bob, "alice", old, "old session")
+
+	// alice重新建立会话，bob切换到新的会话
+	if err := alice.manager.ProcessBundle("bob", bundle); err != nil {
+		t.Fatal(err)
+	}
+	decrypt(t, bob, "alice", encrypt(t, alice, "bob", "new session"), "new session")
+
+	// 没有一次性预共享密钥时旧的PreKey消息仍然可以计算出旧会话，需要按临时公钥拒绝
+	if _, err := bob.manager.Decrypt("alice", old); !errors.Is(err, e2e.ErrReplayedPreKey) {
+		t.Fatalf("replayed pre key message err = %v, want ErrReplayedPreKey", err)
+	}
+	// 当前会话没有被覆盖
+	decrypt(t, bob, "alice", encrypt(t, alice, "bob", "still new"), "still new")
+	decrypt(t, alice, "bob", encrypt(t, bob, "alice", "reply"), "reply")
+}
+
+func TestSkippedKeysLimit(t *testing.T) {
+	alice, bob := newPeer(t), newPeer(t)
+	bundle, err := bob.store.NewBundle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = alice.manager.ProcessBundle("bob", bundle); err != nil {
+		t.Fatal(err)
+	}
+
+	// 每次DH棘轮后bob只收到链上的最后一条消息，每条链跳过的数量都不超过MaxSkip
+	const perChain = e2e.MaxSkip - 1
+	var skipped [][]byte
+	for round := 0; round < 4; round++ {
+		for i := 0; i < perChain; i++ {
+			skipped = append(skipped, encrypt(t, alice, "bob", "skipped"))
+		}
+		decrypt(t, bob, "alice", encrypt(t, alice, "bob", "last"), "last")
+		decrypt(t, alice, "bob", encrypt(t, bob, "alice", "reply"), "reply")
+	}
+	state, err := bob.store.Session("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Skipped) != e2e.MaxSkippedKeys || len(state.SkippedOrder) != e2e.MaxSkippedKeys {
+		t.Fatalf("%d skipped keys in order of %d, want %d", len(state.Skipped), len(state.SkippedOrder), e2e.MaxSkippedKeys)
+	}
+
+	// 最早缓存的密钥被淘汰，最近的仍然可以解密
+	if _, err = bob.manager.Decrypt("alice", skipped[0]); err == nil {
+		t.Error("decrypted a message whose key was evicted")
+	}
+	decrypt(t, bob, "alice", skipped[len(skipped)-1], "skipped")
+	if state, _ = bob.store.Session("alice"); len(state.Skipped) != e2e.MaxSkippedKeys-1 || len(state.SkippedOrder) != len(state.Skipped) {
+		t.Errorf("%d skipped keys in order of %d after decrypting one", len(state.Skipped), len(state.SkippedOrder))
+	}
+}
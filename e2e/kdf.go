@@ -0,0 +1,79 @@
+package e2e
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+)
+
+// hkdf RFC 5869 HKDF-SHA256，salt为nil时使用全0
+func hkdf(secret, salt, info []byte, length int) []byte {
+	if salt == nil {
+		salt = make([]byte, sha256.Size)
+	}
+	extract := hmac.New(sha256.New, salt)
+	extract.Write(secret)
+	prk := extract.Sum(nil)
+
+	var out, prev []byte
+	for i := byte(1); len(out) < length; i++ {
+		expand := hmac.New(sha256.New, prk)
+		expand.Write(prev)
+		expand.Write(info)
+		expand.Write([]byte{i})
+		prev = expand.Sum(nil)
+		out = append(out, prev...)
+	}
+	return out[:length]
+}
+
+// kdfRK 根链：由根密钥和DH输出得到新的根密钥和链密钥
+func kdfRK(rootKey, dhOut []byte) ([]byte, []byte) {
+	out := hkdf(dhOut, rootKey, []byte("MSProtoRatchet"), 64)
+	return out[:32], out[32:]
+}
+
+// kdfCK 对称链：由链密钥得到下一个链密钥和消息密钥
+func kdfCK(chainKey []byte) ([]byte, []byte) {
+	mac := hmac.New(sha256.New, chainKey)
+	mac.Write([]byte{0x02})
+	next := mac.Sum(nil)
+	mac = hmac.New(sha256.New, chainKey)
+	mac.Write([]byte{0x01})
+	return next, mac.Sum(nil)
+}
+
+// messageAEAD 由消息密钥得到AES-256-GCM以及nonce
+func messageAEAD(messageKey []byte) (cipher.AEAD, []byte, error) {
+	out := hkdf(messageKey, nil, []byte("MSProtoMessageKeys"), 32+12)
+	block, err := aes.NewCipher(out[:32])
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, err
+	}
+	return aead, out[32:], nil
+}
+
+func seal(messageKey, plaintext, ad []byte) ([]byte, error) {
+	aead, nonce, err := messageAEAD(messageKey)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(nil, nonce, plaintext, ad), nil
+}
+
+func open(messageKey, ciphertext, ad []byte) ([]byte, error) {
+	aead, nonce, err := messageAEAD(messageKey)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, nonce, ciphertext, ad)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
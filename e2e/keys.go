@@ -0,0 +1,224 @@
+package e2e
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+
+	"github.com/pkg/errors"
+)
+
+// KeySize X25519公钥和私钥的长度
+const KeySize = 32
+
+// IdentityKey 身份密钥，X25519用于密钥协商，Ed25519用于签名预共享公钥
+type IdentityKey struct {
+	DH      []byte             // X25519私钥
+	Signing ed25519.PrivateKey // Ed25519私钥
+}
+
+// GenerateIdentityKey 生成身份密钥
+func GenerateIdentityKey() (*IdentityKey, error) {
+	dh, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	_, signing, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &IdentityKey{
+		DH:      dh.Bytes(),
+		Signing: signing,
+	}, nil
+}
+
+// PublicKey X25519公钥
+func (k *IdentityKey) PublicKey() ([]byte, error) {
+	return publicKey(k.DH)
+}
+
+// SignedPreKey 由身份密钥签名的预共享密钥
+type SignedPreKey struct {
+	ID        uint32
+	Private   []byte // X25519私钥
+	Public    []byte // X25519公钥
+	Signature []byte // 对 身份公钥||预共享公钥 的Ed25519签名
+}
+
+// GenerateSignedPreKey 生成由identity签名的预共享密钥
+func GenerateSignedPreKey(identity *IdentityKey, id uint32) (*SignedPreKey, error) {
+	identityPublic, err := identity.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	public := key.PublicKey().Bytes()
+	return &SignedPreKey{
+		ID:        id,
+		Private:   key.Bytes(),
+		Public:    public,
+		Signature: ed25519.Sign(identity.Signing, signedData(identityPublic, public)),
+	}, nil
+}
+
+// OneTimePreKey 一次性预共享密钥
+type OneTimePreKey struct {
+	ID      uint32
+	Private []byte
+	Public  []byte
+}
+
+// GenerateOneTimePreKey 生成一次性预共享密钥，id不能为0
+func GenerateOneTimePreKey(id uint32) (*OneTimePreKey, error) {
+	if id == 0 {
+		return nil, errors.New("one-time pre key id must not be 0")
+	}
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &OneTimePreKey{
+		ID:      id,
+		Private: key.Bytes(),
+		Public:  key.PublicKey().Bytes(),
+	}, nil
+}
+
+// PreKeyBundle 用户发布的公钥集合，发起方通过它与用户建立会话
+type PreKeyBundle struct {
+	IdentityKey     []byte            // 身份X25519公钥
+	SigningKey      ed25519.PublicKey // 身份Ed25519公钥
+	SignedPreKeyID  uint32
+	SignedPreKey    []byte
+	Signature       []byte
+	OneTimePreKeyID uint32 // 为0时没有一次性预共享密钥
+	OneTimePreKey   []byte
+}
+
+// NewPreKeyBundle 创建公钥集合，oneTimePreKey可以为nil
+func NewPreKeyBundle(identity *IdentityKey, signedPreKey *SignedPreKey, oneTimePreKey *OneTimePreKey) (*PreKeyBundle, error) {
+	identityPublic, err := identity.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	bundle := &PreKeyBundle{
+		IdentityKey:    identityPublic,
+		SigningKey:     identity.Signing.Public().(ed25519.PublicKey),
+		SignedPreKeyID: signedPreKey.ID,
+		SignedPreKey:   signedPreKey.Public,
+		Signature:      signedPreKey.Signature,
+	}
+	if oneTimePreKey != nil {
+		bundle.OneTimePreKeyID = oneTimePreKey.ID
+		bundle.OneTimePreKey = oneTimePreKey.Public
+	}
+	return bundle, nil
+}
+
+// Verify 校验预共享公钥的签名
+func (b *PreKeyBundle) Verify() error {
+	if len(b.IdentityKey) != KeySize || len(b.SignedPreKey) != KeySize || len(b.SigningKey) != ed25519.PublicKeySize {
+		return ErrInvalidBundle
+	}
+	if b.OneTimePreKeyID != 0 && len(b.OneTimePreKey) != KeySize {
+		return ErrInvalidBundle
+	}
+	if !ed25519.Verify(b.SigningKey, signedData(b.IdentityKey, b.SignedPreKey), b.Signature) {
+		return errors.Wrap(ErrInvalidBundle, "bad signature")
+	}
+	return nil
+}
+
+func signedData(identityPublic, preKeyPublic []byte) []byte {
+	return append(append([]byte{}, identityPublic...), preKeyPublic...)
+}
+
+// x3dhPrefix X3DH中DH输出之前的32个0xFF
+var x3dhPrefix = bytes.Repeat([]byte{0xFF}, 32)
+
+// x3dhInitiator 发起方计算共享密钥，返回共享密钥和临时公钥
+func x3dhInitiator(identity *IdentityKey, bundle *PreKeyBundle) ([]byte, []byte, error) {
+	if err := bundle.Verify(); err != nil {
+		return nil, nil, err
+	}
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	dhs := [][2][]byte{
+		{identity.DH, bundle.SignedPreKey},
+		{ephemeral.Bytes(), bundle.IdentityKey},
+		{ephemeral.Bytes(), bundle.SignedPreKey},
+	}
+	if bundle.OneTimePreKeyID != 0 {
+		dhs = append(dhs, [2][]byte{ephemeral.Bytes(), bundle.OneTimePreKey})
+	}
+	shared, err := x3dhSecret(dhs)
+	if err != nil {
+		return nil, nil, err
+	}
+	return shared, ephemeral.PublicKey().Bytes(), nil
+}
+
+// x3dhResponder 接收方计算共享密钥
+func x3dhResponder(identity *IdentityKey, signedPreKey *SignedPreKey, oneTimePreKey *OneTimePreKey, peerIdentity, peerEphemeral []byte) ([]byte, error) {
+	dhs := [][2][]byte{
+		{signedPreKey.Private, peerIdentity},
+		{identity.DH, peerEphemeral},
+		{signedPreKey.Private, peerEphemeral},
+	}
+	if oneTimePreKey != nil {
+		dhs = append(dhs, [2][]byte{oneTimePreKey.Private, peerEphemeral})
+	}
+	return x3dhSecret(dhs)
+}
+
+func x3dhSecret(dhs [][2][]byte) ([]byte, error) {
+	ikm := append([]byte{}, x3dhPrefix...)
+	for _, pair := range dhs {
+		out, err := dh(pair[0], pair[1])
+		if err != nil {
+			return nil, err
+		}
+		ikm = append(ikm, out...)
+	}
+	return hkdf(ikm, nil, []byte("MSProtoX3DH"), 32), nil
+}
+
+// dh X25519
+func dh(private, public []byte) ([]byte, error) {
+	privateKey, err := ecdh.X25519().NewPrivateKey(private)
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidKey, err.Error())
+	}
+	publicKey, err := ecdh.X25519().NewPublicKey(public)
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidKey, err.Error())
+	}
+	out, err := privateKey.ECDH(publicKey)
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidKey, err.Error())
+	}
+	return out, nil
+}
+
+func publicKey(private []byte) ([]byte, error) {
+	privateKey, err := ecdh.X25519().NewPrivateKey(private)
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidKey, err.Error())
+	}
+	return privateKey.PublicKey().Bytes(), nil
+}
+
+func generateDH() ([]byte, []byte, error) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key.Bytes(), key.PublicKey().Bytes(), nil
+}
@@ -0,0 +1,276 @@
+package e2e
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// MaxSkip 一条链上最多跳过（缓存）的消息密钥数量
+const MaxSkip = 1000
+
+// MaxSkippedKeys 所有链上最多缓存的消息密钥数量，超过后淘汰最早缓存的
+const MaxSkippedKeys = 2 * MaxSkip
+
+const (
+	messageVersion byte = 1
+
+	messageTypePreKey byte = 1 // 携带X3DH信息，发起方收到对方的消息之前发送
+	messageTypeNormal byte = 2
+)
+
+// PreKeyHeader 发起方在收到对方的消息之前，每条消息都携带X3DH信息，接收方由此建立会话
+type PreKeyHeader struct {
+	IdentityKey     []byte // 发起方身份公钥
+	BaseKey         []byte // 发起方X3DH临时公钥
+	SignedPreKeyID  uint32
+	OneTimePreKeyID uint32 // 为0时没有使用一次性预共享密钥
+}
+
+// SessionState 双棘轮会话状态，字段均可直接序列化（如json）以便KeyStore持久化
+type SessionState struct {
+	RemoteIdentity []byte // 对方身份公钥
+	AssociatedData []byte // 发起方身份公钥||接收方身份公钥
+	BaseKey        []byte // X3DH临时公钥
+
+	RootKey       []byte
+	RatchetKey    []byte // 本方当前的棘轮私钥
+	RemoteRatchet []byte // 对方当前的棘轮公钥
+	SendChainKey  []byte
+	RecvChainKey  []byte
+	SendCount     uint32
+	RecvCount     uint32
+	PrevCount     uint32            // 上一条发送链的消息数量
+	Skipped       map[string][]byte // 跳过的消息密钥，key为 hex(棘轮公钥):序号
+	SkippedOrder  []string          // Skipped的key按缓存的先后顺序排列，用于淘汰最早的
+
+	PreKey *PreKeyHeader // 不为nil时发送的消息携带X3DH信息
+}
+
+// clone 深拷贝，解密失败时丢弃拷贝，不影响原状态
+func (s *SessionState) clone() *SessionState {
+	c := *s
+	c.Skipped = make(map[string][]byte, len(s.Skipped))
+	for k, v := range s.Skipped {
+		c.Skipped[k] = v
+	}
+	c.SkippedOrder = append([]string(nil), s.SkippedOrder...)
+	if s.PreKey != nil {
+		preKey := *s.PreKey
+		c.PreKey = &preKey
+	}
+	return &c
+}
+
+// newInitiatorState 发起方的初始状态，对方的预共享公钥作为对方的第一个棘轮公钥
+func newInitiatorState(shared, remoteRatchet []byte) (*SessionState, error) {
+	private, _, err := generateDH()
+	if err != nil {
+		return nil, err
+	}
+	out, err := dh(private, remoteRatchet)
+	if err != nil {
+		return nil, err
+	}
+	rootKey, sendChainKey := kdfRK(shared, out)
+	return &SessionState{
+		RootKey:       rootKey,
+		RatchetKey:    private,
+		RemoteRatchet: remoteRatchet,
+		SendChainKey:  sendChainKey,
+		Skipped:       map[string][]byte{},
+	}, nil
+}
+
+// newResponderState 接收方的初始状态，预共享私钥作为第一个棘轮私钥
+func newResponderState(shared, ratchetKey []byte) *SessionState {
+	return &SessionState{
+		RootKey:    shared,
+		RatchetKey: ratchetKey,
+		Skipped:    map[string][]byte{},
+	}
+}
+
+// message 解析后的消息
+type message struct {
+	preKey     *PreKeyHeader
+	ratchetKey []byte
+	prevCount  uint32
+	count      uint32
+	header     []byte // 密文之前的全部数据，作为AEAD的附加数据
+	ciphertext []byte
+}
+
+func parseMessage(data []byte) (*message, error) {
+	if len(data) < 2 {
+		return nil, errors.Wrap(ErrInvalidMessage, "too short")
+	}
+	if data[0] != messageVersion {
+		return nil, errors.Wrapf(ErrInvalidMessage, "unknown version %d", data[0])
+	}
+	m := &message{}
+	offset := 2
+	switch data[1] {
+	case messageTypePreKey:
+		if len(data) < offset+KeySize*2+8 {
+			return nil, errors.Wrap(ErrInvalidMessage, "too short")
+		}
+		m.preKey = &PreKeyHeader{
+			IdentityKey:     data[offset : offset+KeySize],
+			BaseKey:         data[offset+KeySize : offset+KeySize*2],
+			SignedPreKeyID:  binary.BigEndian.Uint32(data[offset+KeySize*2:]),
+			OneTimePreKeyID: binary.BigEndian.Uint32(data[offset+KeySize*2+4:]),
+		}
+		offset += KeySize*2 + 8
+	case messageTypeNormal:
+	default:
+		return nil, errors.Wrapf(ErrInvalidMessage, "unknown type %d", data[1])
+	}
+	if len(data) < offset+KeySize+8 {
+		return nil, errors.Wrap(ErrInvalidMessage, "too short")
+	}
+	m.ratchetKey = data[offset : offset+KeySize]
+	m.prevCount = binary.BigEndian.Uint32(data[offset+KeySize:])
+	m.count = binary.BigEndian.Uint32(data[offset+KeySize+4:])
+	offset += KeySize + 8
+	m.header = data[:offset]
+	m.ciphertext = data[offset:]
+	return m, nil
+}
+
+// encrypt 用发送链加密plaintext，返回完整的消息
+func (s *SessionState) encrypt(plaintext []byte) ([]byte, error) {
+	if s.SendChainKey == nil {
+		return nil, ErrNoSession
+	}
+	ratchetPublic, err := publicKey(s.RatchetKey)
+	if err != nil {
+		return nil, err
+	}
+	header := []byte{messageVersion, messageTypeNormal}
+	if s.PreKey != nil {
+		header[1] = messageTypePreKey
+		header = append(header, s.PreKey.IdentityKey...)
+		header = append(header, s.PreKey.BaseKey...)
+		header = binary.BigEndian.AppendUint32(header, s.PreKey.SignedPreKeyID)
+		header = binary.BigEndian.AppendUint32(header, s.PreKey.OneTimePreKeyID)
+	}
+	header = append(header, ratchetPublic...)
+	header = binary.BigEndian.AppendUint32(header, s.PrevCount)
+	header = binary.BigEndian.AppendUint32(header, s.SendCount)
+
+	var messageKey []byte
+	s.SendChainKey, messageKey = kdfCK(s.SendChainKey)
+	s.SendCount++
+	ciphertext, err := seal(messageKey, plaintext, s.ad(header))
+	if err != nil {
+		return nil, err
+	}
+	return append(header, ciphertext...), nil
+}
+
+// decrypt 解密消息，失败时状态可能已被修改，调用方应在拷贝上调用
+func (s *SessionState) decrypt(m *message) ([]byte, error) {
+	key := skippedKey(m.ratchetKey, m.count)
+	if messageKey, ok := s.Skipped[key]; ok {
+		plaintext, err := open(messageKey, m.ciphertext, s.ad(m.header))
+		if err != nil {
+			return nil, err
+		}
+		s.removeSkipped(key)
+		return plaintext, nil
+	}
+	if !bytes.Equal(m.ratchetKey, s.RemoteRatchet) {
+		if err := s.skip(m.prevCount); err != nil {
+			return nil, err
+		}
+		if err := s.ratchet(m.ratchetKey); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.skip(m.count); err != nil {
+		return nil, err
+	}
+	var messageKey []byte
+	s.RecvChainKey, messageKey = kdfCK(s.RecvChainKey)
+	s.RecvCount++
+	return open(messageKey, m.ciphertext, s.ad(m.header))
+}
+
+// skip 缓存接收链上序号小于until的消息密钥
+func (s *SessionState) skip(until uint32) error {
+	if s.RecvChainKey == nil {
+		return nil
+	}
+	if until > s.RecvCount+MaxSkip {
+		return errors.Wrapf(ErrTooManySkipped, "skip %d messages", until-s.RecvCount)
+	}
+	for s.RecvCount < until {
+		var messageKey []byte
+		s.RecvChainKey, messageKey = kdfCK(s.RecvChainKey)
+		s.addSkipped(skippedKey(s.RemoteRatchet, s.RecvCount), messageKey)
+		s.RecvCount++
+	}
+	return nil
+}
+
+// addSkipped 缓存跳过的消息密钥，MaxSkip只限制一条链，DH棘轮之后旧链的密钥仍然保留，总数超过MaxSkippedKeys时淘汰最早缓存的
+func (s *SessionState) addSkipped(key string, messageKey []byte) {
+	if len(s.SkippedOrder) != len(s.Skipped) {
+		// 没有记录顺序的旧状态，按任意顺序补齐
+		s.SkippedOrder = s.SkippedOrder[:0]
+		for k := range s.Skipped {
+			s.SkippedOrder = append(s.SkippedOrder, k)
+		}
+	}
+	s.Skipped[key] = messageKey
+	s.SkippedOrder = append(s.SkippedOrder, key)
+	for len(s.SkippedOrder) > MaxSkippedKeys {
+		delete(s.Skipped, s.SkippedOrder[0])
+		s.SkippedOrder = s.SkippedOrder[1:]
+	}
+}
+
+func (s *SessionState) removeSkipped(key string) {
+	delete(s.Skipped, key)
+	for i, k := range s.SkippedOrder {
+		if k == key {
+			s.SkippedOrder = append(s.SkippedOrder[:i], s.SkippedOrder[i+1:]...)
+			return
+		}
+	}
+}
+
+// ratchet DH棘轮：对方换了棘轮公钥，依次得到新的接收链和发送链
+func (s *SessionState) ratchet(remoteRatchet []byte) error {
+	s.PrevCount = s.SendCount
+	s.SendCount = 0
+	s.RecvCount = 0
+	s.RemoteRatchet = append([]byte{}, remoteRatchet...)
+
+	out, err := dh(s.RatchetKey, s.RemoteRatchet)
+	if err != nil {
+		return err
+	}
+	s.RootKey, s.RecvChainKey = kdfRK(s.RootKey, out)
+
+	if s.RatchetKey, _, err = generateDH(); err != nil {
+		return err
+	}
+	if out, err = dh(s.RatchetKey, s.RemoteRatchet); err != nil {
+		return err
+	}
+	s.RootKey, s.SendChainKey = kdfRK(s.RootKey, out)
+	return nil
+}
+
+func (s *SessionState) ad(header []byte) []byte {
+	return append(append([]byte{}, s.AssociatedData...), header...)
+}
+
+func skippedKey(ratchetKey []byte, count uint32) string {
+	return hex.EncodeToString(ratchetKey) + ":" + strconv.FormatUint(uint64(count), 10)
+}
@@ -0,0 +1,153 @@
+package e2e
+
+import (
+	"sync"
+)
+
+// KeyStore 保存本方的密钥以及与各个用户的会话，实现需要并发安全
+type KeyStore interface {
+	// IdentityKey 本方身份密钥
+	IdentityKey() (*IdentityKey, error)
+	// SignedPreKey 预共享密钥，不存在时返回ErrNotFound
+	SignedPreKey(id uint32) (*SignedPreKey, error)
+	// OneTimePreKey 一次性预共享密钥，不存在时返回ErrNotFound
+	OneTimePreKey(id uint32) (*OneTimePreKey, error)
+	// RemoveOneTimePreKey 删除已使用的一次性预共享密钥
+	RemoveOneTimePreKey(id uint32) error
+	// Session 与peer的会话，不存在时返回ErrNotFound
+	Session(peer string) (*SessionState, error)
+	// StoreSession 保存与peer的会话
+	StoreSession(peer string, state *SessionState) error
+	// BaseKeyUsed X3DH临时公钥是否已经用于建立过会话
+	BaseKeyUsed(baseKey []byte) (bool, error)
+	// MarkBaseKeyUsed 记录已用于建立会话的X3DH临时公钥，用于拒绝重放的PreKey消息
+	MarkBaseKeyUsed(baseKey []byte) error
+}
+
+// MemoryStore 内存中的KeyStore
+type MemoryStore struct {
+	mu             sync.RWMutex
+	identity       *IdentityKey
+	signedPreKeys  map[uint32]*SignedPreKey
+	oneTimePreKeys map[uint32]*OneTimePreKey
+	sessions       map[string]*SessionState
+	baseKeys       map[string]struct{}
+	signedPreKeyID uint32
+	nextPreKeyID   uint32
+}
+
+// NewMemoryStore 创建内存KeyStore，identity为nil时自动生成
+func NewMemoryStore(identity *IdentityKey) (*MemoryStore, error) {
+	if identity == nil {
+		var err error
+		if identity, err = GenerateIdentityKey(); err != nil {
+			return nil, err
+		}
+	}
+	return &MemoryStore{
+		identity:       identity,
+		signedPreKeys:  map[uint32]*SignedPreKey{},
+		oneTimePreKeys: map[uint32]*OneTimePreKey{},
+		sessions:       map[string]*SessionState{},
+		baseKeys:       map[string]struct{}{},
+	}, nil
+}
+
+func (m *MemoryStore) IdentityKey() (*IdentityKey, error) {
+	return m.identity, nil
+}
+
+func (m *MemoryStore) SignedPreKey(id uint32) (*SignedPreKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	key, ok := m.signedPreKeys[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return key, nil
+}
+
+func (m *MemoryStore) OneTimePreKey(id uint32) (*OneTimePreKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	key, ok := m.oneTimePreKeys[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return key, nil
+}
+
+func (m *MemoryStore) RemoveOneTimePreKey(id uint32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.oneTimePreKeys, id)
+	return nil
+}
+
+func (m *MemoryStore) Session(peer string) (*SessionState, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	state, ok := m.sessions[peer]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return state.clone(), nil
+}
+
+func (m *MemoryStore) StoreSession(peer string, state *SessionState) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions[peer] = state.clone()
+	return nil
+}
+
+func (m *MemoryStore) BaseKeyUsed(baseKey []byte) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.baseKeys[string(baseKey)]
+	return ok, nil
+}
+
+func (m *MemoryStore) MarkBaseKeyUsed(baseKey []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.baseKeys[string(baseKey)] = struct{}{}
+	return nil
+}
+
+// AddSignedPreKey 保存预共享密钥
+func (m *MemoryStore) AddSignedPreKey(key *SignedPreKey) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.signedPreKeys[key.ID] = key
+}
+
+// AddOneTimePreKey 保存一次性预共享密钥
+func (m *MemoryStore) AddOneTimePreKey(key *OneTimePreKey) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.oneTimePreKeys[key.ID] = key
+}
+
+// NewBundle 生成一个新的一次性预共享密钥，返回包含它的公钥集合
+// 第一次调用时生成预共享密钥，之后的公钥集合共用该预共享密钥
+func (m *MemoryStore) NewBundle() (*PreKeyBundle, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	signedPreKey, ok := m.signedPreKeys[m.signedPreKeyID]
+	if !ok {
+		var err error
+		if signedPreKey, err = GenerateSignedPreKey(m.identity, m.signedPreKeyID+1); err != nil {
+			return nil, err
+		}
+		m.signedPreKeyID = signedPreKey.ID
+		m.signedPreKeys[signedPreKey.ID] = signedPreKey
+	}
+	oneTimePreKey, err := GenerateOneTimePreKey(m.nextPreKeyID + 1)
+	if err != nil {
+		return nil, err
+	}
+	m.nextPreKeyID = oneTimePreKey.ID
+	m.oneTimePreKeys[oneTimePreKey.ID] = oneTimePreKey
+	return NewPreKeyBundle(m.identity, signedPreKey, oneTimePreKey)
+}
@@ -2,10 +2,10 @@ package msproto
 
 import (
 	"bytes"
-	"fmt"
 	"io"
 	"math"
 
+	"github.com/pkg/errors"
 	"github.com/valyala/bytebufferpool"
 )
 
@@ -38,8 +38,12 @@ type Writer interface {
 }
 
 // Encoder 编码者
+// 写入失败后会记录第一个错误，之后的写入都会被忽略，写完一组字段后通过Err获取错误
 type Encoder struct {
-	w Writer
+	w        Writer
+	err      error  // 第一次写入失败的错误
+	field    string // 当前写入的字段
+	errField string // 写入失败的字段
 }
 
 // NewEncoder NewEncoder
@@ -64,14 +68,47 @@ func (e *Encoder) Len() int {
 	return e.w.Len()
 }
 
+// Err 第一次写入失败的错误
+func (e *Encoder) Err() error {
+	return e.err
+}
+
+// Field 设置接下来写入的字段名，写入失败时用于说明是哪个字段
+func (e *Encoder) Field(name string) *Encoder {
+	if e.err == nil {
+		e.field = name
+	}
+	return e
+}
+
+func (e *Encoder) setErr(err error) {
+	if err != nil && e.err == nil {
+		e.err = err
+		e.errField = e.field
+	}
+}
+
+func (e *Encoder) write(b []byte) {
+	if e.err != nil {
+		return
+	}
+	_, err := e.w.Write(b)
+	e.setErr(err)
+}
+
 // WriteByte WriteByte
 func (e *Encoder) WriteByte(b byte) error {
-	return e.w.WriteByte(b)
+	if e.err != nil {
+		return e.err
+	}
+	err := e.w.WriteByte(b)
+	e.setErr(err)
+	return err
 }
 
 // WriteInt WriteInt
 func (e *Encoder) WriteInt(i int) error {
-	return e.w.WriteByte(byte(i))
+	return e.WriteByte(byte(i))
 }
 
 // WriteUint8 WriteUint8
@@ -81,7 +118,7 @@ func (e *Encoder) WriteUint8(i uint8) {
 
 // WriteInt16 WriteInt16
 func (e *Encoder) WriteInt16(i int) {
-	_, _ = e.w.Write([]byte{byte(i >> 8), byte(i & 0xFF)})
+	e.write([]byte{byte(i >> 8), byte(i & 0xFF)})
 }
 
 // WriteUint16 WriteUint16
@@ -89,9 +126,18 @@ func (e *Encoder) WriteUint16(i uint16) {
 	e.WriteInt16(int(i))
 }
 
+// WriteUint32Of64 以uint32写入i，i超过math.MaxUint32时记录ErrFieldOverflow
+func (e *Encoder) WriteUint32Of64(i uint64) {
+	if i > math.MaxUint32 {
+		e.setErr(errors.Wrapf(ErrFieldOverflow, "%d exceeds %d", i, uint64(math.MaxUint32)))
+		return
+	}
+	e.WriteUint32(uint32(i))
+}
+
 // WriteInt32 WriteInt32
 func (e *Encoder) WriteInt32(i int32) {
-	_, _ = e.w.Write([]byte{
+	e.write([]byte{
 		byte(i >> 24),
 		byte(i >> 16),
 		byte(i >> 8),
@@ -101,7 +147,7 @@ func (e *Encoder) WriteInt32(i int32) {
 
 // WriteInt64 WriteInt64
 func (e *Encoder) WriteInt64(i int64) {
-	_, _ = e.w.Write([]byte{
+	e.write([]byte{
 		byte(i >> 56),
 		byte(i >> 48),
 		byte(i >> 40),
@@ -115,7 +161,7 @@ func (e *Encoder) WriteInt64(i int64) {
 
 // WriteUint64 WriteUint64
 func (e *Encoder) WriteUint64(i uint64) {
-	_, _ = e.w.Write([]byte{
+	e.write([]byte{
 		byte(i >> 56),
 		byte(i >> 48),
 		byte(i >> 40),
@@ -129,7 +175,10 @@ func (e *Encoder) WriteUint64(i uint64) {
 
 // WriteUint32 WriteUint32
 func (e *Encoder) WriteUint32(i uint32) {
-	_ = WriteUint32(i, e.w)
+	if e.err != nil {
+		return
+	}
+	e.setErr(WriteUint32(i, e.w))
 }
 
 // WriteString WriteString
@@ -142,23 +191,24 @@ func (e *Encoder) WriteStringAll(str string) {
 	e.WriteBytes([]byte(str))
 }
 
-// WriteBinary WriteBinary
+// WriteBinary WriteBinary 长度超过math.MaxInt16时记录ErrFieldTooLong
 func (e *Encoder) WriteBinary(b []byte) {
 	if len(b) == 0 {
 		e.WriteInt16(0)
 	} else {
 		bl := len(b)
 		if bl > math.MaxInt16 {
-			panic(fmt.Errorf("WriteBinary: len(b) > math.MaxInt16, len(b) = %d", bl))
+			e.setErr(errors.Wrapf(ErrFieldTooLong, "length %d exceeds %d", bl, math.MaxInt16))
+			return
 		}
 		e.WriteInt16(bl)
-		_, _ = e.w.Write(b)
+		e.write(b)
 	}
 }
 
 // WriteBytes WriteBytes
 func (e *Encoder) WriteBytes(b []byte) {
-	_, _ = e.w.Write(b)
+	e.write(b)
 }
 
 // WriteVariable WriteVariable
@@ -172,7 +222,7 @@ func (e *Encoder) WriteVariable(v int) {
 		}
 		b = append(b, byte(digit))
 	}
-	_, _ = e.w.Write(b)
+	e.write(b)
 }
 
 func (e *Encoder) End() {
@@ -201,6 +251,9 @@ func WriteBinary(b []byte, w io.Writer) error {
 			return err
 		}
 	} else {
+		if len(b) > math.MaxInt16 {
+			return errors.Wrapf(ErrFieldTooLong, "length %d exceeds %d", len(b), math.MaxInt16)
+		}
 		err = WriteInt16(len(b), w)
 		if err != nil {
 			return err
@@ -0,0 +1,138 @@
+package msproto
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// plainWriter 不支持Truncate的Writer
+type plainWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *plainWriter) Write(p []byte) (int, error)          { return w.buf.Write(p) }
+func (w *plainWriter) WriteByte(c byte) error               { return w.buf.WriteByte(c) }
+func (w *plainWriter) WriteTo(dst io.Writer) (int64, error) { return w.buf.WriteTo(dst) }
+func (w *plainWriter) Bytes() []byte                        { return w.buf.Bytes() }
+func (w *plainWriter) Len() int                             { return w.buf.Len() }
+
+// limitWriter 写入超过n个字节后失败
+type limitWriter struct {
+	plainWriter
+	n int
+}
+
+func (w *limitWriter) Write(p []byte) (int, error) {
+	if w.Len()+len(p) > w.n {
+		return 0, io.ErrShortWrite
+	}
+	return w.plainWriter.Write(p)
+}
+
+func (w *limitWriter) WriteByte(c byte) error {
+	_, err := w.Write([]byte{c})
+	return err
+}
+
+func TestEncoderStickyError(t *testing.T) {
+	enc := NewEncoder()
+	enc.Field("A").WriteUint8(1)
+	enc.Field("B").WriteBinary(make([]byte, math.MaxInt16+1))
+	enc.Field("C").WriteUint32Of64(math.MaxUint32 + 1)
+	enc.Field("D").WriteString("ignored")
+	if !errors.Is(enc.Err(), ErrFieldTooLong) || enc.errField != "B" {
+		t.Fatalf("err = %v on %q, want ErrFieldTooLong on B", enc.Err(), enc.errField)
+	}
+	// 失败后的写入被忽略
+	if enc.Len() != 1 {
+		t.Fatalf("wrote %d bytes, want 1", enc.Len())
+	}
+	if err := enc.WriteByte(2); !errors.Is(err, ErrFieldTooLong) {
+		t.Fatalf("WriteByte after failure = %v, want the first error", err)
+	}
+
+	enc = NewEncoder()
+	enc.Field("Seq").WriteUint32Of64(math.MaxUint32 + 1)
+	if !errors.Is(enc.Err(), ErrFieldOverflow) || enc.errField != "Seq" {
+		t.Fatalf("err = %v on %q, want ErrFieldOverflow on Seq", enc.Err(), enc.errField)
+	}
+
+	enc = NewEncoderBuffer(&limitWriter{n: 3})
+	enc.Field("A").WriteUint16(1)
+	enc.Field("B").WriteInt32(2)
+	enc.Field("C").WriteUint8(3)
+	if !errors.Is(enc.Err(), io.ErrShortWrite) || enc.errField != "B" {
+		t.Fatalf("err = %v on %q, want io.ErrShortWrite on B", enc.Err(), enc.errField)
+	}
+}
+
+func TestEncodeErrorField(t *testing.T) {
+	long := string(make([]byte, math.MaxInt16+1))
+	tests := []struct {
+		name    string
+		proto   *MSProto
+		frame   Frame
+		version uint8
+		w       func() Writer
+		field   string
+		err     error
+	}{
+		{"string too long", New(), &ConnectPacket{UID: "u", Token: long}, LatestVersion, nil, "Token", ErrFieldTooLong},
+		{"SEND string too long", New(), &SendPacket{ChannelID: "c", MsgKey: long}, LatestVersion, nil, "MsgKey", ErrFieldTooLong},
+		{"ClientSeq overflow", New(), &SendackPacket{ClientSeq: math.MaxUint32 + 1}, 4, nil, "ClientSeq", ErrFieldOverflow},
+		{"payload too large", New(), &RecvPacket{Payload: make([]byte, PayloadMaxSize+1)}, LatestVersion, nil, "Payload", ErrPayloadTooLarge},
+		{"frame too large", New(WithMaxRemainingLength(4)), &RecvackPacket{MessageID: 1}, LatestVersion, nil, "", ErrFrameTooLarge},
+		{"write header", New(), &RecvackPacket{MessageID: 1}, LatestVersion, func() Writer { return &limitWriter{} }, "Header", io.ErrShortWrite},
+		{"write field", New(), &RecvackPacket{MessageID: 1}, LatestVersion, func() Writer { return &limitWriter{n: 4} }, "MessageID", io.ErrShortWrite},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var err error
+			if tt.w == nil {
+				_, err = tt.proto.EncodeFrame(tt.frame, tt.version)
+			} else {
+				err = tt.proto.encodeFrameTo(tt.w(), tt.frame, tt.version)
+			}
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			var encodeErr *EncodeError
+			if !errors.As(err, &encodeErr) {
+				t.Fatalf("err = %v, want *EncodeError", err)
+			}
+			if encodeErr.FrameType != tt.frame.GetFrameType() || encodeErr.Field != tt.field {
+				t.Fatalf("got %s.%s, want %s.%s", encodeErr.FrameType, encodeErr.Field, tt.frame.GetFrameType(), tt.field)
+			}
+		})
+	}
+}
+
+func TestWriteFrameNoPartialFrame(t *testing.T) {
+	proto := New()
+	ok := &RecvackPacket{MessageID: 1, MessageSeq: 1}
+	// 编码到一半才失败的包
+	bad := &SendPacket{ChannelID: "c", MsgKey: string(make([]byte, math.MaxInt16+1))}
+	want, err := proto.EncodeFrame(ok, LatestVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writers := map[string]Writer{
+		"bytes.Buffer": &bytes.Buffer{},
+		"plain writer": &plainWriter{},
+	}
+	for name, w := range writers {
+		if err = proto.WriteFrame(w, ok, LatestVersion); err != nil {
+			t.Fatal(err)
+		}
+		if err = proto.WriteFrame(w, bad, LatestVersion); !errors.Is(err, ErrFieldTooLong) {
+			t.Fatalf("%s: err = %v, want ErrFieldTooLong", name, err)
+		}
+		if !bytes.Equal(w.Bytes(), want) {
+			t.Fatalf("%s: writer holds %x after a failed encode, want %x", name, w.Bytes(), want)
+		}
+	}
+}
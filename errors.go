@@ -0,0 +1,78 @@
+package msproto
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrIncomplete 数据不足一个完整的报文，需要读取更多字节
+	ErrIncomplete = errors.New("incomplete frame")
+	// ErrMalformedLength 剩余长度编码不合法（超过4个字节）
+	ErrMalformedLength = errors.New("malformed remaining length")
+	// ErrFrameTooLarge 报文超出最大限制
+	ErrFrameTooLarge = errors.New("frame too large")
+	// ErrUnknownFrameType 不支持的包类型
+	ErrUnknownFrameType = errors.New("unknown frame type")
+	// ErrUnsupportedVersion 协议版本不在支持范围内
+	ErrUnsupportedVersion = errors.New("unsupported protocol version")
+	// ErrPayloadTooLarge 消息负载超出最大限制
+	ErrPayloadTooLarge = errors.New("payload too large")
+	// ErrNilFrame 包为nil
+	ErrNilFrame = errors.New("nil frame")
+	// ErrFieldTooLong 字符串或二进制字段超出长度前缀能表示的最大长度
+	ErrFieldTooLong = errors.New("field too long")
+	// ErrFieldOverflow 数值字段超出当前协议版本中该字段能表示的范围
+	ErrFieldOverflow = errors.New("field overflow")
+	// ErrFrameTypeMismatch 数据中的包类型与要解码到的包类型不一致
+	ErrFrameTypeMismatch = errors.New("frame type mismatch")
+	// ErrTrailingBytes 严格模式下包体有多余的字节
+	ErrTrailingBytes = errors.New("trailing bytes after frame body")
+)
+
+// DecodeError 解码包字段失败
+type DecodeError struct {
+	FrameType FrameType // 包类型
+	Field     string    // 解码失败的字段
+	Offset    int       // 字段在包体中的偏移
+	Err       error     // 原始错误
+}
+
+func newDecodeError(frameType FrameType, field string, offset int, err error) *DecodeError {
+	return &DecodeError{
+		FrameType: frameType,
+		Field:     field,
+		Offset:    offset,
+		Err:       err,
+	}
+}
+
+func (e *DecodeError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("decode %s at offset %d: %v", e.FrameType, e.Offset, e.Err)
+	}
+	return fmt.Sprintf("decode %s.%s at offset %d: %v", e.FrameType, e.Field, e.Offset, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// EncodeError 编码包字段失败
+type EncodeError struct {
+	FrameType FrameType // 包类型
+	Field     string    // 编码失败的字段
+	Err       error     // 原始错误
+}
+
+func (e *EncodeError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("encode %s: %v", e.FrameType, e.Err)
+	}
+	return fmt.Sprintf("encode %s.%s: %v", e.FrameType, e.Field, e.Err)
+}
+
+func (e *EncodeError) Unwrap() error {
+	return e.Err
+}
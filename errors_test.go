@@ -0,0 +1,163 @@
+package msproto
+
+import (
+	"io"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+type testField struct {
+	name string
+	size int
+}
+
+func str(s string) int { return StringFixLenByteSize + len(s) }
+
+func TestDecodeErrorField(t *testing.T) {
+	proto := New()
+	tests := []struct {
+		frame   Frame
+		version uint8
+		fields  []testField // 按顺序排列的包体字段，Payload除外
+	}{
+		{
+			&ConnectPacket{Version: LatestVersion, DeviceFlag: APP, DeviceID: "d", UID: "u1", Token: "tok", ClientTimestamp: 1, ClientKey: "key"},
+			LatestVersion,
+			[]testField{{"Version", 1}, {"DeviceFlag", 1}, {"DeviceID", str("d")}, {"UID", str("u1")}, {"Token", str("tok")}, {"ClientTimestamp", 8}, {"ClientKey", str("key")}},
+		},
+		{
+			&ConnackPacket{Framer: Framer{HasServerVersion: true}, ServerVersion: LatestVersion, TimeDiff: 1, ReasonCode: ReasonSuccess, ServerKey: "sk", Salt: "salt", NodeId: 7},
+			LatestVersion,
+			[]testField{{"ServerVersion", 1}, {"TimeDiff", 8}, {"ReasonCode", 1}, {"ServerKey", str("sk")}, {"Salt", str("salt")}, {"NodeId", 8}},
+		},
+		{
+			&SendPacket{Setting: SettingStream | SettingTopic, ClientSeq: 1, ClientMsgNo: "m1", StreamNo: "s1", ChannelID: "c", ChannelType: ChannelTypePerson, Expire: 1, MsgKey: "mk", Topic: "tp", Payload: []byte("hi")},
+			LatestVersion,
+			[]testField{{"Setting", 1}, {"ClientSeq", 8}, {"ClientMsgNo", str("m1")}, {"StreamNo", str("s1")}, {"ChannelID", str("c")}, {"ChannelType", 1}, {"Expire", 4}, {"MsgKey", str("mk")}, {"Topic", str("tp")}},
+		},
+		{
+			&SendPacket{ClientSeq: 1, ClientMsgNo: "m1", ChannelID: "c", ChannelType: ChannelTypePerson, MsgKey: "mk"},
+			4,
+			[]testField{{"Setting", 1}, {"ClientSeq", 4}, {"ClientMsgNo", str("m1")}, {"ChannelID", str("c")}, {"ChannelType", 1}, {"Expire", 4}, {"MsgKey", str("mk")}},
+		},
+		{
+			&SendackPacket{MessageID: 1, ClientSeq: 2, MessageSeq: 3, ReasonCode: ReasonSuccess},
+			LatestVersion,
+			[]testField{{"MessageID", 8}, {"ClientSeq", 8}, {"MessageSeq", 4}, {"ReasonCode", 1}},
+		},
+		{
+			&RecvPacket{Setting: SettingStream | SettingTopic, MsgKey: "mk", FromUID: "f", ChannelID: "c", ChannelType: ChannelTypePerson, Expire: 1, ClientMsgNo: "m1", StreamNo: "s1", StreamId: 2, MessageID: 3, MessageSeq: 4, Timestamp: 5, Topic: "tp", Payload: []byte("hi")},
+			LatestVersion,
+			[]testField{{"Setting", 1}, {"MsgKey", str("mk")}, {"FromUID", str("f")}, {"ChannelID", str("c")}, {"ChannelType", 1}, {"Expire", 4}, {"ClientMsgNo", str("m1")}, {"StreamFlag", 1}, {"StreamNo", str("s1")}, {"StreamId", 8}, {"MessageID", 8}, {"MessageSeq", 4}, {"Timestamp", 4}, {"Topic", str("tp")}},
+		},
+		{
+			&RecvackPacket{MessageID: 1, MessageSeq: 2},
+			LatestVersion,
+			[]testField{{"MessageID", 8}, {"MessageSeq", 4}},
+		},
+		{
+			&DisconnectPacket{ReasonCode: ReasonConnectKick, Reason: "kick"},
+			LatestVersion,
+			[]testField{{"ReasonCode", 1}, {"Reason", str("kick")}},
+		},
+		{
+			&SubPacket{SubNo: "s1", ChannelID: "c", ChannelType: ChannelTypeLive, Action: Subscribe, Param: "p"},
+			LatestVersion,
+			[]testField{{"Setting", 1}, {"SubNo", str("s1")}, {"ChannelID", str("c")}, {"ChannelType", 1}, {"Action", 1}, {"Param", str("p")}},
+		},
+		{
+			&SubackPacket{SubNo: "s1", ChannelID: "c", ChannelType: ChannelTypeLive, Action: Subscribe, ReasonCode: ReasonSuccess},
+			LatestVersion,
+			[]testField{{"SubNo", str("s1")}, {"ChannelID", str("c")}, {"ChannelType", 1}, {"Action", 1}, {"ReasonCode", 1}},
+		},
+	}
+	for _, tt := range tests {
+		frameType := tt.frame.GetFrameType()
+		data, err := proto.EncodeFrame(tt.frame, tt.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, remainingLengthLength, err := proto.decodeFramer(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		header, body := data[0], data[1+remainingLengthLength:]
+		offset := 0
+		for _, field := range tt.fields {
+			offset += field.size
+		}
+		if payload := len(body) - offset; payload < 0 || (frameType != SEND && frameType != RECV && payload != 0) {
+			t.Fatalf("%s v%d: fields cover %d of %d body bytes", frameType, tt.version, offset, len(body))
+		}
+
+		offset = 0
+		for _, field := range tt.fields {
+			// 在字段内的每个位置截断包体
+			for cut := offset; cut < offset+field.size; cut++ {
+				truncated := append([]byte{header}, encodeVariable(uint32(cut))...)
+				if cut == 0 {
+					truncated = append(truncated, 0)
+				}
+				truncated = append(truncated, body[:cut]...)
+
+				_, _, err := proto.DecodeFrame(truncated, tt.version)
+				checkDecodeError(t, err, frameType, field.name, offset, cut)
+
+				into := newFrame(frameType)
+				_, err = proto.DecodeFrameInto(truncated, into, tt.version)
+				checkDecodeError(t, err, frameType, field.name, offset, cut)
+			}
+			offset += field.size
+		}
+	}
+}
+
+func checkDecodeError(t *testing.T, err error, frameType FrameType, field string, offset, cut int) {
+	t.Helper()
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Fatalf("%s cut at %d: err = %v, want *DecodeError", frameType, cut, err)
+	}
+	if decodeErr.FrameType != frameType || decodeErr.Field != field || decodeErr.Offset != offset {
+		t.Fatalf("%s cut at %d: got %s.%s at %d, want %s.%s at %d", frameType, cut, decodeErr.FrameType, decodeErr.Field, decodeErr.Offset, frameType, field, offset)
+	}
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("%s cut at %d: err = %v, want io.ErrUnexpectedEOF", frameType, cut, err)
+	}
+}
+
+// newFrame 创建frameType对应的空包
+func newFrame(frameType FrameType) Frame {
+	switch frameType {
+	case CONNECT:
+		return &ConnectPacket{}
+	case CONNACK:
+		return &ConnackPacket{}
+	case SEND:
+		return &SendPacket{}
+	case SENDACK:
+		return &SendackPacket{}
+	case RECV:
+		return &RecvPacket{}
+	case RECVACK:
+		return &RecvackPacket{}
+	case DISCONNECT:
+		return &DisconnectPacket{}
+	case SUB:
+		return &SubPacket{}
+	case SUBACK:
+		return &SubackPacket{}
+	}
+	return nil
+}
+
+func TestDecodeErrorNegativeLength(t *testing.T) {
+	// 字符串长度前缀为负数
+	data := []byte{byte(DISCONNECT) << 4, 0x03, byte(ReasonConnectKick), 0xFF, 0xFF}
+	_, _, err := New().DecodeFrame(data, LatestVersion)
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) || decodeErr.Field != "Reason" || decodeErr.Offset != 1 {
+		t.Fatalf("err = %v, want DecodeError on Reason at 1", err)
+	}
+}
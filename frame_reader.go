@@ -0,0 +1,124 @@
+package msproto
+
+import (
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// frameReaderBufferSize FrameReader初始缓冲区大小
+const frameReaderBufferSize = 4096
+
+// maxConsecutiveEmptyReads 底层reader连续返回(0, nil)的最大次数，超过后返回io.ErrNoProgress
+const maxConsecutiveEmptyReads = 100
+
+// FrameReader 带缓冲的帧读取器，适用于长连接，每次读取一个完整的Frame
+// 内部缓冲区会被复用，除非协议对象开启了CopyPayload，返回的Frame中的[]byte字段（如Payload）只在下一次调用ReadFrame之前有效
+type FrameReader struct {
+	r       io.Reader
+	proto   *MSProto
+	version uint8
+	cipher  PayloadCipher // 由Codec创建时设置，自动解密Payload
+
+	buf   []byte
+	start int   // 未消费数据的开始位置
+	end   int   // 未消费数据的结束位置
+	err   error // 底层reader返回的错误，在缓冲数据消费完后返回
+}
+
+// NewFrameReader 创建帧读取器
+func NewFrameReader(r io.Reader, proto *MSProto, version uint8) *FrameReader {
+	return &FrameReader{
+		r:       r,
+		proto:   proto,
+		version: version,
+		buf:     make([]byte, frameReaderBufferSize),
+	}
+}
+
+// ReadFrame 读取一个完整的Frame
+// 剩余长度编码不合法返回ErrMalformedLength，报文超出最大限制返回ErrFrameTooLarge，
+// 报文读取到一半连接结束返回io.ErrUnexpectedEOF，在报文边界处结束返回io.EOF，
+// 底层reader多次连续返回(0, nil)时返回io.ErrNoProgress，
+// MsgKey校验失败返回*MsgKeyError，Payload解密失败返回*PayloadError，此时包已经被完整读取，可以继续读取下一个包
+func (fr *FrameReader) ReadFrame() (Frame, error) {
+	if err := fr.proto.checkVersion(fr.version); err != nil {
+		return nil, err
+	}
+	for {
+		data := fr.buf[fr.start:fr.end]
+		framer, remainingLengthLength, err := fr.proto.decodeFramer(data)
+		if err == nil {
+			if err = fr.proto.checkRemainingLength(framer.RemainingLength); err != nil {
+				return nil, err
+			}
+			msgLen := 1 + remainingLengthLength + int(framer.RemainingLength)
+			if len(data) >= msgLen {
+				fr.start += msgLen
+				framer.FrameSize = int64(msgLen)
+				frame, err := fr.proto.decodePacket(framer, fr.proto.ownBody(data[1+remainingLengthLength:msgLen]), fr.version)
+				if err != nil {
+					return nil, err
+				}
+				if err = decryptFrame(fr.cipher, frame, fr.version); err != nil {
+					return nil, err
+				}
+				return frame, nil
+			}
+			err = fr.fill(msgLen)
+		} else if errors.Is(err, ErrIncomplete) {
+			err = fr.fill(len(data) + 1)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Buffered 缓冲区中未消费的字节数
+func (fr *FrameReader) Buffered() int {
+	return fr.end - fr.start
+}
+
+// fill 从底层reader读取数据，保证缓冲区可以容纳need个未消费的字节
+func (fr *FrameReader) fill(need int) error {
+	if fr.err != nil {
+		return fr.readErr()
+	}
+	if fr.start+need > len(fr.buf) {
+		if need > len(fr.buf) {
+			size := len(fr.buf) * 2
+			if size < need {
+				size = need
+			}
+			buf := make([]byte, size)
+			fr.end = copy(buf, fr.buf[fr.start:fr.end])
+			fr.buf = buf
+		} else {
+			fr.end = copy(fr.buf, fr.buf[fr.start:fr.end])
+		}
+		fr.start = 0
+	}
+	for i := 0; i < maxConsecutiveEmptyReads; i++ {
+		n, err := fr.r.Read(fr.buf[fr.end:])
+		fr.end += n
+		if err != nil {
+			fr.err = err
+			if n == 0 {
+				return fr.readErr()
+			}
+		}
+		if n > 0 {
+			return nil
+		}
+	}
+	fr.err = io.ErrNoProgress
+	return fr.err
+}
+
+func (fr *FrameReader) readErr() error {
+	if fr.err == io.EOF && fr.end > fr.start {
+		return io.ErrUnexpectedEOF
+	}
+	return fr.err
+}
@@ -0,0 +1,147 @@
+package msproto
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/pkg/errors"
+)
+
+// encodeFrames 依次编码frames并拼接
+func encodeFrames(t *testing.T, proto *MSProto, frames ...Frame) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	for _, frame := range frames {
+		if err := proto.WriteFrame(&buf, frame, LatestVersion); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+// emptyReader 一直返回(0, nil)
+type emptyReader struct{}
+
+func (emptyReader) Read(p []byte) (int, error) { return 0, nil }
+
+func TestFrameReaderSplitReads(t *testing.T) {
+	proto := New()
+	frames := []Frame{
+		&SendPacket{ClientSeq: 1, ClientMsgNo: "m1", ChannelID: "c", ChannelType: ChannelTypePerson, Payload: []byte("hello")},
+		&PingPacket{},
+		&RecvPacket{MessageID: 2, MessageSeq: 3, ChannelID: "c", ChannelType: ChannelTypePerson, Payload: []byte("world")},
+		&SendackPacket{ClientSeq: 1, MessageID: 2, ReasonCode: ReasonSuccess},
+	}
+	data := encodeFrames(t, proto, frames...)
+
+	readers := map[string]func() io.Reader{
+		// 一次读取到全部的帧
+		"all at once": func() io.Reader { return bytes.NewReader(data) },
+		// 每个帧被拆成多次读取
+		"one byte": func() io.Reader { return iotest.OneByteReader(bytes.NewReader(data)) },
+		"half":     func() io.Reader { return iotest.HalfReader(bytes.NewReader(data)) },
+		// 读取到最后一个字节时同时返回io.EOF
+		"data with EOF": func() io.Reader { return iotest.DataErrReader(bytes.NewReader(data)) },
+	}
+	for name, reader := range readers {
+		t.Run(name, func(t *testing.T) {
+			fr := NewFrameReader(reader(), proto, LatestVersion)
+			for i, want := range frames {
+				frame, err := fr.ReadFrame()
+				if err != nil {
+					t.Fatalf("frame %d: %v", i, err)
+				}
+				if frame.GetFrameType() != want.GetFrameType() {
+					t.Fatalf("frame %d = %s, want %s", i, frame.GetFrameType(), want.GetFrameType())
+				}
+				if recv, ok := frame.(*RecvPacket); ok && string(recv.Payload) != "world" {
+					t.Fatalf("RECV payload = %q", recv.Payload)
+				}
+			}
+			if _, err := fr.ReadFrame(); err != io.EOF {
+				t.Fatalf("err at frame boundary = %v, want io.EOF", err)
+			}
+		})
+	}
+}
+
+func TestFrameReaderErrors(t *testing.T) {
+	proto := New()
+	send := encodeFrames(t, proto, &SendPacket{ClientSeq: 1, ChannelID: "c", ChannelType: ChannelTypePerson, Payload: []byte("hello")})
+	tests := []struct {
+		name   string
+		proto  *MSProto
+		reader io.Reader
+		err    error
+	}{
+		{"malformed length", proto, bytes.NewReader([]byte{byte(SEND) << 4, 0xFF, 0xFF, 0xFF, 0xFF, 0x7F}), ErrMalformedLength},
+		{"EOF in header", proto, bytes.NewReader([]byte{byte(SEND) << 4, 0x80}), io.ErrUnexpectedEOF},
+		{"EOF in body", proto, iotest.OneByteReader(bytes.NewReader(send[:len(send)-1])), io.ErrUnexpectedEOF},
+		{"frame too large", New(WithMaxRemainingLength(8)), bytes.NewReader(send), ErrFrameTooLarge},
+		{"read error", proto, iotest.ErrReader(io.ErrClosedPipe), io.ErrClosedPipe},
+		{"no progress", proto, emptyReader{}, io.ErrNoProgress},
+		{"no progress in body", proto, io.MultiReader(bytes.NewReader(send[:3]), emptyReader{}), io.ErrNoProgress},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fr := NewFrameReader(tt.reader, tt.proto, LatestVersion)
+			if _, err := fr.ReadFrame(); !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			// 错误是持久的
+			if _, err := fr.ReadFrame(); !errors.Is(err, tt.err) {
+				t.Fatalf("second err = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestFrameReaderBufferReuse(t *testing.T) {
+	proto := New()
+	// 每个帧约1KB，缓冲区可以容纳3个多，读取过程中需要多次移动未消费的数据
+	frame := &SendPacket{ClientSeq: 1, ChannelID: "c", ChannelType: ChannelTypePerson, Payload: bytes.Repeat([]byte("x"), 1000)}
+	const count = 50
+	frames := make([]Frame, count)
+	for i := range frames {
+		frames[i] = frame
+	}
+	data := encodeFrames(t, proto, frames...)
+
+	fr := NewFrameReader(iotest.HalfReader(bytes.NewReader(data)), proto, LatestVersion)
+	for i := 0; i < count; i++ {
+		got, err := fr.ReadFrame()
+		if err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+		if !bytes.Equal(got.(*SendPacket).Payload, frame.Payload) {
+			t.Fatalf("frame %d payload corrupted", i)
+		}
+		if fr.start > fr.end || fr.end > len(fr.buf) {
+			t.Fatalf("frame %d: start %d end %d buf %d", i, fr.start, fr.end, len(fr.buf))
+		}
+	}
+	if len(fr.buf) != frameReaderBufferSize {
+		t.Fatalf("buffer grew to %d, want %d", len(fr.buf), frameReaderBufferSize)
+	}
+
+	// 超过缓冲区大小的帧使缓冲区扩容
+	large := &SendPacket{ClientSeq: 1, ChannelID: "c", ChannelType: ChannelTypePerson, Payload: bytes.Repeat([]byte("y"), 3*frameReaderBufferSize)}
+	fr = NewFrameReader(iotest.HalfReader(bytes.NewReader(encodeFrames(t, proto, frame, large, frame))), proto, LatestVersion)
+	for i, want := range []*SendPacket{frame, large, frame} {
+		got, err := fr.ReadFrame()
+		if err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+		if !bytes.Equal(got.(*SendPacket).Payload, want.Payload) {
+			t.Fatalf("frame %d payload corrupted", i)
+		}
+	}
+	if len(fr.buf) < 3*frameReaderBufferSize {
+		t.Fatalf("buffer size %d, want at least %d", len(fr.buf), 3*frameReaderBufferSize)
+	}
+	if fr.Buffered() != 0 {
+		t.Fatalf("Buffered = %d, want 0", fr.Buffered())
+	}
+}
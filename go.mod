@@ -3,6 +3,7 @@ module github.com/mushanyux/MSIMGoProto
 go 1.23
 
 require (
+	github.com/gorilla/websocket v1.5.3
 	github.com/pkg/errors v0.9.1
 	github.com/valyala/bytebufferpool v1.0.0
 )
@@ -0,0 +1,132 @@
+package keepalive
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock 时钟，测试时可以替换为ManualClock
+type Clock interface {
+	Now() time.Time
+	// AfterFunc 经过d之后在单独的goroutine（或者由时钟决定的goroutine）中调用f
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer AfterFunc返回的定时器
+type Timer interface {
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// SystemClock 系统时钟
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+// ManualClock 手动推进的时钟，到期的回调在Advance的调用者goroutine中执行
+type ManualClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*manualTimer
+}
+
+// NewManualClock 创建从now开始的手动时钟
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{now: now}
+}
+
+// Now 当前时间
+func (c *ManualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// AfterFunc 注册定时器
+func (c *ManualClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &manualTimer{clock: c, f: f}
+	c.schedule(t, d)
+	return t
+}
+
+// Advance 将时间推进d，并按到期时间依次执行到期的回调
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	end := c.now.Add(d)
+	for {
+		t := c.next(end)
+		if t == nil {
+			break
+		}
+		c.now = t.when
+		t.active = false
+		c.mu.Unlock()
+		t.f()
+		c.mu.Lock()
+	}
+	c.now = end
+	c.mu.Unlock()
+}
+
+// next 到期时间不晚于end的第一个定时器
+func (c *ManualClock) next(end time.Time) *manualTimer {
+	active := c.timers[:0]
+	for _, t := range c.timers {
+		if t.active {
+			active = append(active, t)
+		}
+	}
+	c.timers = active
+	sort.SliceStable(c.timers, func(i, j int) bool {
+		return c.timers[i].when.Before(c.timers[j].when)
+	})
+	if len(c.timers) == 0 || c.timers[0].when.After(end) {
+		return nil
+	}
+	return c.timers[0]
+}
+
+func (c *ManualClock) schedule(t *manualTimer, d time.Duration) {
+	t.when = c.now.Add(d)
+	t.active = true
+	for _, timer := range c.timers {
+		if timer == t {
+			return
+		}
+	}
+	c.timers = append(c.timers, t)
+}
+
+type manualTimer struct {
+	clock  *ManualClock
+	f      func()
+	when   time.Time
+	active bool
+}
+
+func (t *manualTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	active := t.active
+	t.active = false
+	return active
+}
+
+func (t *manualTimer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	active := t.active
+	t.clock.schedule(t, d)
+	return active
+}
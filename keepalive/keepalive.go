@@ -0,0 +1,265 @@
+// Package keepalive 基于PING/PONG的心跳以及空闲超时管理，客户端和服务端都可以使用
+package keepalive
+
+import (
+	"sync"
+	"time"
+
+	msproto "github.com/mushanyux/MSIMGoProto"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrPongTimeout 发送PING后没有在规定时间内收到PONG
+	ErrPongTimeout = errors.New("pong timeout")
+	// ErrIdleTimeout 规定时间内没有收到任何包
+	ErrIdleTimeout = errors.New("idle timeout")
+	// ErrStopped 心跳已停止
+	ErrStopped = errors.New("keepalive stopped")
+)
+
+// Conn 心跳管理的连接，client.Session和server.Conn都实现了此接口
+type Conn interface {
+	WriteFrame(frame msproto.Frame) error
+	Close() error
+}
+
+// Options 心跳配置
+type Options struct {
+	Interval    time.Duration      // 写空闲多久后发送PING，为0时不发送PING
+	Timeout     time.Duration      // 发送PING后等待PONG的时间
+	IdleTimeout time.Duration      // 读空闲多久后断开，为0时不检查
+	ReasonCode  msproto.ReasonCode // 超时断开时DisconnectPacket中的原因码
+	Clock       Clock              // 时钟
+	OnRTT       func(rtt time.Duration)
+	OnTimeout   func(err error) // 超时断开后回调
+}
+
+// NewOptions 默认配置
+func NewOptions() *Options {
+	return &Options{
+		Interval:   30 * time.Second,
+		Timeout:    10 * time.Second,
+		ReasonCode: msproto.ReasonSystemError,
+		Clock:      SystemClock,
+	}
+}
+
+type Option func(*Options)
+
+// WithInterval 写空闲多久后发送PING
+func WithInterval(interval time.Duration) Option {
+	return func(o *Options) {
+		o.Interval = interval
+	}
+}
+
+// WithTimeout 发送PING后等待PONG的时间
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *Options) {
+		o.Timeout = timeout
+	}
+}
+
+// WithIdleTimeout 读空闲多久后断开
+func WithIdleTimeout(timeout time.Duration) Option {
+	return func(o *Options) {
+		o.IdleTimeout = timeout
+	}
+}
+
+// WithReasonCode 超时断开时DisconnectPacket中的原因码
+func WithReasonCode(reasonCode msproto.ReasonCode) Option {
+	return func(o *Options) {
+		o.ReasonCode = reasonCode
+	}
+}
+
+// WithClock 时钟
+func WithClock(clock Clock) Option {
+	return func(o *Options) {
+		o.Clock = clock
+	}
+}
+
+// WithOnRTT 每次收到PONG后回调往返时间
+func WithOnRTT(onRTT func(rtt time.Duration)) Option {
+	return func(o *Options) {
+		o.OnRTT = onRTT
+	}
+}
+
+// WithOnTimeout 超时断开后回调
+func WithOnTimeout(onTimeout func(err error)) Option {
+	return func(o *Options) {
+		o.OnTimeout = onTimeout
+	}
+}
+
+// Keepalive 心跳管理
+// 所有发送都应当经过WriteFrame（或者发送后调用MarkWrite），收到的每个包都应当交给HandleFrame
+type Keepalive struct {
+	conn Conn
+	opts *Options
+
+	mu          sync.Mutex
+	pingTimer   Timer
+	pongTimer   Timer
+	idleTimer   Timer
+	pingSentAt  time.Time
+	waitingPong bool
+	rtt         time.Duration
+	stopped     bool
+	err         error
+	done        chan struct{}
+}
+
+// New 创建并启动心跳管理
+func New(conn Conn, opts ...Option) *Keepalive {
+	o := NewOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.Clock == nil {
+		o.Clock = SystemClock
+	}
+	k := &Keepalive{
+		conn: conn,
+		opts: o,
+		done: make(chan struct{}),
+	}
+	k.mu.Lock()
+	if o.Interval > 0 {
+		k.pingTimer = o.Clock.AfterFunc(o.Interval, k.ping)
+	}
+	if o.IdleTimeout > 0 {
+		k.idleTimer = o.Clock.AfterFunc(o.IdleTimeout, func() {
+			k.fail(ErrIdleTimeout)
+		})
+	}
+	k.mu.Unlock()
+	return k
+}
+
+// WriteFrame 发送包并记录写活动
+func (k *Keepalive) WriteFrame(frame msproto.Frame) error {
+	if err := k.conn.WriteFrame(frame); err != nil {
+		return err
+	}
+	k.MarkWrite()
+	return nil
+}
+
+// MarkWrite 记录写活动，推迟下一次PING
+func (k *Keepalive) MarkWrite() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.stopped || k.pingTimer == nil || k.waitingPong {
+		return
+	}
+	k.pingTimer.Reset(k.opts.Interval)
+}
+
+// HandleFrame 记录读活动，收到PONG时计算往返时间
+func (k *Keepalive) HandleFrame(frame msproto.Frame) {
+	k.mu.Lock()
+	if k.stopped {
+		k.mu.Unlock()
+		return
+	}
+	if k.idleTimer != nil {
+		k.idleTimer.Reset(k.opts.IdleTimeout)
+	}
+	if frame == nil || frame.GetFrameType() != msproto.PONG || !k.waitingPong {
+		k.mu.Unlock()
+		return
+	}
+	k.waitingPong = false
+	k.pongTimer.Stop()
+	k.rtt = k.opts.Clock.Now().Sub(k.pingSentAt)
+	rtt := k.rtt
+	k.pingTimer.Reset(k.opts.Interval)
+	k.mu.Unlock()
+
+	if k.opts.OnRTT != nil {
+		k.opts.OnRTT(rtt)
+	}
+}
+
+// RTT 最近一次PING/PONG的往返时间
+func (k *Keepalive) RTT() time.Duration {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.rtt
+}
+
+// Done 心跳停止后关闭
+func (k *Keepalive) Done() <-chan struct{} {
+	return k.done
+}
+
+// Err 心跳停止的原因
+func (k *Keepalive) Err() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.err
+}
+
+// Stop 停止心跳，不会关闭连接
+func (k *Keepalive) Stop() {
+	k.stop(ErrStopped)
+}
+
+// ping 写空闲后发送PING并等待PONG
+func (k *Keepalive) ping() {
+	k.mu.Lock()
+	if k.stopped || k.waitingPong {
+		k.mu.Unlock()
+		return
+	}
+	k.waitingPong = true
+	k.pingSentAt = k.opts.Clock.Now()
+	if k.pongTimer == nil {
+		k.pongTimer = k.opts.Clock.AfterFunc(k.opts.Timeout, func() {
+			k.fail(ErrPongTimeout)
+		})
+	} else {
+		k.pongTimer.Reset(k.opts.Timeout)
+	}
+	k.mu.Unlock()
+
+	// 写失败时等待PONG超时
+	_ = k.conn.WriteFrame(&msproto.PingPacket{})
+}
+
+// fail 超时后发送DISCONNECT并关闭连接
+func (k *Keepalive) fail(err error) {
+	if !k.stop(err) {
+		return
+	}
+	_ = k.conn.WriteFrame(&msproto.DisconnectPacket{
+		ReasonCode: k.opts.ReasonCode,
+		Reason:     err.Error(),
+	})
+	_ = k.conn.Close()
+	if k.opts.OnTimeout != nil {
+		k.opts.OnTimeout(err)
+	}
+}
+
+func (k *Keepalive) stop(err error) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.stopped {
+		return false
+	}
+	k.stopped = true
+	k.err = err
+	for _, t := range []Timer{k.pingTimer, k.pongTimer, k.idleTimer} {
+		if t != nil {
+			t.Stop()
+		}
+	}
+	close(k.done)
+	return true
+}
@@ -0,0 +1,196 @@
+package keepalive_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	msproto "github.com/mushanyux/MSIMGoProto"
+	"github.com/mushanyux/MSIMGoProto/keepalive"
+)
+
+// recordConn 记录写入的包
+type recordConn struct {
+	mu     sync.Mutex
+	frames []msproto.Frame
+	closed bool
+}
+
+func (c *recordConn) WriteFrame(frame msproto.Frame) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.frames = append(c.frames, frame)
+	return nil
+}
+
+func (c *recordConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+func (c *recordConn) frameTypes() []msproto.FrameType {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	types := make([]msproto.FrameType, 0, len(c.frames))
+	for _, frame := range c.frames {
+		types = append(types, frame.GetFrameType())
+	}
+	return types
+}
+
+func (c *recordConn) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+func (c *recordConn) count(frameType msproto.FrameType) int {
+	n := 0
+	for _, t := range c.frameTypes() {
+		if t == frameType {
+			n++
+		}
+	}
+	return n
+}
+
+func isDone(k *keepalive.Keepalive) bool {
+	select {
+	case <-k.Done():
+		return true
+	default:
+		return false
+	}
+}
+
+func TestPingAfterWriteIdle(t *testing.T) {
+	clock := keepalive.NewManualClock(time.Unix(0, 0))
+	conn := &recordConn{}
+	var rtts []time.Duration
+	k := keepalive.New(conn,
+		keepalive.WithClock(clock),
+		keepalive.WithInterval(10*time.Second),
+		keepalive.WithTimeout(3*time.Second),
+		keepalive.WithOnRTT(func(rtt time.Duration) {
+			rtts = append(rtts, rtt)
+		}),
+	)
+	defer k.Stop()
+
+	// 写活动推迟PING
+	clock.Advance(5 * time.Second)
+	if err := k.WriteFrame(&msproto.SendPacket{ChannelID: "u1", ChannelType: 1}); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(9 * time.Second)
+	if n := conn.count(msproto.PING); n != 0 {
+		t.Fatalf("%d PINGs 9s after the last write, want 0", n)
+	}
+	clock.Advance(time.Second)
+	if n := conn.count(msproto.PING); n != 1 {
+		t.Fatalf("%d PINGs 10s after the last write, want 1", n)
+	}
+
+	clock.Advance(2 * time.Second)
+	k.HandleFrame(&msproto.PongPacket{})
+	if k.RTT() != 2*time.Second || len(rtts) != 1 || rtts[0] != 2*time.Second {
+		t.Fatalf("RTT = %v, OnRTT = %v, want 2s", k.RTT(), rtts)
+	}
+
+	// 收到PONG后重新开始计时，不会因为PONG超时断开
+	clock.Advance(10 * time.Second)
+	if n := conn.count(msproto.PING); n != 2 {
+		t.Fatalf("%d PINGs after the second interval, want 2", n)
+	}
+	if isDone(k) || conn.isClosed() {
+		t.Fatal("keepalive stopped although every PING was answered")
+	}
+}
+
+func TestPongTimeout(t *testing.T) {
+	clock := keepalive.NewManualClock(time.Unix(0, 0))
+	conn := &recordConn{}
+	var timeoutErr error
+	k := keepalive.New(conn,
+		keepalive.WithClock(clock),
+		keepalive.WithInterval(10*time.Second),
+		keepalive.WithTimeout(3*time.Second),
+		keepalive.WithReasonCode(msproto.ReasonConnectKick),
+		keepalive.WithOnTimeout(func(err error) {
+			timeoutErr = err
+		}),
+	)
+
+	clock.Advance(12 * time.Second)
+	if isDone(k) {
+		t.Fatal("stopped before the PONG timeout")
+	}
+	// 其它包不能代替PONG
+	k.HandleFrame(&msproto.RecvPacket{})
+	clock.Advance(time.Second)
+
+	if !isDone(k) {
+		t.Fatal("not stopped after the PONG timeout")
+	}
+	if !errors.Is(k.Err(), keepalive.ErrPongTimeout) || !errors.Is(timeoutErr, keepalive.ErrPongTimeout) {
+		t.Errorf("Err = %v, OnTimeout = %v, want ErrPongTimeout", k.Err(), timeoutErr)
+	}
+	types := conn.frameTypes()
+	if len(types) != 2 || types[0] != msproto.PING || types[1] != msproto.DISCONNECT {
+		t.Fatalf("frames = %v, want [PING DISCONNECT]", types)
+	}
+	conn.mu.Lock()
+	disconnect := conn.frames[1].(*msproto.DisconnectPacket)
+	conn.mu.Unlock()
+	if disconnect.ReasonCode != msproto.ReasonConnectKick {
+		t.Errorf("DISCONNECT ReasonCode = %s, want %s", disconnect.ReasonCode, msproto.ReasonConnectKick)
+	}
+	if !conn.isClosed() {
+		t.Error("conn not closed after the PONG timeout")
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	clock := keepalive.NewManualClock(time.Unix(0, 0))
+	conn := &recordConn{}
+	k := keepalive.New(conn,
+		keepalive.WithClock(clock),
+		keepalive.WithInterval(0),
+		keepalive.WithIdleTimeout(5*time.Second),
+	)
+
+	clock.Advance(4 * time.Second)
+	k.HandleFrame(&msproto.PingPacket{})
+	clock.Advance(4 * time.Second)
+	if isDone(k) {
+		t.Fatal("idle timeout fired although a frame was read 4s ago")
+	}
+	clock.Advance(time.Second)
+	if !errors.Is(k.Err(), keepalive.ErrIdleTimeout) {
+		t.Fatalf("Err = %v, want ErrIdleTimeout", k.Err())
+	}
+	if !conn.isClosed() {
+		t.Error("conn not closed after the idle timeout")
+	}
+	if n := conn.count(msproto.PING); n != 0 {
+		t.Errorf("%d PINGs with Interval 0, want 0", n)
+	}
+}
+
+func TestStop(t *testing.T) {
+	clock := keepalive.NewManualClock(time.Unix(0, 0))
+	conn := &recordConn{}
+	k := keepalive.New(conn, keepalive.WithClock(clock), keepalive.WithIdleTimeout(time.Second))
+	k.Stop()
+	clock.Advance(time.Minute)
+
+	if !errors.Is(k.Err(), keepalive.ErrStopped) {
+		t.Errorf("Err = %v, want ErrStopped", k.Err())
+	}
+	if types := conn.frameTypes(); len(types) != 0 || conn.isClosed() {
+		t.Errorf("frames = %v, closed = %v after Stop, want no activity", types, conn.isClosed())
+	}
+}
@@ -0,0 +1,69 @@
+package msproto
+
+// Options 协议对象的编解码配置
+type Options struct {
+	MaxRemainingLength uint32 // 最大剩余长度
+	MaxPayloadSize     int    // SEND和RECV的最大负载大小，编码时检查
+	DecodePayloadLimit bool   // 解码时同样检查MaxPayloadSize，默认不检查
+	MinVersion         uint8  // 支持的最低协议版本
+	MaxVersion         uint8  // 支持的最高协议版本
+	Strict             bool   // 严格模式，包体必须被完整解码且不允许有多余的字节
+	CopyPayload        bool   // 解码时复制包体，解码出的[]byte字段不再引用输入数据
+}
+
+// NewOptions 默认配置
+func NewOptions() *Options {
+	return &Options{
+		MaxRemainingLength: MaxRemaingLength,
+		MaxPayloadSize:     PayloadMaxSize,
+		MinVersion:         0,
+		MaxVersion:         LatestVersion,
+	}
+}
+
+var defaultOptions = NewOptions()
+
+type Option func(*Options)
+
+// WithMaxRemainingLength 最大剩余长度
+func WithMaxRemainingLength(maxRemainingLength uint32) Option {
+	return func(o *Options) {
+		o.MaxRemainingLength = maxRemainingLength
+	}
+}
+
+// WithMaxPayloadSize 最大负载大小
+func WithMaxPayloadSize(maxPayloadSize int) Option {
+	return func(o *Options) {
+		o.MaxPayloadSize = maxPayloadSize
+	}
+}
+
+// WithDecodePayloadLimit 解码时是否检查MaxPayloadSize
+func WithDecodePayloadLimit(decodePayloadLimit bool) Option {
+	return func(o *Options) {
+		o.DecodePayloadLimit = decodePayloadLimit
+	}
+}
+
+// WithVersionRange 支持的协议版本范围
+func WithVersionRange(minVersion, maxVersion uint8) Option {
+	return func(o *Options) {
+		o.MinVersion = minVersion
+		o.MaxVersion = maxVersion
+	}
+}
+
+// WithStrict 是否开启严格模式
+func WithStrict(strict bool) Option {
+	return func(o *Options) {
+		o.Strict = strict
+	}
+}
+
+// WithCopyPayload 解码时是否复制包体
+func WithCopyPayload(copyPayload bool) Option {
+	return func(o *Options) {
+		o.CopyPayload = copyPayload
+	}
+}
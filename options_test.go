@@ -0,0 +1,118 @@
+package msproto
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestOptionLimits(t *testing.T) {
+	payload := func(n int) []byte { return bytes.Repeat([]byte("x"), n) }
+	send := func(n int) Frame {
+		return &SendPacket{ClientSeq: 1, ChannelID: "c", ChannelType: ChannelTypePerson, Payload: payload(n)}
+	}
+	recv := func(n int) Frame {
+		return &RecvPacket{MessageID: 1, ChannelID: "c", ChannelType: ChannelTypePerson, Payload: payload(n)}
+	}
+	tests := []struct {
+		name      string
+		opts      []Option
+		frame     Frame
+		version   uint8
+		encodeErr error
+		decodeErr error
+	}{
+		{"default", nil, send(PayloadMaxSize), LatestVersion, nil, nil},
+		{"remaining length within limit", []Option{WithMaxRemainingLength(64)}, send(10), LatestVersion, nil, nil},
+		{"remaining length over limit", []Option{WithMaxRemainingLength(64)}, send(64), LatestVersion, ErrFrameTooLarge, ErrFrameTooLarge},
+		{"SEND payload over default limit", nil, send(PayloadMaxSize + 1), LatestVersion, ErrPayloadTooLarge, nil},
+		{"RECV payload over default limit", nil, recv(PayloadMaxSize + 1), LatestVersion, ErrPayloadTooLarge, nil},
+		{"SEND payload over limit", []Option{WithMaxPayloadSize(8)}, send(9), LatestVersion, ErrPayloadTooLarge, nil},
+		{"RECV payload over limit", []Option{WithMaxPayloadSize(8)}, recv(9), LatestVersion, ErrPayloadTooLarge, nil},
+		{"SEND payload at limit", []Option{WithMaxPayloadSize(8), WithDecodePayloadLimit(true)}, send(8), LatestVersion, nil, nil},
+		{"SEND payload over decode limit", []Option{WithMaxPayloadSize(8), WithDecodePayloadLimit(true)}, send(9), LatestVersion, ErrPayloadTooLarge, ErrPayloadTooLarge},
+		{"RECV payload over decode limit", []Option{WithMaxPayloadSize(8), WithDecodePayloadLimit(true)}, recv(9), LatestVersion, ErrPayloadTooLarge, ErrPayloadTooLarge},
+		{"version below range", []Option{WithVersionRange(4, LatestVersion)}, send(1), 3, ErrUnsupportedVersion, ErrUnsupportedVersion},
+		{"version above range", []Option{WithVersionRange(0, 4)}, send(1), 5, ErrUnsupportedVersion, ErrUnsupportedVersion},
+		{"version in range", []Option{WithVersionRange(4, 4)}, send(1), 4, nil, nil},
+	}
+	permissive := New(WithMaxPayloadSize(1 << 20))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proto := New(tt.opts...)
+			_, err := proto.EncodeFrame(tt.frame, tt.version)
+			if !errors.Is(err, tt.encodeErr) {
+				t.Fatalf("EncodeFrame err = %v, want %v", err, tt.encodeErr)
+			}
+
+			// 由不限制的协议对象编码，检查解码时的限制
+			data, err := permissive.EncodeFrame(tt.frame, tt.version)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err = proto.DecodeFrame(data, tt.version); !errors.Is(err, tt.decodeErr) {
+				t.Fatalf("DecodeFrame err = %v, want %v", err, tt.decodeErr)
+			}
+			if _, err = proto.DecodeFrameInto(data, newFrame(tt.frame.GetFrameType()), tt.version); !errors.Is(err, tt.decodeErr) {
+				t.Fatalf("DecodeFrameInto err = %v, want %v", err, tt.decodeErr)
+			}
+			if _, err = NewFrameReader(bytes.NewReader(data), proto, tt.version).ReadFrame(); !errors.Is(err, tt.decodeErr) {
+				t.Fatalf("ReadFrame err = %v, want %v", err, tt.decodeErr)
+			}
+		})
+	}
+}
+
+func TestOptionStrict(t *testing.T) {
+	data, err := New().EncodeFrame(&RecvackPacket{MessageID: 1, MessageSeq: 2}, LatestVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 包体末尾多一个字节
+	trailing := append([]byte{data[0], data[1] + 1}, data[2:]...)
+	trailing = append(trailing, 0)
+
+	for _, strict := range []bool{false, true} {
+		proto := New(WithStrict(strict))
+		var want error
+		if strict {
+			want = ErrTrailingBytes
+		}
+		if _, _, err = proto.DecodeFrame(trailing, LatestVersion); !errors.Is(err, want) {
+			t.Errorf("strict %v: DecodeFrame err = %v, want %v", strict, err, want)
+		}
+		if _, err = proto.DecodeFrameInto(trailing, &RecvackPacket{}, LatestVersion); !errors.Is(err, want) {
+			t.Errorf("strict %v: DecodeFrameInto err = %v, want %v", strict, err, want)
+		}
+		// 编码不受严格模式影响
+		if _, _, err = proto.DecodeFrame(data, LatestVersion); err != nil {
+			t.Errorf("strict %v: %v", strict, err)
+		}
+		if _, err = proto.EncodeFrame(&RecvackPacket{MessageID: 1}, LatestVersion); err != nil {
+			t.Errorf("strict %v: EncodeFrame err = %v", strict, err)
+		}
+	}
+}
+
+func TestOptionCopyPayload(t *testing.T) {
+	data, err := New().EncodeFrame(&SendPacket{ClientSeq: 1, ChannelID: "c", ChannelType: ChannelTypePerson, Payload: []byte("hello")}, LatestVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, copyPayload := range []bool{false, true} {
+		buf := append([]byte(nil), data...)
+		frame, _, err := New(WithCopyPayload(copyPayload)).DecodeFrame(buf, LatestVersion)
+		if err != nil {
+			t.Fatal(err)
+		}
+		copy(buf[len(buf)-5:], "world")
+		want := "world"
+		if copyPayload {
+			want = "hello"
+		}
+		if got := string(frame.(*SendPacket).Payload); got != want {
+			t.Errorf("CopyPayload %v: payload = %q after the input changed, want %q", copyPayload, got, want)
+		}
+	}
+}
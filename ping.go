@@ -5,6 +5,11 @@ type PingPacket struct {
 	Framer
 }
 
+// Reset 重置包，用于复用
+func (p *PingPacket) Reset() {
+	p.Framer = Framer{}
+}
+
 // GetFrameType 包类型
 func (p *PingPacket) GetFrameType() FrameType {
 	return PING
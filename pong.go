@@ -5,6 +5,11 @@ type PongPacket struct {
 	Framer
 }
 
+// Reset 重置包，用于复用
+func (p *PongPacket) Reset() {
+	p.Framer = Framer{}
+}
+
 // GetFrameType 包类型
 func (p *PongPacket) GetFrameType() FrameType {
 	return PONG
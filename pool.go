@@ -0,0 +1,196 @@
+package msproto
+
+import "sync"
+
+// 各类型包的对象池，用于热路径上复用包对象
+var (
+	connectPacketPool    = sync.Pool{New: func() any { return &ConnectPacket{} }}
+	connackPacketPool    = sync.Pool{New: func() any { return &ConnackPacket{} }}
+	sendPacketPool       = sync.Pool{New: func() any { return &SendPacket{} }}
+	sendackPacketPool    = sync.Pool{New: func() any { return &SendackPacket{} }}
+	recvPacketPool       = sync.Pool{New: func() any { return &RecvPacket{} }}
+	recvackPacketPool    = sync.Pool{New: func() any { return &RecvackPacket{} }}
+	pingPacketPool       = sync.Pool{New: func() any { return &PingPacket{} }}
+	pongPacketPool       = sync.Pool{New: func() any { return &PongPacket{} }}
+	disconnectPacketPool = sync.Pool{New: func() any { return &DisconnectPacket{} }}
+	subPacketPool        = sync.Pool{New: func() any { return &SubPacket{} }}
+	subackPacketPool     = sync.Pool{New: func() any { return &SubackPacket{} }}
+)
+
+// AcquireConnectPacket 从对象池获取ConnectPacket
+func AcquireConnectPacket() *ConnectPacket {
+	return connectPacketPool.Get().(*ConnectPacket)
+}
+
+// ReleaseConnectPacket 重置后放回对象池，放回后不能再使用
+func ReleaseConnectPacket(p *ConnectPacket) {
+	p.Reset()
+	connectPacketPool.Put(p)
+}
+
+// AcquireConnackPacket 从对象池获取ConnackPacket
+func AcquireConnackPacket() *ConnackPacket {
+	return connackPacketPool.Get().(*ConnackPacket)
+}
+
+// ReleaseConnackPacket 重置后放回对象池，放回后不能再使用
+func ReleaseConnackPacket(p *ConnackPacket) {
+	p.Reset()
+	connackPacketPool.Put(p)
+}
+
+// AcquireSendPacket 从对象池获取SendPacket
+func AcquireSendPacket() *SendPacket {
+	return sendPacketPool.Get().(*SendPacket)
+}
+
+// ReleaseSendPacket 重置后放回对象池，放回后不能再使用
+func ReleaseSendPacket(p *SendPacket) {
+	p.Reset()
+	sendPacketPool.Put(p)
+}
+
+// AcquireSendackPacket 从对象池获取SendackPacket
+func AcquireSendackPacket() *SendackPacket {
+	return sendackPacketPool.Get().(*SendackPacket)
+}
+
+// ReleaseSendackPacket 重置后放回对象池，放回后不能再使用
+func ReleaseSendackPacket(p *SendackPacket) {
+	p.Reset()
+	sendackPacketPool.Put(p)
+}
+
+// AcquireRecvPacket 从对象池获取RecvPacket
+func AcquireRecvPacket() *RecvPacket {
+	return recvPacketPool.Get().(*RecvPacket)
+}
+
+// ReleaseRecvPacket 重置后放回对象池，放回后不能再使用
+func ReleaseRecvPacket(p *RecvPacket) {
+	p.Reset()
+	recvPacketPool.Put(p)
+}
+
+// AcquireRecvackPacket 从对象池获取RecvackPacket
+func AcquireRecvackPacket() *RecvackPacket {
+	return recvackPacketPool.Get().(*RecvackPacket)
+}
+
+// ReleaseRecvackPacket 重置后放回对象池，放回后不能再使用
+func ReleaseRecvackPacket(p *RecvackPacket) {
+	p.Reset()
+	recvackPacketPool.Put(p)
+}
+
+// AcquirePingPacket 从对象池获取PingPacket
+func AcquirePingPacket() *PingPacket {
+	return pingPacketPool.Get().(*PingPacket)
+}
+
+// ReleasePingPacket 重置后放回对象池，放回后不能再使用
+func ReleasePingPacket(p *PingPacket) {
+	p.Reset()
+	pingPacketPool.Put(p)
+}
+
+// AcquirePongPacket 从对象池获取PongPacket
+func AcquirePongPacket() *PongPacket {
+	return pongPacketPool.Get().(*PongPacket)
+}
+
+// ReleasePongPacket 重置后放回对象池，放回后不能再使用
+func ReleasePongPacket(p *PongPacket) {
+	p.Reset()
+	pongPacketPool.Put(p)
+}
+
+// AcquireDisconnectPacket 从对象池获取DisconnectPacket
+func AcquireDisconnectPacket() *DisconnectPacket {
+	return disconnectPacketPool.Get().(*DisconnectPacket)
+}
+
+// ReleaseDisconnectPacket 重置后放回对象池，放回后不能再使用
+func ReleaseDisconnectPacket(p *DisconnectPacket) {
+	p.Reset()
+	disconnectPacketPool.Put(p)
+}
+
+// AcquireSubPacket 从对象池获取SubPacket
+func AcquireSubPacket() *SubPacket {
+	return subPacketPool.Get().(*SubPacket)
+}
+
+// ReleaseSubPacket 重置后放回对象池，放回后不能再使用
+func ReleaseSubPacket(p *SubPacket) {
+	p.Reset()
+	subPacketPool.Put(p)
+}
+
+// AcquireSubackPacket 从对象池获取SubackPacket
+func AcquireSubackPacket() *SubackPacket {
+	return subackPacketPool.Get().(*SubackPacket)
+}
+
+// ReleaseSubackPacket 重置后放回对象池，放回后不能再使用
+func ReleaseSubackPacket(p *SubackPacket) {
+	p.Reset()
+	subackPacketPool.Put(p)
+}
+
+// AcquireFrame 根据包类型从对象池获取包，不支持的包类型返回nil
+func AcquireFrame(frameType FrameType) Frame {
+	switch frameType {
+	case CONNECT:
+		return AcquireConnectPacket()
+	case CONNACK:
+		return AcquireConnackPacket()
+	case SEND:
+		return AcquireSendPacket()
+	case SENDACK:
+		return AcquireSendackPacket()
+	case RECV:
+		return AcquireRecvPacket()
+	case RECVACK:
+		return AcquireRecvackPacket()
+	case PING:
+		return AcquirePingPacket()
+	case PONG:
+		return AcquirePongPacket()
+	case DISCONNECT:
+		return AcquireDisconnectPacket()
+	case SUB:
+		return AcquireSubPacket()
+	case SUBACK:
+		return AcquireSubackPacket()
+	}
+	return nil
+}
+
+// ReleaseFrame 将AcquireFrame获取的包放回对象池
+func ReleaseFrame(frame Frame) {
+	switch packet := frame.(type) {
+	case *ConnectPacket:
+		ReleaseConnectPacket(packet)
+	case *ConnackPacket:
+		ReleaseConnackPacket(packet)
+	case *SendPacket:
+		ReleaseSendPacket(packet)
+	case *SendackPacket:
+		ReleaseSendackPacket(packet)
+	case *RecvPacket:
+		ReleaseRecvPacket(packet)
+	case *RecvackPacket:
+		ReleaseRecvackPacket(packet)
+	case *PingPacket:
+		ReleasePingPacket(packet)
+	case *PongPacket:
+		ReleasePongPacket(packet)
+	case *DisconnectPacket:
+		ReleaseDisconnectPacket(packet)
+	case *SubPacket:
+		ReleaseSubPacket(packet)
+	case *SubackPacket:
+		ReleaseSubackPacket(packet)
+	}
+}
@@ -0,0 +1,123 @@
+package msproto
+
+import (
+	"bytes"
+	"testing"
+)
+
+func decodeIntoFixtures(t testing.TB) map[string]struct {
+	data  []byte
+	frame func() Frame
+} {
+	proto := New()
+	recv, err := proto.EncodeFrame(&RecvPacket{
+		Setting:     SettingReceiptEnabled,
+		MsgKey:      "msgkey",
+		MessageID:   123456789,
+		MessageSeq:  42,
+		ClientMsgNo: "client-msg-no",
+		Timestamp:   1700000000,
+		FromUID:     "from",
+		ChannelID:   "channel",
+		ChannelType: ChannelTypePerson,
+		Payload:     []byte("hello world"),
+	}, LatestVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	send, err := proto.EncodeFrame(&SendPacket{
+		Setting:     SettingReceiptEnabled,
+		MsgKey:      "msgkey",
+		ClientSeq:   1 << 40,
+		ClientMsgNo: "client-msg-no",
+		ChannelID:   "channel",
+		ChannelType: ChannelTypePerson,
+		Payload:     []byte("hello world"),
+	}, LatestVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]struct {
+		data  []byte
+		frame func() Frame
+	}{
+		"RECV": {recv, func() Frame { return AcquireRecvPacket() }},
+		"SEND": {send, func() Frame { return AcquireSendPacket() }},
+	}
+}
+
+func TestDecodeFrameIntoAllocs(t *testing.T) {
+	proto := New()
+	for name, fixture := range decodeIntoFixtures(t) {
+		t.Run(name, func(t *testing.T) {
+			frame := fixture.frame()
+			defer ReleaseFrame(frame)
+			allocs := testing.AllocsPerRun(1000, func() {
+				if _, err := proto.DecodeFrameInto(fixture.data, frame, LatestVersion); err != nil {
+					t.Fatal(err)
+				}
+			})
+			if allocs != 0 {
+				t.Fatalf("DecodeFrameInto %s: %v allocs/op, want 0", name, allocs)
+			}
+		})
+	}
+}
+
+func BenchmarkDecodeFrameInto(b *testing.B) {
+	proto := New()
+	for name, fixture := range decodeIntoFixtures(b) {
+		b.Run(name, func(b *testing.B) {
+			frame := fixture.frame()
+			defer ReleaseFrame(frame)
+			b.ReportAllocs()
+			b.SetBytes(int64(len(fixture.data)))
+			for i := 0; i < b.N; i++ {
+				if _, err := proto.DecodeFrameInto(fixture.data, frame, LatestVersion); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkDecodeFrame(b *testing.B) {
+	proto := New()
+	for name, fixture := range decodeIntoFixtures(b) {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(fixture.data)))
+			for i := 0; i < b.N; i++ {
+				if _, _, err := proto.DecodeFrame(fixture.data, LatestVersion); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeFrameIntoAliasesInput(t *testing.T) {
+	data, err := New().EncodeFrame(&SendPacket{ClientSeq: 1, ClientMsgNo: "m1", ChannelID: "c1", ChannelType: ChannelTypePerson, Payload: []byte("p1")}, LatestVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, copyPayload := range []bool{false, true} {
+		buf := append([]byte(nil), data...)
+		packet := AcquireSendPacket()
+		if _, err = New(WithCopyPayload(copyPayload)).DecodeFrameInto(buf, packet, LatestVersion); err != nil {
+			t.Fatal(err)
+		}
+		clientMsgNo := packet.ClientMsgNo
+		// 复用读缓冲区，不开启CopyPayload时已解码的字符串和Payload随之改变
+		copy(buf, bytes.ReplaceAll(bytes.ReplaceAll(buf, []byte("m1"), []byte("m2")), []byte("p1"), []byte("p2")))
+
+		want, wantPayload := "m2", "p2"
+		if copyPayload {
+			want, wantPayload = "m1", "p1"
+		}
+		if clientMsgNo != want || string(packet.Payload) != wantPayload {
+			t.Errorf("CopyPayload %v: ClientMsgNo %q Payload %q after the input changed, want %q %q", copyPayload, clientMsgNo, packet.Payload, want, wantPayload)
+		}
+		ReleaseFrame(packet)
+	}
+}
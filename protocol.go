@@ -2,19 +2,14 @@ package msproto
 
 import (
 	"bytes"
-	"fmt"
 	"io"
 	"math"
+	"reflect"
 	"sync"
 
 	"github.com/pkg/errors"
 )
 
-var (
-	// 长度不够
-	errDecodeLength = errors.New("decode length error")
-)
-
 // Protocol Protocol
 type Protocol interface {
 	// DecodeFrame 解码消息 返回frame 和 数据大小 和 error
@@ -28,10 +23,12 @@ type Protocol interface {
 // WKroto 悟空IM协议对象
 type MSProto struct {
 	sync.RWMutex
+	codecs [MaxFrameType + 1]*frameCodec // 自定义包类型
+	opts   *Options
 }
 
 // LatestVersion 最新版本
-const LatestVersion = 4
+const LatestVersion = 6
 
 // MaxRemaingLength 最大剩余长度 // 1<<28 - 1
 const MaxRemaingLength uint32 = 1024 * 1024
@@ -40,105 +37,256 @@ const MaxRemaingLength uint32 = 1024 * 1024
 const PayloadMaxSize = math.MaxInt16
 
 // New 创建协议对象
-func New() *MSProto {
-	return &MSProto{}
+func New(opts ...Option) *MSProto {
+	o := NewOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+	return &MSProto{
+		opts: o,
+	}
+}
+
+// Options 协议对象的配置
+func (l *MSProto) Options() *Options {
+	if l.opts == nil {
+		return defaultOptions
+	}
+	return l.opts
 }
 
 // PacketDecodeFunc 包解码函数
 type PacketDecodeFunc func(frame Frame, remainingBytes []byte, version uint8) (Frame, error)
 
-// PacketEncodeFunc 包编码函数
-type PacketEncodeFunc func(frame Frame, version uint8) ([]byte, error)
-
-var packetDecodeMap = map[FrameType]PacketDecodeFunc{
-	CONNECT:    decodeConnect,
-	CONNACK:    decodeConnack,
-	SEND:       decodeSend,
-	SENDACK:    decodeSendack,
-	RECV:       decodeRecv,
-	RECVACK:    decodeRecvack,
-	DISCONNECT: decodeDisConnect,
-	SUB:        decodeSub,
-	SUBACK:     decodeSuback,
-}
+// PacketEncodeFunc 包编码函数，将包体（不含固定报头）写入enc
+type PacketEncodeFunc func(frame Frame, enc *Encoder, version uint8) error
+
+// PacketSizeFunc 包体大小计算函数，返回值即固定报头中的剩余长度
+type PacketSizeFunc func(frame Frame, version uint8) int
 
 // DecodePacketWithConn 解码包
 func (l *MSProto) DecodePacketWithConn(conn io.Reader, version uint8) (Frame, error) {
+	if conn == nil {
+		return nil, errors.New("conn is nil")
+	}
+	if err := l.checkVersion(version); err != nil {
+		return nil, err
+	}
 	framer, err := l.decodeFramerWithConn(conn)
 	if err != nil {
 		return nil, err
 	}
 	// l.Debug("解码消息！", zap.String("framer", framer.String()))
-	if framer.GetFrameType() == PING {
-		return &PingPacket{}, nil
-	}
-	if framer.GetFrameType() == PONG {
-		return &PongPacket{}, nil
+	if framer.GetFrameType() == PING || framer.GetFrameType() == PONG {
+		return l.decodePacket(framer, nil, version)
 	}
-	if framer.RemainingLength > MaxRemaingLength {
-		return nil, errors.New(fmt.Sprintf("消息超出最大限制[%d]！", MaxRemaingLength))
-		// panic(errors.New(fmt.Sprintf("消息超出最大限制[%d]！", MaxRemaingLength)))
+	if err = l.checkRemainingLength(framer.RemainingLength); err != nil {
+		return nil, err
 	}
 
 	body := make([]byte, framer.RemainingLength)
 	_, err = io.ReadFull(conn, body)
 	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
 		return nil, err
 	}
-	decodeFunc := packetDecodeMap[framer.GetFrameType()]
-	if decodeFunc == nil {
-		return nil, errors.New(fmt.Sprintf("不支持对[%s]包的解码！", framer.GetFrameType()))
-	}
-
-	frame, err := decodeFunc(framer, body, version)
-	if err != nil {
-		return nil, errors.Wrap(err, fmt.Sprintf("解码包[%s]失败！", framer.GetFrameType()))
-	}
-	return frame, nil
+	return l.decodePacket(framer, body, version)
 }
 
-// DecodePacket 解码包
+// DecodeFrame 解码包
+// 数据不足一个完整报文时返回ErrIncomplete，调用方应读取更多数据后重试；其他错误说明数据流已损坏
 func (l *MSProto) DecodeFrame(data []byte, version uint8) (Frame, int, error) {
+	if err := l.checkVersion(version); err != nil {
+		return nil, 0, err
+	}
 	framer, remainingLengthLength, err := l.decodeFramer(data)
 	if err != nil {
-		return nil, 0, nil
+		return nil, 0, err
 	}
 	frameType := framer.GetFrameType()
-	if frameType == UNKNOWN {
-		return nil, 0, nil
+	if frameType == PING || frameType == PONG {
+		frame, err := l.decodePacket(framer, nil, version)
+		if err != nil {
+			return nil, 0, err
+		}
+		return frame, 1, nil
+	}
+
+	if err = l.checkRemainingLength(framer.RemainingLength); err != nil {
+		return nil, 0, err
+	}
+	msgLen := int(framer.RemainingLength) + 1 + remainingLengthLength
+	if len(data) < msgLen {
+		return nil, 0, ErrIncomplete
+	}
+	frame, err := l.decodePacket(framer, l.ownBody(data[1+remainingLengthLength:msgLen]), version)
+	if err != nil {
+		return nil, 0, err
 	}
+	return frame, msgLen, nil
+}
+
+// decodePacket 根据framer解码包体
+func (l *MSProto) decodePacket(framer Framer, body []byte, version uint8) (Frame, error) {
+	frameType := framer.GetFrameType()
 	if frameType == PING {
 		return &PingPacket{
 			Framer: framer,
-		}, 1, nil
+		}, nil
 	}
 	if frameType == PONG {
 		return &PongPacket{
 			Framer: framer,
-		}, 1, nil
+		}, nil
+	}
+	c := l.frameCodec(frameType)
+	if c == nil || c.decode == nil {
+		return nil, errors.Wrapf(ErrUnknownFrameType, "%s", l.FrameTypeName(frameType))
+	}
+	frame, err := c.decode(framer, body, version)
+	if err != nil {
+		return nil, err
+	}
+	if err = l.checkDecoded(c, frame, len(body), version); err != nil {
+		return nil, err
 	}
+	return frame, nil
+}
 
-	if framer.RemainingLength > MaxRemaingLength {
-		return nil, 0, fmt.Errorf("消息超出最大限制[%d]！", MaxRemaingLength)
+// DecodeFrameInto 解码到已有的包（一般从AcquireXxxPacket获取），返回数据大小，只支持内置包类型
+//
+// 注意：为了避免内存分配，解码出的字符串和[]byte字段直接引用data，字符串也不例外。
+// data被修改或复用（例如读缓冲区被下一次读取覆盖）后，这些字段的内容会随之改变，
+// 字符串也会改变，违反了string不可变的约定。在此之前需要处理完这些字段，或者用strings.Clone和bytes.Clone复制需要保留的字段。
+// 需要复用data时可以开启CopyPayload，此时字段引用的是data的副本，代价是每次解码复制一次包体
+func (l *MSProto) DecodeFrameInto(data []byte, frame Frame, version uint8) (int, error) {
+	if isNilFrame(frame) {
+		return 0, ErrNilFrame
+	}
+	if err := l.checkVersion(version); err != nil {
+		return 0, err
+	}
+	framer, remainingLengthLength, err := l.decodeFramer(data)
+	if err != nil {
+		return 0, err
+	}
+	frameType := framer.GetFrameType()
+	if frame.GetFrameType() != frameType {
+		return 0, errors.Wrapf(ErrFrameTypeMismatch, "expect %s, got %s", l.FrameTypeName(frame.GetFrameType()), l.FrameTypeName(frameType))
+	}
+	if err = l.checkRemainingLength(framer.RemainingLength); err != nil {
+		return 0, err
 	}
 	msgLen := int(framer.RemainingLength) + 1 + remainingLengthLength
 	if len(data) < msgLen {
-		return nil, 0, nil
+		return 0, ErrIncomplete
 	}
-	body := data[1+remainingLengthLength : msgLen]
-	decodeFunc := packetDecodeMap[frameType]
-	if decodeFunc == nil {
-		return nil, 0, errors.New(fmt.Sprintf("不支持对[%s]包的解码！", frameType))
+	body := l.ownBody(data[1+remainingLengthLength : msgLen])
+	dec := Decoder{p: body, zeroCopy: true}
+	switch packet := frame.(type) {
+	case *PingPacket:
+		packet.Reset()
+		packet.Framer = framer
+		return msgLen, nil
+	case *PongPacket:
+		packet.Reset()
+		packet.Framer = framer
+		return msgLen, nil
+	case *ConnectPacket:
+		err = decodeConnectInto(packet, framer, &dec, version)
+	case *ConnackPacket:
+		err = decodeConnackInto(packet, framer, &dec, version)
+	case *SendPacket:
+		err = decodeSendInto(packet, framer, &dec, version)
+	case *SendackPacket:
+		err = decodeSendackInto(packet, framer, &dec, version)
+	case *RecvPacket:
+		err = decodeRecvInto(packet, framer, &dec, version)
+	case *RecvackPacket:
+		err = decodeRecvackInto(packet, framer, &dec, version)
+	case *DisconnectPacket:
+		err = decodeDisConnectInto(packet, framer, &dec, version)
+	case *SubPacket:
+		err = decodeSubInto(packet, framer, &dec, version)
+	case *SubackPacket:
+		err = decodeSubackInto(packet, framer, &dec, version)
+	default:
+		return 0, errors.Wrapf(ErrFrameTypeMismatch, "%T cannot be decoded into, need a pointer to a builtin packet", frame)
 	}
-
-	frame, err := decodeFunc(framer, body, version)
 	if err != nil {
-		return nil, 0, errors.Wrap(err, fmt.Sprintf("解码包[%s]失败！", frameType))
+		return 0, err
+	}
+	if err = l.checkDecoded(l.frameCodec(frameType), frame, len(body), version); err != nil {
+		return 0, err
+	}
+	return msgLen, nil
+}
+
+// checkDecoded 严格模式下检查包体是否被完整解码，开启DecodePayloadLimit时检查负载大小
+func (l *MSProto) checkDecoded(c *frameCodec, frame Frame, bodyLen int, version uint8) error {
+	opts := l.Options()
+	if opts.Strict {
+		if size := c.size(frame, version); size != bodyLen {
+			return newDecodeError(frame.GetFrameType(), "", size, ErrTrailingBytes)
+		}
+	}
+	if opts.DecodePayloadLimit {
+		if err := l.checkPayloadSize(frame); err != nil {
+			return newDecodeError(frame.GetFrameType(), "Payload", bodyLen-payloadLen(frame), err)
+		}
+	}
+	return nil
+}
+
+// ownBody 开启CopyPayload时复制包体，使解码出的包不再引用输入数据
+func (l *MSProto) ownBody(body []byte) []byte {
+	if !l.Options().CopyPayload || len(body) == 0 {
+		return body
+	}
+	return append([]byte(nil), body...)
+}
+
+// checkVersion 检查协议版本是否在支持范围内
+func (l *MSProto) checkVersion(version uint8) error {
+	opts := l.Options()
+	if version < opts.MinVersion || version > opts.MaxVersion {
+		return errors.Wrapf(ErrUnsupportedVersion, "version %d not in [%d,%d]", version, opts.MinVersion, opts.MaxVersion)
+	}
+	return nil
+}
+
+// checkRemainingLength 检查剩余长度是否超出最大限制
+func (l *MSProto) checkRemainingLength(remainingLength uint32) error {
+	if maxLength := l.Options().MaxRemainingLength; remainingLength > maxLength {
+		return errors.Wrapf(ErrFrameTooLarge, "remaining length %d exceeds %d", remainingLength, maxLength)
+	}
+	return nil
+}
+
+// checkPayloadSize 检查SEND和RECV的负载是否超出最大限制
+func (l *MSProto) checkPayloadSize(frame Frame) error {
+	size := payloadLen(frame)
+	if maxSize := l.Options().MaxPayloadSize; size > maxSize {
+		return errors.Wrapf(ErrPayloadTooLarge, "payload size %d exceeds %d", size, maxSize)
+	}
+	return nil
+}
+
+// payloadLen SEND和RECV的负载大小，其他包为0
+func payloadLen(frame Frame) int {
+	switch packet := frame.(type) {
+	case *SendPacket:
+		return len(packet.Payload)
+	case *RecvPacket:
+		return len(packet.Payload)
 	}
-	return frame, 1 + remainingLengthLength + int(framer.RemainingLength), nil
+	return 0
 }
 
-// EncodePacket 编码包
+// EncodeFrame 编码包 编码失败时返回*EncodeError说明失败的字段
+// 内置包既可以传指针也可以传值（如ConnectPacket{}和&ConnectPacket{}）
 func (l *MSProto) EncodeFrame(frame Frame, version uint8) ([]byte, error) {
 	buffer := bytes.NewBuffer([]byte{})
 	err := l.encodeFrameWithWriter(buffer, frame, version)
@@ -148,84 +296,161 @@ func (l *MSProto) EncodeFrame(frame Frame, version uint8) ([]byte, error) {
 	return buffer.Bytes(), nil
 }
 
-// encodeFrameWithWriter 编码包
+// truncater 可以丢弃末尾数据的Writer，如*bytes.Buffer
+type truncater interface {
+	Truncate(n int)
+}
+
+// encodeFrameWithWriter 编码包 编码失败时不会在w中留下半个报文
 func (l *MSProto) encodeFrameWithWriter(w Writer, frame Frame, version uint8) error {
+	if w == nil {
+		return errors.New("writer is nil")
+	}
+	if t, ok := w.(truncater); ok {
+		// 直接写入，失败时丢弃已写入的半个报文
+		start := w.Len()
+		if err := l.encodeFrameTo(w, frame, version); err != nil {
+			if w.Len() > start {
+				t.Truncate(start)
+			}
+			return err
+		}
+		return nil
+	}
+	// 不能截断的writer先编码到临时缓冲区，成功后再写入
+	scratch := pool.Get()
+	defer pool.Put(scratch)
+	if err := l.encodeFrameTo(scratch, frame, version); err != nil {
+		return err
+	}
+	_, err := w.Write(scratch.Bytes())
+	return err
+}
+
+// encodeFrameTo 编码包并写入w，失败时w中可能留有部分数据
+func (l *MSProto) encodeFrameTo(w Writer, frame Frame, version uint8) error {
+	frame, err := normalizeFrame(frame)
+	if err != nil {
+		return err
+	}
+	if err = l.checkVersion(version); err != nil {
+		return err
+	}
 	frameType := frame.GetFrameType()
 	enc := NewEncoderBuffer(w)
 	defer enc.End()
 	if frameType == PING || frameType == PONG {
-		_ = enc.WriteByte(byte(int(frameType) << 4))
+		if err := enc.Field("Header").WriteByte(byte(int(frameType) << 4)); err != nil {
+			return &EncodeError{FrameType: frameType, Field: enc.errField, Err: err}
+		}
 		return nil
 	}
 
-	var err error
+	c := l.frameCodec(frameType)
+	if c == nil || c.encode == nil {
+		return errors.Wrapf(ErrUnknownFrameType, "%s", l.FrameTypeName(frameType))
+	}
+	if err = checkBuiltinPacket(frameType, frame); err != nil {
+		return err
+	}
+	if err := l.checkPayloadSize(frame); err != nil {
+		return &EncodeError{FrameType: frameType, Field: "Payload", Err: err}
+	}
+	remainingLength := c.size(frame, version)
+	if remainingLength < 0 {
+		return &EncodeError{FrameType: frameType, Err: errors.Errorf("invalid remaining length %d", remainingLength)}
+	}
+	if err := l.checkRemainingLength(uint32(remainingLength)); err != nil {
+		return &EncodeError{FrameType: frameType, Err: err}
+	}
+	l.encodeFrame(frame, enc, uint32(remainingLength))
+	err = c.encode(frame, enc, version)
+	if encErr := enc.Err(); encErr != nil {
+		return &EncodeError{FrameType: frameType, Field: enc.errField, Err: encErr}
+	}
+	return err
+}
+
+// WriteFrame 编码报文，并写入writer 编码失败时返回*EncodeError说明失败的字段，w中不会留下半个报文
+func (l *MSProto) WriteFrame(w Writer, packet Frame, version uint8) error {
+	return l.encodeFrameWithWriter(w, packet, version)
+}
+
+func (l *MSProto) encodeFrame(f Frame, enc *Encoder, remainingLength uint32) {
+	_ = enc.Field("Header").WriteByte(ToFixHeaderUint8(f))
+	encodeVariable2(remainingLength, enc)
+}
+
+// normalizeFrame 将值类型的内置包转换为指针，nil包返回ErrNilFrame
+func normalizeFrame(frame Frame) (Frame, error) {
+	switch f := frame.(type) {
+	case ConnectPacket:
+		return &f, nil
+	case ConnackPacket:
+		return &f, nil
+	case DisconnectPacket:
+		return &f, nil
+	}
+	if isNilFrame(frame) {
+		return nil, ErrNilFrame
+	}
+	return frame, nil
+}
+
+// isNilFrame frame是否为nil或者nil指针
+func isNilFrame(frame Frame) bool {
+	if frame == nil {
+		return true
+	}
+	v := reflect.ValueOf(frame)
+	return v.Kind() == reflect.Pointer && v.IsNil()
+}
+
+// checkBuiltinPacket 检查内置包类型对应的结构体是否正确，避免编码时类型断言失败
+func checkBuiltinPacket(frameType FrameType, frame Frame) error {
+	ok := true
 	switch frameType {
 	case CONNECT:
-		packet := frame.(*ConnectPacket)
-		l.encodeFrame(packet, enc, uint32(encodeConnectSize(packet, version)))
-		err = encodeConnect(packet, enc, version)
+		_, ok = frame.(*ConnectPacket)
 	case CONNACK:
-		packet := frame.(*ConnackPacket)
-		l.encodeFrame(packet, enc, uint32(encodeConnackSize(packet, version)))
-		err = encodeConnack(packet, enc, version)
+		_, ok = frame.(*ConnackPacket)
 	case SEND:
-		packet := frame.(*SendPacket)
-		if packet.Payload != nil && len(packet.Payload) > PayloadMaxSize {
-			return errors.New(fmt.Sprintf("消息负载超出最大限制[%d]！", PayloadMaxSize))
-		}
-		l.encodeFrame(packet, enc, uint32(encodeSendSize(packet, version)))
-		err = encodeSend(packet, enc, version)
+		_, ok = frame.(*SendPacket)
 	case SENDACK:
-		packet := frame.(*SendackPacket)
-		l.encodeFrame(packet, enc, uint32(encodeSendackSize(packet, version)))
-		err = encodeSendack(packet, enc, version)
+		_, ok = frame.(*SendackPacket)
 	case RECV:
-		packet := frame.(*RecvPacket)
-		l.encodeFrame(packet, enc, uint32(encodeRecvSize(packet, version)))
-		err = encodeRecv(packet, enc, version)
+		_, ok = frame.(*RecvPacket)
 	case RECVACK:
-		packet := frame.(*RecvackPacket)
-		l.encodeFrame(packet, enc, uint32(encodeRecvackSize(packet, version)))
-		err = encodeRecvack(packet, enc, version)
+		_, ok = frame.(*RecvackPacket)
 	case DISCONNECT:
-		packet := frame.(*DisconnectPacket)
-		l.encodeFrame(packet, enc, uint32(encodeDisConnectSize(packet, version)))
-		err = encodeDisConnect(packet, enc, version)
+		_, ok = frame.(*DisconnectPacket)
 	case SUB:
-		packet := frame.(*SubPacket)
-		l.encodeFrame(packet, enc, uint32(encodeSubSize(packet, version)))
-		err = encodeSub(packet, enc, version)
+		_, ok = frame.(*SubPacket)
 	case SUBACK:
-		packet := frame.(*SubackPacket)
-		l.encodeFrame(packet, enc, uint32(encodeSubackSize(packet, version)))
-		err = encodeSuback(packet, enc, version)
+		_, ok = frame.(*SubackPacket)
 	}
-	if err != nil {
-		return err
+	if !ok {
+		return errors.Wrapf(ErrFrameTypeMismatch, "%s cannot be encoded as %s", reflect.TypeOf(frame), frameType)
 	}
 	return nil
 }
 
-func (l *MSProto) WriteFrame(w Writer, packet Frame, version uint8) error {
-	return l.encodeFrameWithWriter(w, packet, version)
-}
-
-func (l *MSProto) encodeFrame(f Frame, enc *Encoder, remainingLength uint32) {
-	_ = enc.WriteByte(ToFixHeaderUint8(f))
-	encodeVariable2(remainingLength, enc)
-}
-
+// decodeFramer 解码固定报头，返回framer和剩余长度所占的字节数
+// 数据不足以解析出固定报头时返回ErrIncomplete，剩余长度编码不合法时返回ErrMalformedLength
 func (l *MSProto) decodeFramer(data []byte) (Framer, int, error) {
+	if len(data) == 0 {
+		return Framer{}, 0, ErrIncomplete
+	}
 	typeAndFlags := data[0]
 	p := FramerFromUint8(typeAndFlags)
+	if err := l.checkFrameType(p.FrameType); err != nil {
+		return Framer{}, 0, err
+	}
 	var remainingLengthLength uint32 = 0 // 剩余长度的长度
 	var err error
 	if p.FrameType != PING && p.FrameType != PONG {
 		p.RemainingLength, remainingLengthLength, err = decodeLength(data[1:])
 		if err != nil {
-			if errors.Is(err, errDecodeLength) {
-				return Framer{}, 0, nil
-			}
 			return Framer{}, 0, err
 		}
 	}
@@ -233,6 +458,17 @@ func (l *MSProto) decodeFramer(data []byte) (Framer, int, error) {
 	return p, int(remainingLengthLength), nil
 }
 
+// checkFrameType 检查是否支持对此类型包的解码
+func (l *MSProto) checkFrameType(frameType FrameType) error {
+	if frameType == PING || frameType == PONG {
+		return nil
+	}
+	if c := l.frameCodec(frameType); c == nil || c.decode == nil {
+		return errors.Wrapf(ErrUnknownFrameType, "%s", l.FrameTypeName(frameType))
+	}
+	return nil
+}
+
 func (l *MSProto) decodeFramerWithConn(conn io.Reader) (Framer, error) {
 	b := make([]byte, 1)
 	_, err := io.ReadFull(conn, b)
@@ -241,8 +477,14 @@ func (l *MSProto) decodeFramerWithConn(conn io.Reader) (Framer, error) {
 	}
 	typeAndFlags := b[0]
 	p := FramerFromUint8(typeAndFlags)
+	if err := l.checkFrameType(p.FrameType); err != nil {
+		return Framer{}, err
+	}
 	if p.FrameType != PING && p.FrameType != PONG {
-		p.RemainingLength = uint32(decodeLengthWithConn(conn))
+		p.RemainingLength, err = decodeLengthWithConn(conn, b)
+		if err != nil {
+			return Framer{}, err
+		}
 	}
 	return p, nil
 }
@@ -261,6 +503,10 @@ func encodeVariable(size uint32) []byte {
 }
 
 func encodeVariable2(size uint32, enc *Encoder) {
+	if size == 0 {
+		_ = enc.WriteByte(0)
+		return
+	}
 	for size > 0 {
 		digit := byte(size % 0x80)
 		size /= 0x80
@@ -276,32 +522,38 @@ func decodeLength(data []byte) (uint32, uint32, error) {
 	offset := 0
 	for multiplier < 27 { //fix: Infinite '(digit & 128) == 1' will cause the dead loop
 		if offset >= len(data) {
-			return 0, 0, errDecodeLength
+			return 0, 0, ErrIncomplete
 		}
 		digit := data[offset]
 		rLength |= uint32(digit&127) << multiplier
 		if (digit & 128) == 0 {
-			break
+			return rLength, uint32(offset + 1), nil
 		}
 		multiplier += 7
 		offset++
 	}
-	return rLength, uint32(offset + 1), nil
+	return 0, 0, ErrMalformedLength
 }
-func decodeLengthWithConn(r io.Reader) int {
+
+// decodeLengthWithConn 从conn中读取剩余长度，b为复用的单字节缓冲区
+func decodeLengthWithConn(r io.Reader, b []byte) (uint32, error) {
 	var rLength uint32
 	var multiplier uint32
 	for multiplier < 27 {
-		b := make([]byte, 1)
-		_, _ = io.ReadFull(r, b)
+		if _, err := io.ReadFull(r, b[:1]); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
 		digit := b[0]
 		rLength |= uint32(digit&127) << multiplier
 		if (digit & 128) == 0 {
-			break
+			return rLength, nil
 		}
 		multiplier += 7
 	}
-	return int(rLength)
+	return 0, ErrMalformedLength
 }
 
 func encodeBool(b bool) (i int) {
@@ -0,0 +1,191 @@
+package msproto
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestDecodeFrameAdversarial(t *testing.T) {
+	proto := New()
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"empty", []byte{}, ErrIncomplete},
+		{"nil", nil, ErrIncomplete},
+		{"header only", []byte{byte(SEND) << 4}, ErrIncomplete},
+		{"truncated length", []byte{byte(SEND) << 4, 0x80, 0x80}, ErrIncomplete},
+		{"5-byte length", []byte{byte(SEND) << 4, 0xFF, 0xFF, 0xFF, 0xFF, 0x7F}, ErrMalformedLength},
+		{"length over limit", []byte{byte(SEND) << 4, 0xFF, 0xFF, 0xFF, 0x7F}, ErrFrameTooLarge},
+		{"truncated body", []byte{byte(SEND) << 4, 0x10, 0x01}, ErrIncomplete},
+		{"reserved type 0", []byte{0x00, 0x00}, ErrUnknownFrameType},
+		{"frame type 12", []byte{12 << 4, 0x00}, ErrUnknownFrameType},
+		{"frame type 13", []byte{13 << 4, 0x00}, ErrUnknownFrameType},
+		{"frame type 14", []byte{14 << 4, 0x00}, ErrUnknownFrameType},
+		{"frame type 15", []byte{15 << 4, 0x00}, ErrUnknownFrameType},
+		{"empty SEND body", []byte{byte(SEND) << 4, 0x00}, io.ErrUnexpectedEOF},
+		{"empty CONNECT body", []byte{byte(CONNECT) << 4, 0x00}, io.ErrUnexpectedEOF},
+		{"string length beyond body", []byte{byte(RECVACK) << 4, 0x03, 0x00, 0x00, 0x00}, io.ErrUnexpectedEOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frame, n, err := proto.DecodeFrame(tt.data, LatestVersion)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("DecodeFrame err = %v, want %v", err, tt.err)
+			}
+			if frame != nil || n != 0 {
+				t.Fatalf("DecodeFrame = %v, %d, want nil, 0", frame, n)
+			}
+
+			want := tt.err
+			if want == ErrIncomplete {
+				// 连接上数据不足时表现为读取到EOF
+				want = io.EOF
+				if len(tt.data) > 0 {
+					want = io.ErrUnexpectedEOF
+				}
+			}
+			if _, err = proto.DecodePacketWithConn(bytes.NewReader(tt.data), LatestVersion); !errors.Is(err, want) {
+				t.Fatalf("DecodePacketWithConn err = %v, want %v", err, want)
+			}
+
+			if _, err = proto.DecodeFrameInto(tt.data, AcquireSendPacket(), LatestVersion); err == nil {
+				t.Fatal("DecodeFrameInto err = nil")
+			}
+		})
+	}
+}
+
+func TestDecodeFrameIntoAdversarial(t *testing.T) {
+	proto := New()
+	send, err := proto.EncodeFrame(&SendPacket{ClientSeq: 1, ChannelID: "c", ChannelType: ChannelTypePerson}, LatestVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	connect, err := proto.EncodeFrame(&ConnectPacket{Version: LatestVersion, UID: "u"}, LatestVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var nilSend *SendPacket
+	tests := []struct {
+		name  string
+		data  []byte
+		frame Frame
+		err   error
+	}{
+		{"nil frame", send, nil, ErrNilFrame},
+		{"typed nil frame", send, nilSend, ErrNilFrame},
+		{"type mismatch", send, &RecvPacket{}, ErrFrameTypeMismatch},
+		{"value ConnectPacket", connect, ConnectPacket{}, ErrFrameTypeMismatch},
+		{"bare Framer", send, Framer{FrameType: SEND}, ErrFrameTypeMismatch},
+		{"empty", []byte{}, &SendPacket{}, ErrIncomplete},
+		{"truncated length", []byte{byte(SEND) << 4, 0x80}, &SendPacket{}, ErrIncomplete},
+		{"5-byte length", []byte{byte(SEND) << 4, 0xFF, 0xFF, 0xFF, 0xFF, 0x7F}, &SendPacket{}, ErrMalformedLength},
+		{"frame type 12", []byte{12 << 4, 0x00}, &SendPacket{}, ErrUnknownFrameType},
+		{"frame type 15", []byte{15 << 4, 0x00}, &SendPacket{}, ErrUnknownFrameType},
+		{"truncated body", send[:len(send)-1], &SendPacket{}, ErrIncomplete},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := proto.DecodeFrameInto(tt.data, tt.frame, LatestVersion)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("DecodeFrameInto err = %v, want %v", err, tt.err)
+			}
+			if n != 0 {
+				t.Fatalf("DecodeFrameInto n = %d, want 0", n)
+			}
+		})
+	}
+}
+
+func TestEncodeFrameAdversarial(t *testing.T) {
+	proto := New()
+	var (
+		nilSend    *SendPacket
+		nilConnect *ConnectPacket
+	)
+	tests := []struct {
+		name  string
+		frame Frame
+		err   error
+	}{
+		{"nil", nil, ErrNilFrame},
+		{"typed nil SEND", nilSend, ErrNilFrame},
+		{"typed nil CONNECT", nilConnect, ErrNilFrame},
+		{"bare Framer SEND", Framer{FrameType: SEND}, ErrFrameTypeMismatch},
+		{"bare Framer CONNACK", &Framer{FrameType: CONNACK}, ErrFrameTypeMismatch},
+		{"unknown frame type", Framer{FrameType: 13}, ErrUnknownFrameType},
+		{"payload too large", &SendPacket{Payload: make([]byte, PayloadMaxSize+1)}, ErrPayloadTooLarge},
+		{"value ConnectPacket", ConnectPacket{Version: LatestVersion, UID: "u"}, nil},
+		{"value ConnackPacket", ConnackPacket{ReasonCode: ReasonSuccess}, nil},
+		{"value DisconnectPacket", DisconnectPacket{ReasonCode: ReasonConnectKick, Reason: "kick"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := proto.EncodeFrame(tt.frame, LatestVersion)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("EncodeFrame err = %v, want %v", err, tt.err)
+			}
+			var buf bytes.Buffer
+			if werr := proto.WriteFrame(&buf, tt.frame, LatestVersion); !errors.Is(werr, tt.err) {
+				t.Fatalf("WriteFrame err = %v, want %v", werr, tt.err)
+			}
+			if tt.err != nil {
+				if data != nil || buf.Len() != 0 {
+					t.Fatalf("failed encode wrote %d/%d bytes", len(data), buf.Len())
+				}
+				return
+			}
+			if !bytes.Equal(data, buf.Bytes()) {
+				t.Fatalf("EncodeFrame and WriteFrame differ: %x != %x", data, buf.Bytes())
+			}
+			frame, n, err := proto.DecodeFrame(data, LatestVersion)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != len(data) || frame.GetFrameType() != tt.frame.GetFrameType() {
+				t.Fatalf("round trip got %s (%d bytes), want %s (%d bytes)", frame.GetFrameType(), n, tt.frame.GetFrameType(), len(data))
+			}
+		})
+	}
+}
+
+func TestEncodeFieldTooLong(t *testing.T) {
+	proto := New()
+	long := string(make([]byte, 1<<16))
+	_, err := proto.EncodeFrame(&ConnectPacket{Version: LatestVersion, UID: long}, LatestVersion)
+	if !errors.Is(err, ErrFieldTooLong) {
+		t.Fatalf("err = %v, want %v", err, ErrFieldTooLong)
+	}
+	var encodeErr *EncodeError
+	if !errors.As(err, &encodeErr) || encodeErr.Field != "UID" {
+		t.Fatalf("err = %v, want EncodeError on UID", err)
+	}
+}
+
+func TestDecodeRandomInputs(t *testing.T) {
+	proto := New()
+	r := rand.New(rand.NewSource(1))
+	frames := []Frame{AcquireSendPacket(), AcquireRecvPacket(), AcquireConnectPacket(), AcquireConnackPacket(), AcquireSubPacket()}
+	buf := make([]byte, 64)
+	for i := 0; i < 20000; i++ {
+		data := buf[:r.Intn(len(buf)+1)]
+		r.Read(data)
+		if len(data) > 0 && i%2 == 0 {
+			// 大部分输入使用合法的包类型，覆盖到包体的解码
+			data[0] = byte(1+r.Intn(int(SUBACK))) << 4
+		}
+		for _, version := range []uint8{1, 4, LatestVersion} {
+			_, _, _ = proto.DecodeFrame(data, version)
+			_, _ = proto.DecodePacketWithConn(bytes.NewReader(data), version)
+			for _, frame := range frames {
+				_, _ = proto.DecodeFrameInto(data, frame, version)
+			}
+		}
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"strconv"
 
-	"github.com/pkg/errors"
 	"github.com/valyala/bytebufferpool"
 )
 
@@ -105,118 +104,128 @@ func (r *RecvPacket) String() string {
 }
 
 func decodeRecv(frame Frame, data []byte, version uint8) (Frame, error) {
-	dec := NewDecoder(data)
 	recvPacket := &RecvPacket{}
-	recvPacket.Framer = frame.(Framer)
+	if err := decodeRecvInto(recvPacket, framerOf(frame), NewDecoder(data), version); err != nil {
+		return nil, err
+	}
+	return recvPacket, nil
+}
+
+// decodeRecvInto 解码到已有的包
+func decodeRecvInto(recvPacket *RecvPacket, framer Framer, dec *Decoder, version uint8) error {
+	recvPacket.Reset()
+	recvPacket.Framer = framer
 	var err error
 	setting, err := dec.Uint8()
 	if err != nil {
-		return nil, errors.Wrap(err, "解码消息设置失败！")
+		return newDecodeError(RECV, "Setting", dec.Offset(), err)
 	}
 	recvPacket.Setting = Setting(setting)
 	// MsgKey
 	if recvPacket.MsgKey, err = dec.String(); err != nil {
-		return nil, errors.Wrap(err, "解码MsgKey失败！")
+		return newDecodeError(RECV, "MsgKey", dec.Offset(), err)
 	}
 	// 发送者
 	if recvPacket.FromUID, err = dec.String(); err != nil {
-		return nil, errors.Wrap(err, "解码FromUID失败！")
+		return newDecodeError(RECV, "FromUID", dec.Offset(), err)
 	}
 	// 频道ID
 	if recvPacket.ChannelID, err = dec.String(); err != nil {
-		return nil, errors.Wrap(err, "解码ChannelId失败！")
+		return newDecodeError(RECV, "ChannelID", dec.Offset(), err)
 	}
 	// 频道类型
 	if recvPacket.ChannelType, err = dec.Uint8(); err != nil {
-		return nil, errors.Wrap(err, "解码ChannelType失败！")
+		return newDecodeError(RECV, "ChannelType", dec.Offset(), err)
 	}
 	if version >= 3 {
 		var expire uint32
 		if expire, err = dec.Uint32(); err != nil {
-			return nil, errors.Wrap(err, "解码Expire失败！")
+			return newDecodeError(RECV, "Expire", dec.Offset(), err)
 		}
 		recvPacket.Expire = expire
 	}
 	// 客户端唯一标示
 	if recvPacket.ClientMsgNo, err = dec.String(); err != nil {
-		return nil, errors.Wrap(err, "解码ClientMsgNo失败！")
+		return newDecodeError(RECV, "ClientMsgNo", dec.Offset(), err)
 	}
 	// 流消息
 	if version >= 2 && recvPacket.Setting.IsSet(SettingStream) {
 		var streamFlag uint8
 		if streamFlag, err = dec.Uint8(); err != nil {
-			return nil, errors.Wrap(err, "解码StreamFlag失败！")
+			return newDecodeError(RECV, "StreamFlag", dec.Offset(), err)
 		}
 		recvPacket.StreamFlag = StreamFlag(streamFlag)
 
 		if recvPacket.StreamNo, err = dec.String(); err != nil {
-			return nil, errors.Wrap(err, "解码StreamNo失败！")
+			return newDecodeError(RECV, "StreamNo", dec.Offset(), err)
 		}
 		if recvPacket.StreamId, err = dec.Uint64(); err != nil {
-			return nil, errors.Wrap(err, "解码StreamId失败！")
+			return newDecodeError(RECV, "StreamId", dec.Offset(), err)
 		}
 	}
 	// 消息全局唯一ID
 	if recvPacket.MessageID, err = dec.Int64(); err != nil {
-		return nil, errors.Wrap(err, "解码MessageId失败！")
+		return newDecodeError(RECV, "MessageID", dec.Offset(), err)
 	}
 	// 消息序列号 （用户唯一，有序递增）
 	if recvPacket.MessageSeq, err = dec.Uint32(); err != nil {
-		return nil, errors.Wrap(err, "解码MessageSeq失败！")
+		return newDecodeError(RECV, "MessageSeq", dec.Offset(), err)
 	}
 	// 消息时间
 	if recvPacket.Timestamp, err = dec.Int32(); err != nil {
-		return nil, errors.Wrap(err, "解码Timestamp失败！")
+		return newDecodeError(RECV, "Timestamp", dec.Offset(), err)
 	}
 	if recvPacket.Setting.IsSet(SettingTopic) {
 		// topic
 		if recvPacket.Topic, err = dec.String(); err != nil {
-			return nil, errors.Wrap(err, "解密topic消息失败！")
+			return newDecodeError(RECV, "Topic", dec.Offset(), err)
 		}
 	}
 	if recvPacket.Payload, err = dec.BinaryAll(); err != nil {
-		return nil, errors.Wrap(err, "解码payload失败！")
+		return newDecodeError(RECV, "Payload", dec.Offset(), err)
 	}
-	return recvPacket, err
+	return nil
 }
 
-func encodeRecv(recvPacket *RecvPacket, enc *Encoder, version uint8) error {
+func encodeRecv(frame Frame, enc *Encoder, version uint8) error {
+	recvPacket := frame.(*RecvPacket)
 	// setting
-	_ = enc.WriteByte(recvPacket.Setting.Uint8())
+	_ = enc.Field("Setting").WriteByte(recvPacket.Setting.Uint8())
 	// MsgKey
-	enc.WriteString(recvPacket.MsgKey)
+	enc.Field("MsgKey").WriteString(recvPacket.MsgKey)
 	// 发送者
-	enc.WriteString(recvPacket.FromUID)
+	enc.Field("FromUID").WriteString(recvPacket.FromUID)
 	// 频道ID
-	enc.WriteString(recvPacket.ChannelID)
+	enc.Field("ChannelID").WriteString(recvPacket.ChannelID)
 	// 频道类型
-	enc.WriteUint8(recvPacket.ChannelType)
+	enc.Field("ChannelType").WriteUint8(recvPacket.ChannelType)
 	if version >= 3 {
-		enc.WriteUint32(recvPacket.Expire)
+		enc.Field("Expire").WriteUint32(recvPacket.Expire)
 	}
 	// 客户端唯一标示
-	enc.WriteString(recvPacket.ClientMsgNo)
+	enc.Field("ClientMsgNo").WriteString(recvPacket.ClientMsgNo)
 	// 流消息
 	if version >= 2 && recvPacket.Setting.IsSet(SettingStream) {
-		enc.WriteUint8(uint8(recvPacket.StreamFlag))
-		enc.WriteString(recvPacket.StreamNo)
-		enc.WriteUint64(recvPacket.StreamId)
+		enc.Field("StreamFlag").WriteUint8(uint8(recvPacket.StreamFlag))
+		enc.Field("StreamNo").WriteString(recvPacket.StreamNo)
+		enc.Field("StreamId").WriteUint64(recvPacket.StreamId)
 	}
 	// 消息唯一ID
-	enc.WriteInt64(recvPacket.MessageID)
+	enc.Field("MessageID").WriteInt64(recvPacket.MessageID)
 	// 消息有序ID
-	enc.WriteUint32(recvPacket.MessageSeq)
+	enc.Field("MessageSeq").WriteUint32(recvPacket.MessageSeq)
 	// 消息时间戳
-	enc.WriteInt32(recvPacket.Timestamp)
+	enc.Field("Timestamp").WriteInt32(recvPacket.Timestamp)
 	if recvPacket.Setting.IsSet(SettingTopic) {
-		enc.WriteString(recvPacket.Topic)
+		enc.Field("Topic").WriteString(recvPacket.Topic)
 	}
 	// 消息内容
-	enc.WriteBytes(recvPacket.Payload)
-	return nil
+	enc.Field("Payload").WriteBytes(recvPacket.Payload)
+	return enc.Err()
 }
 
-func encodeRecvSize(packet *RecvPacket, version uint8) int {
+func encodeRecvSize(frame Frame, version uint8) int {
+	packet := frame.(*RecvPacket)
 	size := 0
 	size += SettingByteSize
 	size += (len(packet.MsgKey) + StringFixLenByteSize)
@@ -2,8 +2,6 @@ package msproto
 
 import (
 	"fmt"
-
-	"github.com/pkg/errors"
 )
 
 // RecvackPacket 对收取包回执
@@ -13,6 +11,13 @@ type RecvackPacket struct {
 	MessageSeq uint32 // 消息序列号
 }
 
+// Reset 重置包，用于复用
+func (s *RecvackPacket) Reset() {
+	s.Framer = Framer{}
+	s.MessageID = 0
+	s.MessageSeq = 0
+}
+
 // GetPacketType 包类型
 func (s *RecvackPacket) GetFrameType() FrameType {
 	return RECVACK
@@ -22,29 +27,38 @@ func (s *RecvackPacket) String() string {
 	return fmt.Sprintf("Framer:%s MessageId:%d MessageSeq:%d", s.Framer.String(), s.MessageID, s.MessageSeq)
 }
 
-func decodeRecvack(frame Frame, data []byte, _ uint8) (Frame, error) {
-	dec := NewDecoder(data)
+func decodeRecvack(frame Frame, data []byte, version uint8) (Frame, error) {
 	recvackPacket := &RecvackPacket{}
-	recvackPacket.Framer = frame.(Framer)
+	if err := decodeRecvackInto(recvackPacket, framerOf(frame), NewDecoder(data), version); err != nil {
+		return nil, err
+	}
+	return recvackPacket, nil
+}
+
+// decodeRecvackInto 解码到已有的包
+func decodeRecvackInto(recvackPacket *RecvackPacket, framer Framer, dec *Decoder, _ uint8) error {
+	recvackPacket.Reset()
+	recvackPacket.Framer = framer
 	var err error
 	// 消息唯一ID
 	if recvackPacket.MessageID, err = dec.Int64(); err != nil {
-		return nil, errors.Wrap(err, "解码MessageId失败！")
+		return newDecodeError(RECVACK, "MessageID", dec.Offset(), err)
 	}
 	// 消息唯序列号
 	if recvackPacket.MessageSeq, err = dec.Uint32(); err != nil {
-		return nil, errors.Wrap(err, "解码MessageSeq失败！")
+		return newDecodeError(RECVACK, "MessageSeq", dec.Offset(), err)
 	}
-	return recvackPacket, err
+	return nil
 }
 
-func encodeRecvack(recvackPacket *RecvackPacket, enc *Encoder, _ uint8) error {
-	enc.WriteInt64(recvackPacket.MessageID)
-	enc.WriteUint32(recvackPacket.MessageSeq)
-	return nil
+func encodeRecvack(frame Frame, enc *Encoder, _ uint8) error {
+	recvackPacket := frame.(*RecvackPacket)
+	enc.Field("MessageID").WriteInt64(recvackPacket.MessageID)
+	enc.Field("MessageSeq").WriteUint32(recvackPacket.MessageSeq)
+	return enc.Err()
 }
 
-func encodeRecvackSize(_ *RecvackPacket, _ uint8) int {
+func encodeRecvackSize(_ Frame, _ uint8) int {
 
 	return MessageIDByteSize + MessageSeqByteSize
 }
@@ -0,0 +1,78 @@
+package msproto
+
+import "fmt"
+
+// MaxFrameType 包类型在固定报头中占4位，最大为15
+const MaxFrameType FrameType = 15
+
+// frameCodec 包类型对应的编解码函数
+type frameCodec struct {
+	name   string
+	decode PacketDecodeFunc
+	encode PacketEncodeFunc
+	size   PacketSizeFunc
+}
+
+// builtinFrameCodecs 内置包类型 PING和PONG只有固定报头，没有编解码函数
+var builtinFrameCodecs = [MaxFrameType + 1]*frameCodec{
+	CONNECT:    {name: "CONNECT", decode: decodeConnect, encode: encodeConnect, size: encodeConnectSize},
+	CONNACK:    {name: "CONNACK", decode: decodeConnack, encode: encodeConnack, size: encodeConnackSize},
+	SEND:       {name: "SEND", decode: decodeSend, encode: encodeSend, size: encodeSendSize},
+	SENDACK:    {name: "SENDACK", decode: decodeSendack, encode: encodeSendack, size: encodeSendackSize},
+	RECV:       {name: "RECV", decode: decodeRecv, encode: encodeRecv, size: encodeRecvSize},
+	RECVACK:    {name: "RECVACK", decode: decodeRecvack, encode: encodeRecvack, size: encodeRecvackSize},
+	PING:       {name: "PING"},
+	PONG:       {name: "PONG"},
+	DISCONNECT: {name: "DISCONNECT", decode: decodeDisConnect, encode: encodeDisConnect, size: encodeDisConnectSize},
+	SUB:        {name: "SUB", decode: decodeSub, encode: encodeSub, size: encodeSubSize},
+	SUBACK:     {name: "SUBACK", decode: decodeSuback, encode: encodeSuback, size: encodeSubackSize},
+}
+
+// RegisterFrameType 注册自定义包类型（只对当前协议对象有效）
+// 内置包类型已预先注册，不能被覆盖；自定义包的GetFrameType需要返回frameType
+func (l *MSProto) RegisterFrameType(frameType FrameType, name string, decodeFunc PacketDecodeFunc, encodeFunc PacketEncodeFunc, sizeFunc PacketSizeFunc) error {
+	if frameType == UNKNOWN || frameType > MaxFrameType {
+		return fmt.Errorf("frame type %d out of range [1,%d]", frameType, MaxFrameType)
+	}
+	if decodeFunc == nil || encodeFunc == nil || sizeFunc == nil {
+		return fmt.Errorf("frame type %d: decode, encode and size functions are required", frameType)
+	}
+	l.Lock()
+	defer l.Unlock()
+	if c := l.lookupFrameCodec(frameType); c != nil {
+		return fmt.Errorf("frame type %d already registered as %s", frameType, c.name)
+	}
+	l.codecs[frameType] = &frameCodec{
+		name:   name,
+		decode: decodeFunc,
+		encode: encodeFunc,
+		size:   sizeFunc,
+	}
+	return nil
+}
+
+// FrameTypeName 包类型名称，包括自定义包类型
+func (l *MSProto) FrameTypeName(frameType FrameType) string {
+	if c := l.frameCodec(frameType); c != nil {
+		return c.name
+	}
+	return frameType.String()
+}
+
+// frameCodec 获取包类型对应的编解码函数，不支持时返回nil
+func (l *MSProto) frameCodec(frameType FrameType) *frameCodec {
+	if frameType > MaxFrameType {
+		return nil
+	}
+	l.RLock()
+	c := l.lookupFrameCodec(frameType)
+	l.RUnlock()
+	return c
+}
+
+func (l *MSProto) lookupFrameCodec(frameType FrameType) *frameCodec {
+	if c := l.codecs[frameType]; c != nil {
+		return c
+	}
+	return builtinFrameCodecs[frameType]
+}
@@ -0,0 +1,136 @@
+package msproto
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+const typingFrameType FrameType = 12
+
+// typingPacket 自定义包，对方正在输入
+type typingPacket struct {
+	Framer
+	ChannelID string
+}
+
+func (p *typingPacket) GetFrameType() FrameType {
+	return typingFrameType
+}
+
+func decodeTyping(frame Frame, data []byte, _ uint8) (Frame, error) {
+	p := &typingPacket{Framer: framerOf(frame)}
+	dec := NewDecoder(data)
+	var err error
+	if p.ChannelID, err = dec.String(); err != nil {
+		return nil, newDecodeError(typingFrameType, "ChannelID", dec.Offset(), err)
+	}
+	return p, nil
+}
+
+func encodeTyping(frame Frame, enc *Encoder, _ uint8) error {
+	enc.Field("ChannelID").WriteString(frame.(*typingPacket).ChannelID)
+	return enc.Err()
+}
+
+func encodeTypingSize(frame Frame, _ uint8) int {
+	return StringFixLenByteSize + len(frame.(*typingPacket).ChannelID)
+}
+
+func registerTyping(proto *MSProto) error {
+	return proto.RegisterFrameType(typingFrameType, "TYPING", decodeTyping, encodeTyping, encodeTypingSize)
+}
+
+func TestRegisterFrameType(t *testing.T) {
+	proto := New()
+	if err := registerTyping(proto); err != nil {
+		t.Fatal(err)
+	}
+	if name := proto.FrameTypeName(typingFrameType); name != "TYPING" {
+		t.Errorf("FrameTypeName = %s, want TYPING", name)
+	}
+	if name := proto.FrameTypeName(SEND); name != "SEND" {
+		t.Errorf("FrameTypeName(SEND) = %s", name)
+	}
+
+	data, err := proto.EncodeFrame(&typingPacket{ChannelID: "c1"}, LatestVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame, n, err := proto.DecodeFrame(data, LatestVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	typing, ok := frame.(*typingPacket)
+	if !ok || typing.ChannelID != "c1" || n != len(data) {
+		t.Fatalf("DecodeFrame = %#v, %d", frame, n)
+	}
+	// 自定义包类型也按字段报告解码错误
+	_, _, err = proto.DecodeFrame([]byte{byte(typingFrameType) << 4, 0x01, 0x00}, LatestVersion)
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) || decodeErr.Field != "ChannelID" {
+		t.Fatalf("err = %v, want DecodeError on ChannelID", err)
+	}
+}
+
+func TestRegisterFrameTypeInvalid(t *testing.T) {
+	proto := New()
+	if err := registerTyping(proto); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		frameType FrameType
+		decode    PacketDecodeFunc
+		encode    PacketEncodeFunc
+		size      PacketSizeFunc
+	}{
+		{"builtin", SEND, decodeTyping, encodeTyping, encodeTypingSize},
+		{"builtin PING", PING, decodeTyping, encodeTyping, encodeTypingSize},
+		{"duplicate", typingFrameType, decodeTyping, encodeTyping, encodeTypingSize},
+		{"reserved 0", UNKNOWN, decodeTyping, encodeTyping, encodeTypingSize},
+		{"out of range", MaxFrameType + 1, decodeTyping, encodeTyping, encodeTypingSize},
+		{"nil decode", 13, nil, encodeTyping, encodeTypingSize},
+		{"nil encode", 13, decodeTyping, nil, encodeTypingSize},
+		{"nil size", 13, decodeTyping, encodeTyping, nil},
+	}
+	for _, tt := range tests {
+		if err := proto.RegisterFrameType(tt.frameType, "X", tt.decode, tt.encode, tt.size); err == nil {
+			t.Errorf("%s: registered frame type %d", tt.name, tt.frameType)
+		}
+	}
+	// 注册失败不影响已有的包类型
+	if name := proto.FrameTypeName(SEND); name != "SEND" {
+		t.Errorf("FrameTypeName(SEND) = %s", name)
+	}
+	if name := proto.FrameTypeName(13); name == "X" {
+		t.Error("failed registration is visible")
+	}
+}
+
+func TestRegisterFrameTypePerInstance(t *testing.T) {
+	registered, other := New(), New()
+	if err := registerTyping(registered); err != nil {
+		t.Fatal(err)
+	}
+	data, err := registered.EncodeFrame(&typingPacket{ChannelID: "c1"}, LatestVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = other.DecodeFrame(data, LatestVersion); !errors.Is(err, ErrUnknownFrameType) {
+		t.Fatalf("DecodeFrame on another instance err = %v, want ErrUnknownFrameType", err)
+	}
+	if _, err = other.EncodeFrame(&typingPacket{ChannelID: "c1"}, LatestVersion); !errors.Is(err, ErrUnknownFrameType) {
+		t.Fatalf("EncodeFrame on another instance err = %v, want ErrUnknownFrameType", err)
+	}
+	if name := other.FrameTypeName(typingFrameType); name == "TYPING" {
+		t.Errorf("FrameTypeName on another instance = %s", name)
+	}
+	// 另一个实例可以用同一个包类型注册不同的包
+	if err = other.RegisterFrameType(typingFrameType, "OTHER", decodeTyping, encodeTyping, encodeTypingSize); err != nil {
+		t.Fatal(err)
+	}
+	if name := registered.FrameTypeName(typingFrameType); name != "TYPING" {
+		t.Errorf("FrameTypeName = %s, want TYPING", name)
+	}
+}
@@ -2,8 +2,6 @@ package msproto
 
 import (
 	"fmt"
-
-	"github.com/pkg/errors"
 )
 
 // SendPacket 发送包
@@ -26,6 +24,21 @@ func (s *SendPacket) UniqueKey() string {
 	return fmt.Sprintf("%s-%d-%s-%d", s.ChannelID, s.ChannelType, s.ClientMsgNo, s.ClientSeq)
 }
 
+// Reset 重置包，用于复用
+func (s *SendPacket) Reset() {
+	s.Framer = Framer{}
+	s.Setting = 0
+	s.MsgKey = ""
+	s.Expire = 0
+	s.ClientSeq = 0
+	s.ClientMsgNo = ""
+	s.StreamNo = ""
+	s.ChannelID = ""
+	s.ChannelType = 0
+	s.Topic = ""
+	s.Payload = nil
+}
+
 // GetPacketType 包类型
 func (s *SendPacket) GetFrameType() FrameType {
 	return SEND
@@ -41,107 +54,124 @@ func (s *SendPacket) VerityString() string {
 }
 
 func decodeSend(frame Frame, data []byte, version uint8) (Frame, error) {
-	dec := NewDecoder(data)
-	// dec.p = data
-	// dec.offset = 0
-
 	sendPacket := &SendPacket{}
-	// sendPacket.reset()
-	sendPacket.Framer = frame.(Framer)
+	if err := decodeSendInto(sendPacket, framerOf(frame), NewDecoder(data), version); err != nil {
+		return nil, err
+	}
+	return sendPacket, nil
+}
 
+// decodeSendInto 解码到已有的包
+func decodeSendInto(sendPacket *SendPacket, framer Framer, dec *Decoder, version uint8) error {
+	sendPacket.Reset()
+	sendPacket.Framer = framer
 	var err error
 	setting, err := dec.Uint8()
 	if err != nil {
-		return nil, errors.Wrap(err, "解码消息设置失败！")
+		return newDecodeError(SEND, "Setting", dec.Offset(), err)
 	}
 	sendPacket.Setting = Setting(setting)
 
 	// 消息序列号(客户端维护)
-	var clientSeq uint32
-	if clientSeq, err = dec.Uint32(); err != nil {
-		return nil, errors.Wrap(err, "解码ClientSeq失败！")
+	if version >= 5 {
+		if sendPacket.ClientSeq, err = dec.Uint64(); err != nil {
+			return newDecodeError(SEND, "ClientSeq", dec.Offset(), err)
+		}
+	} else {
+		var clientSeq uint32
+		if clientSeq, err = dec.Uint32(); err != nil {
+			return newDecodeError(SEND, "ClientSeq", dec.Offset(), err)
+		}
+		sendPacket.ClientSeq = uint64(clientSeq)
 	}
-	sendPacket.ClientSeq = uint64(clientSeq)
 	// // 客户端唯一标示
 	if sendPacket.ClientMsgNo, err = dec.String(); err != nil {
-		return nil, errors.Wrap(err, "解码ClientMsgNo失败！")
+		return newDecodeError(SEND, "ClientMsgNo", dec.Offset(), err)
 	}
 	// 是否开启了stream
 	if version >= 2 && sendPacket.Setting.IsSet(SettingStream) {
 		// 流式编号
 		if sendPacket.StreamNo, err = dec.String(); err != nil {
-			return nil, errors.Wrap(err, "解码StreamNo失败！")
+			return newDecodeError(SEND, "StreamNo", dec.Offset(), err)
 		}
 	}
 	// 频道ID
 	if sendPacket.ChannelID, err = dec.String(); err != nil {
-		return nil, errors.Wrap(err, "解码ChannelId失败！")
+		return newDecodeError(SEND, "ChannelID", dec.Offset(), err)
 	}
 	// 频道类型
 	if sendPacket.ChannelType, err = dec.Uint8(); err != nil {
 
-		return nil, errors.Wrap(err, "解码ChannelType失败！")
+		return newDecodeError(SEND, "ChannelType", dec.Offset(), err)
 	}
 	// 消息过期时间
 	if version >= 3 {
 		if sendPacket.Expire, err = dec.Uint32(); err != nil {
-			return nil, errors.Wrap(err, "解码Expire失败！")
+			return newDecodeError(SEND, "Expire", dec.Offset(), err)
 		}
 	}
 	// msg key
 	if sendPacket.MsgKey, err = dec.String(); err != nil {
-		return nil, errors.Wrap(err, "解码MsgKey失败！")
+		return newDecodeError(SEND, "MsgKey", dec.Offset(), err)
 	}
 	if sendPacket.Setting.IsSet(SettingTopic) {
 		// topic
 		if sendPacket.Topic, err = dec.String(); err != nil {
-			return nil, errors.Wrap(err, "解密topic消息失败！")
+			return newDecodeError(SEND, "Topic", dec.Offset(), err)
 		}
 	}
 	if sendPacket.Payload, err = dec.BinaryAll(); err != nil {
-		return nil, errors.Wrap(err, "解码payload失败！")
+		return newDecodeError(SEND, "Payload", dec.Offset(), err)
 	}
-	return sendPacket, err
+	return nil
 }
 
 func encodeSend(frame Frame, enc *Encoder, version uint8) error {
 	sendPacket := frame.(*SendPacket)
 
-	_ = enc.WriteByte(sendPacket.Setting.Uint8())
+	_ = enc.Field("Setting").WriteByte(sendPacket.Setting.Uint8())
 	// 消息序列号(客户端维护)
-	enc.WriteUint32(uint32(sendPacket.ClientSeq))
+	if version >= 5 {
+		enc.Field("ClientSeq").WriteUint64(sendPacket.ClientSeq)
+	} else {
+		enc.Field("ClientSeq").WriteUint32Of64(sendPacket.ClientSeq)
+	}
 	// 客户端唯一标示
-	enc.WriteString(sendPacket.ClientMsgNo)
+	enc.Field("ClientMsgNo").WriteString(sendPacket.ClientMsgNo)
 	// 是否开启了stream
 	if version >= 2 && sendPacket.Setting.IsSet(SettingStream) {
 		// 流式编号
-		enc.WriteString(sendPacket.StreamNo)
+		enc.Field("StreamNo").WriteString(sendPacket.StreamNo)
 	}
 	// 频道ID
-	enc.WriteString(sendPacket.ChannelID)
+	enc.Field("ChannelID").WriteString(sendPacket.ChannelID)
 	// 频道类型
-	enc.WriteUint8(sendPacket.ChannelType)
+	enc.Field("ChannelType").WriteUint8(sendPacket.ChannelType)
 	// 消息过期时间
 	if version >= 3 {
-		enc.WriteUint32(sendPacket.Expire)
+		enc.Field("Expire").WriteUint32(sendPacket.Expire)
 	}
 	// msgKey
-	enc.WriteString(sendPacket.MsgKey)
+	enc.Field("MsgKey").WriteString(sendPacket.MsgKey)
 
 	if sendPacket.Setting.IsSet(SettingTopic) {
-		enc.WriteString(sendPacket.Topic)
+		enc.Field("Topic").WriteString(sendPacket.Topic)
 	}
 	// 消息内容
-	enc.WriteBytes(sendPacket.Payload)
+	enc.Field("Payload").WriteBytes(sendPacket.Payload)
 
-	return nil
+	return enc.Err()
 }
 
 func encodeSendSize(frame Frame, version uint8) int {
 	sendPacket := frame.(*SendPacket)
 	size := 0
 	size += SettingByteSize
-	size += ClientSeqByteSize
+	if version >= 5 {
+		size += ClientSeq64ByteSize
+	} else {
+		size += ClientSeqByteSize
+	}
 	size += (len(sendPacket.ClientMsgNo) + StringFixLenByteSize)
 	if version >= 2 && sendPacket.Setting.IsSet(SettingStream) {
 		size += (len(sendPacket.StreamNo) + StringFixLenByteSize)
@@ -0,0 +1,64 @@
+package msproto
+
+import (
+	"math"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestClientSeqOverflow(t *testing.T) {
+	proto := New()
+	tests := []struct {
+		name      string
+		frame     func(clientSeq uint64) Frame
+		clientSeq func(Frame) uint64
+	}{
+		{
+			"SEND",
+			func(clientSeq uint64) Frame {
+				return &SendPacket{ClientSeq: clientSeq, ChannelID: "c", ChannelType: ChannelTypePerson}
+			},
+			func(f Frame) uint64 { return f.(*SendPacket).ClientSeq },
+		},
+		{
+			"SENDACK",
+			func(clientSeq uint64) Frame { return &SendackPacket{ClientSeq: clientSeq, ReasonCode: ReasonSuccess} },
+			func(f Frame) uint64 { return f.(*SendackPacket).ClientSeq },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, c := range []struct {
+				version   uint8
+				clientSeq uint64
+				err       error
+			}{
+				{4, math.MaxUint32, nil},
+				{4, math.MaxUint32 + 1, ErrFieldOverflow},
+				{4, math.MaxUint64, ErrFieldOverflow},
+				{5, math.MaxUint32 + 1, nil},
+				{5, math.MaxUint64, nil},
+			} {
+				data, err := proto.EncodeFrame(tt.frame(c.clientSeq), c.version)
+				if !errors.Is(err, c.err) {
+					t.Fatalf("version %d ClientSeq %d: err = %v, want %v", c.version, c.clientSeq, err, c.err)
+				}
+				if err != nil {
+					var encodeErr *EncodeError
+					if !errors.As(err, &encodeErr) || encodeErr.Field != "ClientSeq" {
+						t.Fatalf("err = %v, want EncodeError on ClientSeq", err)
+					}
+					continue
+				}
+				frame, _, err := proto.DecodeFrame(data, c.version)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := tt.clientSeq(frame); got != c.clientSeq {
+					t.Fatalf("version %d ClientSeq = %d, want %d", c.version, got, c.clientSeq)
+				}
+			}
+		})
+	}
+}
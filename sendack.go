@@ -2,8 +2,6 @@ package msproto
 
 import (
 	"fmt"
-
-	"github.com/pkg/errors"
 )
 
 // SendackPacket 发送回执包
@@ -16,6 +14,16 @@ type SendackPacket struct {
 	ReasonCode  ReasonCode // 原因代码
 }
 
+// Reset 重置包，用于复用
+func (s *SendackPacket) Reset() {
+	s.Framer = Framer{}
+	s.MessageID = 0
+	s.MessageSeq = 0
+	s.ClientSeq = 0
+	s.ClientMsgNo = ""
+	s.ReasonCode = 0
+}
+
 // GetPacketType 包类型
 func (s *SendackPacket) GetFrameType() FrameType {
 	return SENDACK
@@ -25,45 +33,67 @@ func (s *SendackPacket) String() string {
 }
 
 func decodeSendack(frame Frame, data []byte, version uint8) (Frame, error) {
-	dec := NewDecoder(data)
 	sendackPacket := &SendackPacket{}
-	sendackPacket.Framer = frame.(Framer)
+	if err := decodeSendackInto(sendackPacket, framerOf(frame), NewDecoder(data), version); err != nil {
+		return nil, err
+	}
+	return sendackPacket, nil
+}
+
+// decodeSendackInto 解码到已有的包
+func decodeSendackInto(sendackPacket *SendackPacket, framer Framer, dec *Decoder, version uint8) error {
+	sendackPacket.Reset()
+	sendackPacket.Framer = framer
 	var err error
 	// messageID
 	if sendackPacket.MessageID, err = dec.Int64(); err != nil {
-		return nil, errors.Wrap(err, "解码MessageId失败！")
+		return newDecodeError(SENDACK, "MessageID", dec.Offset(), err)
 	}
 	// clientSeq
-	var clientSeq uint32
-	if clientSeq, err = dec.Uint32(); err != nil {
-		return nil, errors.Wrap(err, "解码ClientSeq失败！")
+	if version >= 5 {
+		if sendackPacket.ClientSeq, err = dec.Uint64(); err != nil {
+			return newDecodeError(SENDACK, "ClientSeq", dec.Offset(), err)
+		}
+	} else {
+		var clientSeq uint32
+		if clientSeq, err = dec.Uint32(); err != nil {
+			return newDecodeError(SENDACK, "ClientSeq", dec.Offset(), err)
+		}
+		sendackPacket.ClientSeq = uint64(clientSeq)
 	}
-	sendackPacket.ClientSeq = uint64(clientSeq)
 	// messageSeq
 	if sendackPacket.MessageSeq, err = dec.Uint32(); err != nil {
-		return nil, errors.Wrap(err, "解码MessageSeq失败！")
+		return newDecodeError(SENDACK, "MessageSeq", dec.Offset(), err)
 	}
 	// 原因代码
 	var reasonCode uint8
 	if reasonCode, err = dec.Uint8(); err != nil {
-		return nil, errors.Wrap(err, "解码ChannelType失败！")
+		return newDecodeError(SENDACK, "ReasonCode", dec.Offset(), err)
 	}
 	sendackPacket.ReasonCode = ReasonCode(reasonCode)
-	return sendackPacket, err
+	return nil
 }
 
-func encodeSendack(sendackPacket *SendackPacket, enc *Encoder, _ uint8) error {
+func encodeSendack(frame Frame, enc *Encoder, version uint8) error {
+	sendackPacket := frame.(*SendackPacket)
 	// 消息唯一ID
-	enc.WriteInt64(sendackPacket.MessageID)
+	enc.Field("MessageID").WriteInt64(sendackPacket.MessageID)
 	// clientSeq
-	enc.WriteUint32(uint32(sendackPacket.ClientSeq))
+	if version >= 5 {
+		enc.Field("ClientSeq").WriteUint64(sendackPacket.ClientSeq)
+	} else {
+		enc.Field("ClientSeq").WriteUint32Of64(sendackPacket.ClientSeq)
+	}
 	// 消息序列号(客户端维护)
-	enc.WriteUint32(sendackPacket.MessageSeq)
+	enc.Field("MessageSeq").WriteUint32(sendackPacket.MessageSeq)
 	// 原因代码
-	enc.WriteUint8(sendackPacket.ReasonCode.Byte())
-	return nil
+	enc.Field("ReasonCode").WriteUint8(sendackPacket.ReasonCode.Byte())
+	return enc.Err()
 }
 
-func encodeSendackSize(_ *SendackPacket, _ uint8) int {
+func encodeSendackSize(_ Frame, version uint8) int {
+	if version >= 5 {
+		return MessageIDByteSize + ClientSeq64ByteSize + MessageSeqByteSize + ReasonCodeByteSize
+	}
 	return MessageIDByteSize + ClientSeqByteSize + MessageSeqByteSize + ReasonCodeByteSize
 }
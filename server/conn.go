@@ -0,0 +1,287 @@
+package server
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	msproto "github.com/mushanyux/MSIMGoProto"
+	"github.com/pkg/errors"
+)
+
+// Conn 服务端的一个连接
+type Conn struct {
+	id      int64
+	server  *Server
+	conn    net.Conn
+	codec   *msproto.Codec
+	cipher  msproto.PayloadCipher // OnConnect中设置，握手时与协商后的编解码器绑定
+	connect *msproto.ConnectPacket
+
+	accepted    bool // 已调用OnConnect
+	writeLock   sync.Mutex
+	established bool // 已发送成功的CONNACK
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// ID 连接ID，在同一个Server内唯一
+func (c *Conn) ID() int64 {
+	return c.id
+}
+
+// Connect 客户端发送的CONNECT
+func (c *Conn) Connect() *msproto.ConnectPacket {
+	return c.connect
+}
+
+// UID 用户ID
+func (c *Conn) UID() string {
+	if c.connect == nil {
+		return ""
+	}
+	return c.connect.UID
+}
+
+// DeviceFlag 设备标示
+func (c *Conn) DeviceFlag() msproto.DeviceFlag {
+	if c.connect == nil {
+		return 0
+	}
+	return c.connect.DeviceFlag
+}
+
+// DeviceID 设备ID
+func (c *Conn) DeviceID() string {
+	if c.connect == nil {
+		return ""
+	}
+	return c.connect.DeviceID
+}
+
+// Version 协商后的协议版本，OnConnect返回之前为0
+func (c *Conn) Version() uint8 {
+	if c.codec == nil {
+		return 0
+	}
+	return c.codec.Version()
+}
+
+// Codec 绑定协商版本的编解码器，OnConnect返回之前为nil
+func (c *Conn) Codec() *msproto.Codec {
+	return c.codec
+}
+
+// SetPayloadCipher 设置Payload加解密，只能在OnConnect中调用
+func (c *Conn) SetPayloadCipher(cipher msproto.PayloadCipher) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	if c.established {
+		return errors.New("payload cipher must be set before the connection is established")
+	}
+	c.cipher = cipher
+	return nil
+}
+
+// RemoteAddr 远端地址
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// NetConn 底层连接
+func (c *Conn) NetConn() net.Conn {
+	return c.conn
+}
+
+// WriteFrame 编码并发送一个包，可以并发调用，握手完成之前返回ErrNotEstablished
+func (c *Conn) WriteFrame(frame msproto.Frame) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	if !c.established {
+		return ErrNotEstablished
+	}
+	return c.writeFrame(frame)
+}
+
+func (c *Conn) writeFrame(frame msproto.Frame) error {
+	data, err := c.codec.EncodeFrame(frame)
+	if err != nil {
+		return err
+	}
+	_, err = c.conn.Write(data)
+	return err
+}
+
+// WriteRecv 推送消息
+func (c *Conn) WriteRecv(p *msproto.RecvPacket) error {
+	return c.WriteFrame(p)
+}
+
+// Close 关闭连接
+func (c *Conn) Close() error {
+	c.closeOnce.Do(func() {
+		c.closeErr = c.conn.Close()
+	})
+	return c.closeErr
+}
+
+// handshake 读取CONNECT并回复CONNACK，返回是否握手成功
+func (c *Conn) handshake() bool {
+	opts := c.server.opts
+	proto := opts.Proto
+	if opts.ConnectTimeout > 0 {
+		if err := c.conn.SetReadDeadline(time.Now().Add(opts.ConnectTimeout)); err != nil {
+			return false
+		}
+	}
+	// CONNECT的格式与版本无关，使用服务端支持的最高版本解码
+	frame, err := proto.DecodePacketWithConn(c.conn, proto.Options().MaxVersion)
+	if err != nil {
+		return false
+	}
+	connect, ok := frame.(*msproto.ConnectPacket)
+	if !ok {
+		return false
+	}
+	c.connect = connect
+
+	var connack *msproto.ConnackPacket
+	if guard := opts.ReplayGuard; guard != nil && guard.CheckConnect(connect) != nil {
+		// 没有交给Handler，不会调用OnDisconnect
+		connack = &msproto.ConnackPacket{
+			ReasonCode: guard.opts.ReasonCode,
+			TimeDiff:   guard.TimeDiff(connect),
+		}
+	} else {
+		c.accepted = true
+		if connack = c.server.handler.OnConnect(c, connect); connack == nil {
+			connack = &msproto.ConnackPacket{ReasonCode: msproto.ReasonSystemError}
+		}
+	}
+	if err = c.conn.SetReadDeadline(time.Time{}); err != nil {
+		return false
+	}
+
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	// 协商版本并写入CONNACK的ServerVersion
+	codec, err := proto.ServerCodec(connect, connack)
+	if err != nil {
+		return false
+	}
+	c.codec = codec.WithPayloadCipher(c.cipher)
+	if err = c.writeFrame(connack); err != nil {
+		return false
+	}
+	if connack.ReasonCode != msproto.ReasonSuccess {
+		return false
+	}
+	c.established = true
+	return true
+}
+
+// serve 读取并分发包，直到连接断开，客户端主动断开时返回DISCONNECT
+func (c *Conn) serve() (*msproto.DisconnectPacket, error) {
+	handler := c.server.handler
+	reader := c.codec.NewFrameReader(c.conn)
+	for {
+		frame, err := reader.ReadFrame()
+		if err != nil {
+			rejected, rejectErr := c.rejectPayload(err)
+			if !rejected {
+				return nil, err
+			}
+			if rejectErr != nil {
+				return nil, rejectErr
+			}
+			continue
+		}
+		switch p := frame.(type) {
+		case *msproto.SendPacket:
+			if err = c.onSend(p); err != nil {
+				return nil, err
+			}
+		case *msproto.RecvackPacket:
+			handler.OnRecvack(c, p)
+		case *msproto.SubPacket:
+			suback := handler.OnSub(c, p)
+			if suback == nil {
+				continue
+			}
+			if err = c.WriteFrame(suback); err != nil {
+				return nil, err
+			}
+		case *msproto.PingPacket:
+			if err = c.WriteFrame(&msproto.PongPacket{}); err != nil {
+				return nil, err
+			}
+			handler.OnPing(c)
+		case *msproto.DisconnectPacket:
+			return p, nil
+		case *msproto.ConnectPacket:
+			return nil, errors.New("duplicate CONNECT")
+		default:
+			if fh, ok := handler.(FrameHandler); ok {
+				fh.OnFrame(c, frame)
+			}
+		}
+	}
+}
+
+// onSend 交给Handler处理SEND并回复SENDACK，重复的SEND直接回复第一次处理时的SENDACK
+func (c *Conn) onSend(p *msproto.SendPacket) error {
+	guard := c.server.opts.ReplayGuard
+	if guard != nil {
+		if sendack, replayed := guard.CheckSend(c.UID(), p); replayed {
+			if sendack == nil {
+				return nil
+			}
+			return c.WriteFrame(sendack)
+		}
+	}
+	sendack := c.server.handler.OnSend(c, p)
+	if sendack != nil {
+		if sendack.ClientSeq == 0 {
+			sendack.ClientSeq = p.ClientSeq
+		}
+		if sendack.ClientMsgNo == "" {
+			sendack.ClientMsgNo = p.ClientMsgNo
+		}
+	}
+	if guard != nil {
+		guard.RecordSendack(c.UID(), p, sendack)
+	}
+	if sendack == nil {
+		return nil
+	}
+	return c.WriteFrame(sendack)
+}
+
+// rejectPayload MsgKey校验或者Payload解密失败的SEND回复对应的原因码，返回err是否属于此类错误
+// 此类错误的包已经被完整读取，回复失败后可以继续读取
+func (c *Conn) rejectPayload(err error) (bool, error) {
+	var (
+		frame      msproto.Frame
+		reasonCode msproto.ReasonCode
+	)
+	var payloadErr *msproto.PayloadError
+	var msgKeyErr *msproto.MsgKeyError
+	switch {
+	case errors.As(err, &payloadErr):
+		frame, reasonCode = payloadErr.Frame, payloadErr.ReasonCode()
+	case errors.As(err, &msgKeyErr):
+		frame, reasonCode = msgKeyErr.Frame, msgKeyErr.ReasonCode()
+	default:
+		return false, nil
+	}
+	p, ok := frame.(*msproto.SendPacket)
+	if !ok {
+		return true, nil
+	}
+	return true, c.WriteFrame(&msproto.SendackPacket{
+		ClientSeq:   p.ClientSeq,
+		ClientMsgNo: p.ClientMsgNo,
+		ReasonCode:  reasonCode,
+	})
+}
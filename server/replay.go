@@ -0,0 +1,224 @@
+package server
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	msproto "github.com/mushanyux/MSIMGoProto"
+	"github.com/pkg/errors"
+)
+
+// ErrTimestampOutOfWindow CONNECT的ClientTimestamp为空或者与服务端时间相差超过ConnectWindow
+var ErrTimestampOutOfWindow = errors.New("client timestamp out of window")
+
+// ReplayOptions 防重放配置
+type ReplayOptions struct {
+	ConnectWindow time.Duration      // CONNECT的ClientTimestamp与服务端时间允许的最大差值
+	ReasonCode    msproto.ReasonCode // 拒绝CONNECT时CONNACK的原因码
+	SendTTL       time.Duration      // SEND的UniqueKey在此时间内不能重复
+	MaxEntries    int                // 最多记录的SEND数量，记录满时以ReasonRateLimit拒绝新的SEND，不淘汰还在有效期内的记录
+	Now           func() time.Time   // 当前时间
+}
+
+// NewReplayOptions 默认配置
+func NewReplayOptions() *ReplayOptions {
+	return &ReplayOptions{
+		ConnectWindow: 5 * time.Minute,
+		ReasonCode:    msproto.ReasonSystemError,
+		SendTTL:       10 * time.Minute,
+		MaxEntries:    100000,
+		Now:           time.Now,
+	}
+}
+
+type ReplayOption func(*ReplayOptions)
+
+// WithConnectWindow CONNECT的ClientTimestamp允许的最大误差
+func WithConnectWindow(window time.Duration) ReplayOption {
+	return func(o *ReplayOptions) {
+		o.ConnectWindow = window
+	}
+}
+
+// WithConnectReasonCode 拒绝CONNECT时CONNACK的原因码
+// 默认为ReasonSystemError，客户端可以根据CONNACK中的TimeDiff校正时间后重连；
+// 使用ReasonAuthFail等原因码时客户端不会重连
+func WithConnectReasonCode(reasonCode msproto.ReasonCode) ReplayOption {
+	return func(o *ReplayOptions) {
+		o.ReasonCode = reasonCode
+	}
+}
+
+// WithSendTTL SEND去重的时间窗口
+func WithSendTTL(ttl time.Duration) ReplayOption {
+	return func(o *ReplayOptions) {
+		o.SendTTL = ttl
+	}
+}
+
+// WithMaxEntries 最多记录的SEND数量
+func WithMaxEntries(max int) ReplayOption {
+	return func(o *ReplayOptions) {
+		o.MaxEntries = max
+	}
+}
+
+// WithReplayNow 当前时间
+func WithReplayNow(now func() time.Time) ReplayOption {
+	return func(o *ReplayOptions) {
+		o.Now = now
+	}
+}
+
+// ReplayGuard 防重放：拒绝ClientTimestamp不在时间窗口内的CONNECT，以及UniqueKey在SendTTL内重复的SEND
+// SEND按 UID+UniqueKey 去重，重复的SEND不再交给Handler，回复第一次处理时的SENDACK，
+// 因此客户端因为没有收到SENDACK而重发（DUP）的SEND仍然可以得到确认
+type ReplayGuard struct {
+	opts *ReplayOptions
+
+	mu    sync.Mutex
+	sends *replayCache
+}
+
+// NewReplayGuard 创建防重放
+func NewReplayGuard(opts ...ReplayOption) *ReplayGuard {
+	o := NewReplayOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+	return &ReplayGuard{
+		opts:  o,
+		sends: newReplayCache(o.MaxEntries),
+	}
+}
+
+// TimeDiff 客户端时间与服务端的差值，单位毫秒
+func (g *ReplayGuard) TimeDiff(p *msproto.ConnectPacket) int64 {
+	if p.ClientTimestamp <= 0 {
+		return 0
+	}
+	return p.ClientTimestamp - g.opts.Now().UnixMilli()
+}
+
+// CheckConnect ClientTimestamp为空或者不在时间窗口内时返回ErrTimestampOutOfWindow
+func (g *ReplayGuard) CheckConnect(p *msproto.ConnectPacket) error {
+	if p.ClientTimestamp <= 0 {
+		return errors.Wrap(ErrTimestampOutOfWindow, "client timestamp is empty")
+	}
+	diff := g.TimeDiff(p)
+	if diff < 0 {
+		diff = -diff
+	}
+	if time.Duration(diff)*time.Millisecond > g.opts.ConnectWindow {
+		return errors.Wrapf(ErrTimestampOutOfWindow, "time diff %dms", g.TimeDiff(p))
+	}
+	return nil
+}
+
+// CheckSend SEND在SendTTL内重复时返回true以及第一次处理时的SENDACK（还没有处理完成时为nil），
+// 不重复时记录该SEND并返回false，处理完成后应调用RecordSendack
+// 记录已满时不记录该SEND，返回true以及ReasonRateLimit的SENDACK，客户端稍后可以重试；
+// 淘汰还在有效期内的记录会让重放的SEND再次交给Handler，因此不淘汰
+func (g *ReplayGuard) CheckSend(uid string, p *msproto.SendPacket) (*msproto.SendackPacket, bool) {
+	key := uid + "/" + p.UniqueKey()
+	now := g.opts.Now()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if e, ok := g.sends.get(key, now); ok {
+		return e.sendack, true
+	}
+	if !g.sends.add(key, now.Add(g.opts.SendTTL)) {
+		return &msproto.SendackPacket{
+			ClientSeq:   p.ClientSeq,
+			ClientMsgNo: p.ClientMsgNo,
+			ReasonCode:  msproto.ReasonRateLimit,
+		}, true
+	}
+	return nil, false
+}
+
+// RecordSendack 记录SEND的处理结果，之后重复的SEND回复此SENDACK
+// sendack为nil或者不成功时删除记录，客户端可以重试
+func (g *ReplayGuard) RecordSendack(uid string, p *msproto.SendPacket, sendack *msproto.SendackPacket) {
+	key := uid + "/" + p.UniqueKey()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if sendack == nil || sendack.ReasonCode != msproto.ReasonSuccess {
+		g.sends.remove(key)
+		return
+	}
+	if e, ok := g.sends.get(key, g.opts.Now()); ok {
+		ack := *sendack
+		e.sendack = &ack
+	}
+}
+
+// Len 当前记录的SEND数量
+func (g *ReplayGuard) Len() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.sends.len()
+}
+
+type replayEntry struct {
+	key     string
+	expire  time.Time
+	sendack *msproto.SendackPacket
+}
+
+// replayCache 有上限的记录，所有记录的有效期相同，按插入顺序即是按过期顺序
+type replayCache struct {
+	max     int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+func newReplayCache(max int) *replayCache {
+	return &replayCache{
+		max:     max,
+		order:   list.New(),
+		entries: map[string]*list.Element{},
+	}
+}
+
+func (c *replayCache) get(key string, now time.Time) (*replayEntry, bool) {
+	c.expire(now)
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	return el.Value.(*replayEntry), true
+}
+
+// add 添加记录，记录已满时返回false，调用前应通过get清除过期的记录
+func (c *replayCache) add(key string, expire time.Time) bool {
+	if c.max > 0 && c.order.Len() >= c.max {
+		return false
+	}
+	c.entries[key] = c.order.PushBack(&replayEntry{key: key, expire: expire})
+	return true
+}
+
+func (c *replayCache) remove(key string) {
+	if el, ok := c.entries[key]; ok {
+		c.removeElement(el)
+	}
+}
+
+func (c *replayCache) expire(now time.Time) {
+	for el := c.order.Front(); el != nil && !now.Before(el.Value.(*replayEntry).expire); el = c.order.Front() {
+		c.removeElement(el)
+	}
+}
+
+func (c *replayCache) removeElement(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.entries, el.Value.(*replayEntry).key)
+}
+
+func (c *replayCache) len() int {
+	return c.order.Len()
+}
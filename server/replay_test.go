@@ -0,0 +1,126 @@
+package server_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	msproto "github.com/mushanyux/MSIMGoProto"
+	"github.com/mushanyux/MSIMGoProto/client"
+	"github.com/mushanyux/MSIMGoProto/server"
+)
+
+func TestReplayGuardConnect(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []server.ReplayOption
+		want msproto.ReasonCode
+	}{
+		{"default", nil, msproto.ReasonSystemError},
+		{"auth fail", []server.ReplayOption{server.WithConnectReasonCode(msproto.ReasonAuthFail)}, msproto.ReasonAuthFail},
+	}
+	for _, tt := range tests {
+		h := newRecordHandler()
+		s := server.New(h, server.WithReplayGuard(server.NewReplayGuard(tt.opts...)))
+
+		// 客户端时钟快了一小时
+		_, err := client.Connect(pipe(s), "u", "ok", client.WithTimeDiff(-time.Hour.Milliseconds()))
+		var connackErr *client.ConnackError
+		if !errors.As(err, &connackErr) || connackErr.ReasonCode != tt.want {
+			t.Fatalf("%s: err = %v, want ConnackError %s", tt.name, err, tt.want)
+		}
+		if diff := time.Duration(connackErr.TimeDiff) * time.Millisecond; diff < time.Hour-time.Minute || diff > time.Hour {
+			t.Errorf("%s: TimeDiff = %s, want about 1h", tt.name, diff)
+		}
+		if client.IsFatal(err) != (tt.want == msproto.ReasonAuthFail) {
+			t.Errorf("%s: IsFatal = %v", tt.name, client.IsFatal(err))
+		}
+		// 被拒绝的CONNECT不交给Handler
+		select {
+		case e := <-h.events:
+			t.Fatalf("%s: unexpected event %s", tt.name, e.name)
+		case <-time.After(10 * time.Millisecond):
+		}
+
+		// 在时间窗口内正常连接
+		sess, err := client.Connect(pipe(s), "u", "ok", client.WithTimeDiff(-time.Minute.Milliseconds()))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		h.next(t, "connect")
+		_ = sess.Close()
+		_ = s.Close()
+	}
+}
+
+func TestReplayGuardSend(t *testing.T) {
+	h := newRecordHandler()
+	s := server.New(h, server.WithReplayGuard(server.NewReplayGuard()))
+	defer s.Close()
+	sess, err := client.Connect(pipe(s), "u", "ok")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sess.Close()
+	h.next(t, "connect")
+	h.next(t, "established")
+
+	p := &msproto.SendPacket{ClientSeq: 1, ClientMsgNo: "m1", ChannelID: "c", ChannelType: msproto.ChannelTypePerson, Payload: []byte("hi")}
+	dup := *p
+	dup.DUP = true
+	for i, frame := range []*msproto.SendPacket{p, &dup} {
+		if err = sess.WriteFrame(frame); err != nil {
+			t.Fatal(err)
+		}
+		reply, err := sess.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 重发的SEND得到第一次处理时的SENDACK
+		if ack, ok := reply.(*msproto.SendackPacket); !ok || ack.MessageID != 9 || ack.ClientSeq != 1 {
+			t.Fatalf("#%d: got %v, want SENDACK MessageID 9", i, reply)
+		}
+	}
+	h.next(t, "send")
+	select {
+	case e := <-h.events:
+		t.Fatalf("duplicate SEND reached the handler: %s", e.name)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestReplayGuardMaxEntries(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	guard := server.NewReplayGuard(server.WithMaxEntries(2), server.WithSendTTL(time.Minute), server.WithReplayNow(func() time.Time {
+		return now
+	}))
+	send := func(clientMsgNo string) *msproto.SendPacket {
+		return &msproto.SendPacket{ClientSeq: 1, ClientMsgNo: clientMsgNo, ChannelID: "c", ChannelType: msproto.ChannelTypePerson}
+	}
+
+	for _, clientMsgNo := range []string{"m1", "m2"} {
+		if _, replayed := guard.CheckSend("u", send(clientMsgNo)); replayed {
+			t.Fatalf("%s: replayed", clientMsgNo)
+		}
+	}
+	// 记录已满时拒绝新的SEND，而不是淘汰还在有效期内的记录
+	sendack, replayed := guard.CheckSend("u", send("m3"))
+	if !replayed || sendack == nil || sendack.ReasonCode != msproto.ReasonRateLimit || sendack.ClientMsgNo != "m3" {
+		t.Fatalf("CheckSend on a full guard = %v, %v, want a ReasonRateLimit SENDACK", sendack, replayed)
+	}
+	if _, replayed = guard.CheckSend("u", send("m1")); !replayed {
+		t.Fatal("live entry m1 was evicted")
+	}
+	if guard.Len() != 2 {
+		t.Fatalf("Len = %d, want 2", guard.Len())
+	}
+
+	// 过期的记录被清除后可以记录新的SEND
+	now = now.Add(time.Minute)
+	if sendack, replayed = guard.CheckSend("u", send("m3")); replayed {
+		t.Fatalf("CheckSend after expiry = %v, want accepted", sendack)
+	}
+	if guard.Len() != 1 {
+		t.Fatalf("Len = %d, want 1", guard.Len())
+	}
+}
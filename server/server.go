@@ -0,0 +1,218 @@
+// Package server MSProto服务端框架，负责接受连接、解码包并分发给Handler
+package server
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	msproto "github.com/mushanyux/MSIMGoProto"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrServerClosed 服务已关闭
+	ErrServerClosed = errors.New("server closed")
+	// ErrNotEstablished 连接还没有完成握手
+	ErrNotEstablished = errors.New("connection not established")
+)
+
+// Handler 各类型包的处理接口，同一个连接上的回调在同一个goroutine中按顺序执行
+type Handler interface {
+	// OnConnect 收到CONNECT，返回的CONNACK的ReasonCode不是ReasonSuccess时，发送CONNACK后关闭连接
+	OnConnect(c *Conn, p *msproto.ConnectPacket) *msproto.ConnackPacket
+	// OnSend 收到SEND，返回的SENDACK不为nil时发送给客户端
+	OnSend(c *Conn, p *msproto.SendPacket) *msproto.SendackPacket
+	// OnRecvack 收到RECVACK
+	OnRecvack(c *Conn, p *msproto.RecvackPacket)
+	// OnSub 收到SUB，返回的SUBACK不为nil时发送给客户端
+	OnSub(c *Conn, p *msproto.SubPacket) *msproto.SubackPacket
+	// OnPing 收到PING，PONG已自动回复
+	OnPing(c *Conn)
+	// OnDisconnect 调用过OnConnect的连接断开（包括CONNACK不成功的连接），客户端主动发送DISCONNECT时p不为nil
+	OnDisconnect(c *Conn, p *msproto.DisconnectPacket)
+}
+
+// FrameHandler 可选接口，Handler实现此接口时，内置之外的包（如自定义包类型）交由OnFrame处理
+type FrameHandler interface {
+	OnFrame(c *Conn, frame msproto.Frame)
+}
+
+// EstablishedHandler 可选接口，Handler实现此接口时，成功的CONNACK发送后调用OnEstablished，此后可以向连接推送包
+type EstablishedHandler interface {
+	OnEstablished(c *Conn)
+}
+
+// Options 服务端配置
+type Options struct {
+	Proto          *msproto.MSProto // 协议对象
+	ConnectTimeout time.Duration    // 连接建立后等待CONNECT的超时时间
+	ReplayGuard    *ReplayGuard     // 防重放，为nil时不检查
+}
+
+// NewOptions 默认配置
+func NewOptions() *Options {
+	return &Options{
+		ConnectTimeout: 10 * time.Second,
+	}
+}
+
+type Option func(*Options)
+
+// WithProto 协议对象，默认开启CopyPayload，Handler可以安全地保存收到的包
+func WithProto(proto *msproto.MSProto) Option {
+	return func(o *Options) {
+		o.Proto = proto
+	}
+}
+
+// WithConnectTimeout 等待CONNECT的超时时间
+func WithConnectTimeout(timeout time.Duration) Option {
+	return func(o *Options) {
+		o.ConnectTimeout = timeout
+	}
+}
+
+// WithReplayGuard 防重放，ClientTimestamp不在时间窗口内的CONNECT回复ReplayOptions.ReasonCode，重复的SEND不交给Handler
+func WithReplayGuard(guard *ReplayGuard) Option {
+	return func(o *Options) {
+		o.ReplayGuard = guard
+	}
+}
+
+// Server 服务端
+type Server struct {
+	opts    *Options
+	handler Handler
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[*Conn]struct{}
+	connID    int64
+	closed    bool
+}
+
+// New 创建服务端
+func New(handler Handler, opts ...Option) *Server {
+	o := NewOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.Proto == nil {
+		o.Proto = msproto.New(msproto.WithCopyPayload(true))
+	}
+	return &Server{
+		opts:      o,
+		handler:   handler,
+		listeners: map[net.Listener]struct{}{},
+		conns:     map[*Conn]struct{}{},
+	}
+}
+
+// Serve 在ln上接受连接，直到ln出错或者服务关闭
+func (s *Server) Serve(ln net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrServerClosed
+	}
+	s.listeners[ln] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, ln)
+		s.mu.Unlock()
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+			return err
+		}
+		go s.ServeConn(conn)
+	}
+}
+
+// ServeConn 处理一个连接，直到连接断开
+func (s *Server) ServeConn(conn net.Conn) {
+	c, ok := s.newConn(conn)
+	if !ok {
+		_ = conn.Close()
+		return
+	}
+	defer s.removeConn(c)
+
+	var disconnect *msproto.DisconnectPacket
+	if c.handshake() {
+		if eh, ok := s.handler.(EstablishedHandler); ok {
+			eh.OnEstablished(c)
+		}
+		disconnect, _ = c.serve()
+	}
+	_ = c.Close()
+	if c.accepted {
+		s.handler.OnDisconnect(c, disconnect)
+	}
+}
+
+// Close 关闭服务以及所有连接
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	listeners := make([]net.Listener, 0, len(s.listeners))
+	for ln := range s.listeners {
+		listeners = append(listeners, ln)
+	}
+	conns := make([]*Conn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+
+	var err error
+	for _, ln := range listeners {
+		if e := ln.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	for _, c := range conns {
+		_ = c.Close()
+	}
+	return err
+}
+
+// Proto 协议对象
+func (s *Server) Proto() *msproto.MSProto {
+	return s.opts.Proto
+}
+
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+func (s *Server) newConn(conn net.Conn) (*Conn, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, false
+	}
+	s.connID++
+	c := &Conn{
+		id:     s.connID,
+		server: s,
+		conn:   conn,
+	}
+	s.conns[c] = struct{}{}
+	return c, true
+}
+
+func (s *Server) removeConn(c *Conn) {
+	s.mu.Lock()
+	delete(s.conns, c)
+	s.mu.Unlock()
+}
@@ -0,0 +1,166 @@
+package server_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	msproto "github.com/mushanyux/MSIMGoProto"
+	"github.com/mushanyux/MSIMGoProto/client"
+	"github.com/mushanyux/MSIMGoProto/server"
+)
+
+type event struct {
+	name    string
+	version uint8
+	frame   msproto.Frame
+}
+
+type recordHandler struct {
+	events chan event
+}
+
+func newRecordHandler() *recordHandler {
+	return &recordHandler{events: make(chan event, 16)}
+}
+
+func (h *recordHandler) OnConnect(c *server.Conn, p *msproto.ConnectPacket) *msproto.ConnackPacket {
+	h.events <- event{"connect", c.Version(), p}
+	if p.Token != "ok" {
+		return &msproto.ConnackPacket{ReasonCode: msproto.ReasonAuthFail}
+	}
+	return &msproto.ConnackPacket{ReasonCode: msproto.ReasonSuccess}
+}
+
+func (h *recordHandler) OnEstablished(c *server.Conn) {
+	h.events <- event{"established", c.Version(), nil}
+}
+
+func (h *recordHandler) OnSend(c *server.Conn, p *msproto.SendPacket) *msproto.SendackPacket {
+	h.events <- event{"send", c.Version(), p}
+	return &msproto.SendackPacket{MessageID: 9, MessageSeq: 1, ReasonCode: msproto.ReasonSuccess}
+}
+
+func (h *recordHandler) OnRecvack(c *server.Conn, p *msproto.RecvackPacket) {}
+
+func (h *recordHandler) OnSub(c *server.Conn, p *msproto.SubPacket) *msproto.SubackPacket {
+	return nil
+}
+
+func (h *recordHandler) OnPing(c *server.Conn) {
+	h.events <- event{"ping", c.Version(), nil}
+}
+
+func (h *recordHandler) OnDisconnect(c *server.Conn, p *msproto.DisconnectPacket) {
+	var frame msproto.Frame
+	if p != nil {
+		frame = p
+	}
+	h.events <- event{"disconnect", c.Version(), frame}
+}
+
+func (h *recordHandler) next(t *testing.T, name string) event {
+	t.Helper()
+	select {
+	case e := <-h.events:
+		if e.name != name {
+			t.Fatalf("event = %s, want %s", e.name, name)
+		}
+		return e
+	case <-time.After(time.Second):
+		t.Fatalf("timeout waiting for %s", name)
+	}
+	return event{}
+}
+
+func pipe(s *server.Server) net.Conn {
+	clientConn, serverConn := net.Pipe()
+	go s.ServeConn(serverConn)
+	return clientConn
+}
+
+func TestServerHandshake(t *testing.T) {
+	h := newRecordHandler()
+	s := server.New(h)
+	defer s.Close()
+
+	sess, err := client.Connect(pipe(s), "u", "ok", client.WithVersion(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sess.Close()
+	if e := h.next(t, "connect"); e.version != 0 {
+		t.Fatalf("Version in OnConnect = %d, want 0", e.version)
+	}
+	if e := h.next(t, "established"); e.version != 4 {
+		t.Fatalf("Version in OnEstablished = %d, want 4", e.version)
+	}
+	if connack := sess.Connack(); !connack.HasServerVersion || connack.ServerVersion != 4 {
+		t.Fatalf("CONNACK server version = %v/%d, want true/4", connack.HasServerVersion, connack.ServerVersion)
+	}
+
+	if err = sess.WriteFrame(&msproto.SendPacket{ClientSeq: 7, ClientMsgNo: "m", ChannelID: "c", ChannelType: msproto.ChannelTypePerson}); err != nil {
+		t.Fatal(err)
+	}
+	h.next(t, "send")
+	frame, err := sess.ReadFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Handler没有设置的ClientSeq由SEND补全
+	if ack, ok := frame.(*msproto.SendackPacket); !ok || ack.ClientSeq != 7 || ack.MessageID != 9 {
+		t.Fatalf("got %v, want SENDACK for ClientSeq 7", frame)
+	}
+
+	if err = sess.WriteFrame(&msproto.PingPacket{}); err != nil {
+		t.Fatal(err)
+	}
+	if frame, err = sess.ReadFrame(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := frame.(*msproto.PongPacket); !ok {
+		t.Fatalf("got %v, want PONG", frame)
+	}
+	h.next(t, "ping")
+
+	if err = sess.WriteFrame(&msproto.DisconnectPacket{ReasonCode: msproto.ReasonSuccess, Reason: "bye"}); err != nil {
+		t.Fatal(err)
+	}
+	if e := h.next(t, "disconnect"); e.frame == nil || e.frame.(*msproto.DisconnectPacket).Reason != "bye" {
+		t.Fatalf("OnDisconnect packet = %v, want DISCONNECT bye", e.frame)
+	}
+}
+
+func TestServerRejectedConnect(t *testing.T) {
+	h := newRecordHandler()
+	s := server.New(h)
+	defer s.Close()
+
+	if _, err := client.Connect(pipe(s), "u", "bad"); err == nil {
+		t.Fatal("connect with bad token succeeded")
+	}
+	h.next(t, "connect")
+	// CONNACK不成功的连接同样调用OnDisconnect
+	if e := h.next(t, "disconnect"); e.frame != nil {
+		t.Fatalf("OnDisconnect packet = %v, want nil", e.frame)
+	}
+}
+
+func TestServerRequiresConnectFirst(t *testing.T) {
+	h := newRecordHandler()
+	s := server.New(h)
+	defer s.Close()
+
+	conn := pipe(s)
+	defer conn.Close()
+	go func() { _, _ = conn.Write([]byte{byte(msproto.PING) << 4}) }()
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Fatal("server replied to a frame before CONNECT")
+	}
+	select {
+	case e := <-h.events:
+		t.Fatalf("unexpected event %s", e.name)
+	default:
+	}
+}
@@ -1,7 +1,5 @@
 package msproto
 
-import "github.com/pkg/errors"
-
 type SubPacket struct {
 	Framer
 	Setting     Setting
@@ -12,61 +10,80 @@ type SubPacket struct {
 	Param       string // 参数
 }
 
+// Reset 重置包，用于复用
+func (s *SubPacket) Reset() {
+	s.Framer = Framer{}
+	s.Setting = 0
+	s.SubNo = ""
+	s.ChannelID = ""
+	s.ChannelType = 0
+	s.Action = 0
+	s.Param = ""
+}
+
 // GetPacketType 包类型
 func (s *SubPacket) GetFrameType() FrameType {
 	return SUB
 }
 
 func decodeSub(frame Frame, data []byte, version uint8) (Frame, error) {
-	dec := NewDecoder(data)
 	subPacket := &SubPacket{}
-	subPacket.Framer = frame.(Framer)
+	if err := decodeSubInto(subPacket, framerOf(frame), NewDecoder(data), version); err != nil {
+		return nil, err
+	}
+	return subPacket, nil
+}
+
+// decodeSubInto 解码到已有的包
+func decodeSubInto(subPacket *SubPacket, framer Framer, dec *Decoder, version uint8) error {
+	subPacket.Reset()
+	subPacket.Framer = framer
 	var err error
 	setting, err := dec.Uint8()
 	if err != nil {
-		return nil, errors.Wrap(err, "解码消息设置失败！")
+		return newDecodeError(SUB, "Setting", dec.Offset(), err)
 	}
 	subPacket.Setting = Setting(setting)
 	// 客户端消息编号
 	if subPacket.SubNo, err = dec.String(); err != nil {
-		return nil, errors.Wrap(err, "解码SubNo失败！")
+		return newDecodeError(SUB, "SubNo", dec.Offset(), err)
 	}
 	// 频道ID
 	if subPacket.ChannelID, err = dec.String(); err != nil {
-		return nil, errors.Wrap(err, "解码ChannelId失败！")
+		return newDecodeError(SUB, "ChannelID", dec.Offset(), err)
 	}
 	// 频道类型
 	if subPacket.ChannelType, err = dec.Uint8(); err != nil {
 
-		return nil, errors.Wrap(err, "解码ChannelType失败！")
+		return newDecodeError(SUB, "ChannelType", dec.Offset(), err)
 	}
 	// 动作
 	var action uint8
 	if action, err = dec.Uint8(); err != nil {
-		return nil, errors.Wrap(err, "解码Action失败！")
+		return newDecodeError(SUB, "Action", dec.Offset(), err)
 	}
 	subPacket.Action = Action(action)
 	// 参数
 	if subPacket.Param, err = dec.String(); err != nil {
-		return nil, errors.Wrap(err, "解码Param失败！")
+		return newDecodeError(SUB, "Param", dec.Offset(), err)
 	}
-	return subPacket, nil
+	return nil
 }
 
 func encodeSub(frame Frame, enc *Encoder, _ uint8) error {
 	subPacket := frame.(*SubPacket)
-	_ = enc.WriteByte(subPacket.Setting.Uint8())
+	_ = enc.Field("Setting").WriteByte(subPacket.Setting.Uint8())
 	// 客户端消息编号
-	enc.WriteString(subPacket.SubNo)
+	enc.Field("SubNo").WriteString(subPacket.SubNo)
 	// 频道ID
-	enc.WriteString(subPacket.ChannelID)
+	enc.Field("ChannelID").WriteString(subPacket.ChannelID)
 	// 频道类型
-	enc.WriteUint8(subPacket.ChannelType)
+	enc.Field("ChannelType").WriteUint8(subPacket.ChannelType)
 	// 动作
-	enc.WriteUint8(subPacket.Action.Uint8())
+	enc.Field("Action").WriteUint8(subPacket.Action.Uint8())
 	// 参数
-	enc.WriteString(subPacket.Param)
-	return nil
+	enc.Field("Param").WriteString(subPacket.Param)
+	return enc.Err()
 }
 
 func encodeSubSize(frame Frame, _ uint8) int {
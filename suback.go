@@ -1,7 +1,5 @@
 package msproto
 
-import "github.com/pkg/errors"
-
 type Action uint8
 
 const (
@@ -22,57 +20,75 @@ type SubackPacket struct {
 	ReasonCode  ReasonCode // 原因码
 }
 
+// Reset 重置包，用于复用
+func (s *SubackPacket) Reset() {
+	s.Framer = Framer{}
+	s.SubNo = ""
+	s.ChannelID = ""
+	s.ChannelType = 0
+	s.Action = 0
+	s.ReasonCode = 0
+}
+
 // GetPacketType 包类型
 func (s *SubackPacket) GetFrameType() FrameType {
 	return SUBACK
 }
 
 func decodeSuback(frame Frame, data []byte, version uint8) (Frame, error) {
-	dec := NewDecoder(data)
 	subackPacket := &SubackPacket{}
-	subackPacket.Framer = frame.(Framer)
+	if err := decodeSubackInto(subackPacket, framerOf(frame), NewDecoder(data), version); err != nil {
+		return nil, err
+	}
+	return subackPacket, nil
+}
+
+// decodeSubackInto 解码到已有的包
+func decodeSubackInto(subackPacket *SubackPacket, framer Framer, dec *Decoder, version uint8) error {
+	subackPacket.Reset()
+	subackPacket.Framer = framer
 	var err error
 	// 客户端消息编号
 	if subackPacket.SubNo, err = dec.String(); err != nil {
-		return nil, errors.Wrap(err, "解码SubNo失败！")
+		return newDecodeError(SUBACK, "SubNo", dec.Offset(), err)
 	}
 	// 频道ID
 	if subackPacket.ChannelID, err = dec.String(); err != nil {
-		return nil, errors.Wrap(err, "解码ChannelId失败！")
+		return newDecodeError(SUBACK, "ChannelID", dec.Offset(), err)
 	}
 	// 频道类型
 	if subackPacket.ChannelType, err = dec.Uint8(); err != nil {
-		return nil, errors.Wrap(err, "解码ChannelType失败！")
+		return newDecodeError(SUBACK, "ChannelType", dec.Offset(), err)
 	}
 	// 动作
 	var action uint8
 	if action, err = dec.Uint8(); err != nil {
-		return nil, errors.Wrap(err, "解码Action失败！")
+		return newDecodeError(SUBACK, "Action", dec.Offset(), err)
 	}
 	subackPacket.Action = Action(action)
 	// 原因码
 	var reasonCode byte
 	if reasonCode, err = dec.Uint8(); err != nil {
 
-		return nil, errors.Wrap(err, "解码ReasonCode失败！")
+		return newDecodeError(SUBACK, "ReasonCode", dec.Offset(), err)
 	}
 	subackPacket.ReasonCode = ReasonCode(reasonCode)
-	return subackPacket, nil
+	return nil
 }
 
 func encodeSuback(frame Frame, enc *Encoder, _ uint8) error {
 	subackPacket := frame.(*SubackPacket)
 	// 客户端消息编号
-	enc.WriteString(subackPacket.SubNo)
+	enc.Field("SubNo").WriteString(subackPacket.SubNo)
 	// 频道ID
-	enc.WriteString(subackPacket.ChannelID)
+	enc.Field("ChannelID").WriteString(subackPacket.ChannelID)
 	// 频道类型
-	enc.WriteUint8(subackPacket.ChannelType)
+	enc.Field("ChannelType").WriteUint8(subackPacket.ChannelType)
 	// 动作
-	enc.WriteUint8(subackPacket.Action.Uint8())
+	enc.Field("Action").WriteUint8(subackPacket.Action.Uint8())
 	// 原因码
-	enc.WriteUint8(subackPacket.ReasonCode.Byte())
-	return nil
+	enc.Field("ReasonCode").WriteUint8(subackPacket.ReasonCode.Byte())
+	return enc.Err()
 }
 
 func encodeSubackSize(frame Frame, _ uint8) int {
@@ -0,0 +1,149 @@
+package ws
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+)
+
+// ErrTextMessage 收到了文本消息，MSProto只使用二进制消息
+var ErrTextMessage = errors.New("unexpected websocket text message")
+
+// Conn 将WebSocket连接适配为net.Conn
+// 二进制消息被视为连续的字节流，一个消息中可以包含多个包，一个包也可以拆分到多个消息中；
+// 每次Write发送一个二进制消息
+type Conn struct {
+	ws *websocket.Conn
+
+	readLock sync.Mutex
+	reader   io.Reader
+	readErr  error
+
+	writeLock sync.Mutex
+}
+
+// NewConn 包装已建立的WebSocket连接
+func NewConn(ws *websocket.Conn) *Conn {
+	return &Conn{ws: ws}
+}
+
+// WebSocket 底层WebSocket连接
+func (c *Conn) WebSocket() *websocket.Conn {
+	return c.ws
+}
+
+// Read 读取二进制消息中的数据，当前消息读完后继续读取下一个消息
+func (c *Conn) Read(b []byte) (int, error) {
+	c.readLock.Lock()
+	defer c.readLock.Unlock()
+	if len(b) == 0 {
+		return 0, nil
+	}
+	for {
+		if c.readErr != nil {
+			return 0, c.readErr
+		}
+		if c.reader == nil {
+			messageType, r, err := c.ws.NextReader()
+			if err != nil {
+				c.readErr = convertErr(err)
+				return 0, c.readErr
+			}
+			if messageType != websocket.BinaryMessage {
+				c.readErr = ErrTextMessage
+				return 0, c.readErr
+			}
+			c.reader = r
+		}
+		n, err := c.reader.Read(b)
+		if err == io.EOF {
+			c.reader = nil
+			if n == 0 {
+				continue
+			}
+			return n, nil
+		}
+		if err != nil {
+			c.readErr = convertErr(err)
+		}
+		return n, err
+	}
+}
+
+// Write 将b作为一个二进制消息发送
+func (c *Conn) Write(b []byte) (int, error) {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	if err := c.ws.WriteMessage(websocket.BinaryMessage, b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// WriteBuffers 将多段数据作为一个二进制消息发送
+func (c *Conn) WriteBuffers(buffers net.Buffers) (int64, error) {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	w, err := c.ws.NextWriter(websocket.BinaryMessage)
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, b := range buffers {
+		n, err := w.Write(b)
+		total += int64(n)
+		if err != nil {
+			_ = w.Close()
+			return total, err
+		}
+	}
+	return total, w.Close()
+}
+
+// Close 关闭连接
+func (c *Conn) Close() error {
+	return c.ws.Close()
+}
+
+// LocalAddr 本地地址
+func (c *Conn) LocalAddr() net.Addr {
+	return c.ws.LocalAddr()
+}
+
+// RemoteAddr 远端地址
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.ws.RemoteAddr()
+}
+
+// SetDeadline 设置读写超时
+func (c *Conn) SetDeadline(t time.Time) error {
+	if err := c.ws.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.ws.SetWriteDeadline(t)
+}
+
+// SetReadDeadline 设置读超时
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.ws.SetReadDeadline(t)
+}
+
+// SetWriteDeadline 设置写超时
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return c.ws.SetWriteDeadline(t)
+}
+
+// convertErr 正常关闭转换为io.EOF
+func convertErr(err error) error {
+	if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseNoStatusReceived) {
+		return io.EOF
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,112 @@
+// Package ws 通过WebSocket二进制消息传输MSProto包
+package ws
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Options WebSocket配置
+type Options struct {
+	ReadBufferSize   int                        // 读缓冲区大小
+	WriteBufferSize  int                        // 写缓冲区大小
+	HandshakeTimeout time.Duration              // WebSocket握手超时时间
+	CheckOrigin      func(r *http.Request) bool // 服务端校验Origin，为nil时只允许同源请求
+	Header           http.Header                // 客户端握手时附带的请求头
+}
+
+// NewOptions 默认配置
+func NewOptions() *Options {
+	return &Options{
+		ReadBufferSize:   4096,
+		WriteBufferSize:  4096,
+		HandshakeTimeout: 10 * time.Second,
+	}
+}
+
+type Option func(*Options)
+
+// WithBufferSize 读写缓冲区大小
+func WithBufferSize(readBufferSize, writeBufferSize int) Option {
+	return func(o *Options) {
+		o.ReadBufferSize = readBufferSize
+		o.WriteBufferSize = writeBufferSize
+	}
+}
+
+// WithHandshakeTimeout WebSocket握手超时时间
+func WithHandshakeTimeout(timeout time.Duration) Option {
+	return func(o *Options) {
+		o.HandshakeTimeout = timeout
+	}
+}
+
+// WithCheckOrigin 服务端校验Origin
+func WithCheckOrigin(checkOrigin func(r *http.Request) bool) Option {
+	return func(o *Options) {
+		o.CheckOrigin = checkOrigin
+	}
+}
+
+// WithHeader 客户端握手时附带的请求头
+func WithHeader(header http.Header) Option {
+	return func(o *Options) {
+		o.Header = header
+	}
+}
+
+func newOptions(opts []Option) *Options {
+	o := NewOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// NewHandler 创建升级WebSocket的http.Handler，升级成功后在当前goroutine中调用serve处理连接
+// 例如配合server包使用：ws.NewHandler(srv.ServeConn)
+func NewHandler(serve func(conn net.Conn), opts ...Option) http.Handler {
+	o := newOptions(opts)
+	upgrader := &websocket.Upgrader{
+		ReadBufferSize:   o.ReadBufferSize,
+		WriteBufferSize:  o.WriteBufferSize,
+		HandshakeTimeout: o.HandshakeTimeout,
+		CheckOrigin:      o.CheckOrigin,
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wsConn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			// Upgrade失败时已经回复了错误
+			return
+		}
+		serve(NewConn(wsConn))
+	})
+}
+
+// Dial 连接WebSocket地址（ws://或wss://），返回的连接可以交给client.Connect完成握手
+func Dial(url string, opts ...Option) (net.Conn, error) {
+	return DialContext(context.Background(), url, opts...)
+}
+
+// DialContext 同Dial，可以通过ctx取消
+func DialContext(ctx context.Context, url string, opts ...Option) (net.Conn, error) {
+	o := newOptions(opts)
+	dialer := &websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		ReadBufferSize:   o.ReadBufferSize,
+		WriteBufferSize:  o.WriteBufferSize,
+		HandshakeTimeout: o.HandshakeTimeout,
+	}
+	wsConn, resp, err := dialer.DialContext(ctx, url, o.Header)
+	if resp != nil && resp.Body != nil {
+		_ = resp.Body.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewConn(wsConn), nil
+}
@@ -0,0 +1,182 @@
+package ws_test
+
+import (
+	"errors"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	msproto "github.com/mushanyux/MSIMGoProto"
+	"github.com/mushanyux/MSIMGoProto/client"
+	"github.com/mushanyux/MSIMGoProto/server"
+	"github.com/mushanyux/MSIMGoProto/ws"
+)
+
+// sendackHandler SENDACK的MessageID为SEND的Payload长度
+type sendackHandler struct{}
+
+func (sendackHandler) OnConnect(c *server.Conn, p *msproto.ConnectPacket) *msproto.ConnackPacket {
+	return &msproto.ConnackPacket{ReasonCode: msproto.ReasonSuccess}
+}
+
+func (sendackHandler) OnSend(c *server.Conn, p *msproto.SendPacket) *msproto.SendackPacket {
+	return &msproto.SendackPacket{MessageID: int64(len(p.Payload)), ReasonCode: msproto.ReasonSuccess}
+}
+
+func (sendackHandler) OnRecvack(c *server.Conn, p *msproto.RecvackPacket) {}
+
+func (sendackHandler) OnSub(c *server.Conn, p *msproto.SubPacket) *msproto.SubackPacket { return nil }
+
+func (sendackHandler) OnPing(c *server.Conn) {}
+
+func (sendackHandler) OnDisconnect(c *server.Conn, p *msproto.DisconnectPacket) {}
+
+func newServer(t *testing.T) string {
+	t.Helper()
+	srv := server.New(sendackHandler{})
+	hs := httptest.NewServer(ws.NewHandler(srv.ServeConn))
+	t.Cleanup(func() {
+		_ = srv.Close()
+		hs.Close()
+	})
+	return "ws" + strings.TrimPrefix(hs.URL, "http")
+}
+
+// rawConnect 不经过Conn直接发送CONNECT，返回原始的websocket连接
+func rawConnect(t *testing.T, url string, proto *msproto.MSProto) *websocket.Conn {
+	t.Helper()
+	raw, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = raw.Close() })
+	connect, err := proto.EncodeFrame(&msproto.ConnectPacket{Version: msproto.LatestVersion, UID: "u"}, msproto.LatestVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = raw.WriteMessage(websocket.BinaryMessage, connect); err != nil {
+		t.Fatal(err)
+	}
+	frame := readMessage(t, raw, proto)
+	if connack, ok := frame.(*msproto.ConnackPacket); !ok || connack.ReasonCode != msproto.ReasonSuccess {
+		t.Fatalf("got %v, want successful CONNACK", frame)
+	}
+	return raw
+}
+
+// readMessage 读取一个消息，服务端每个消息只包含一个包
+func readMessage(t *testing.T, raw *websocket.Conn, proto *msproto.MSProto) msproto.Frame {
+	t.Helper()
+	_ = raw.SetReadDeadline(time.Now().Add(time.Second))
+	typ, data, err := raw.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ != websocket.BinaryMessage {
+		t.Fatalf("message type = %d, want binary", typ)
+	}
+	frame, n, err := proto.DecodeFrame(data, msproto.LatestVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(data) {
+		t.Fatalf("message has %d bytes, frame %d", len(data), n)
+	}
+	return frame
+}
+
+func encodeSend(t *testing.T, proto *msproto.MSProto, payload string) []byte {
+	t.Helper()
+	data, err := proto.EncodeFrame(&msproto.SendPacket{ClientSeq: 1, ChannelID: "c", ChannelType: msproto.ChannelTypePerson, Payload: []byte(payload)}, msproto.LatestVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func expectSendack(t *testing.T, raw *websocket.Conn, proto *msproto.MSProto, messageID int64) {
+	t.Helper()
+	frame := readMessage(t, raw, proto)
+	if ack, ok := frame.(*msproto.SendackPacket); !ok || ack.MessageID != messageID {
+		t.Fatalf("got %v, want SENDACK with MessageID %d", frame, messageID)
+	}
+}
+
+func TestClientSession(t *testing.T) {
+	url := newServer(t)
+	conn, err := ws.Dial(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess, err := client.Connect(conn, "u", "t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sess.Close()
+	if err = sess.WriteFrame(&msproto.SendPacket{ClientSeq: 1, ChannelID: "c", ChannelType: msproto.ChannelTypePerson, Payload: []byte("abc")}); err != nil {
+		t.Fatal(err)
+	}
+	frame, err := sess.ReadFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ack, ok := frame.(*msproto.SendackPacket); !ok || ack.MessageID != 3 {
+		t.Fatalf("got %v, want SENDACK with MessageID 3", frame)
+	}
+}
+
+func TestMultipleFramesInOneMessage(t *testing.T) {
+	proto := msproto.New()
+	raw := rawConnect(t, newServer(t), proto)
+
+	data := append(encodeSend(t, proto, "a"), encodeSend(t, proto, "bb")...)
+	if err := raw.WriteMessage(websocket.BinaryMessage, data); err != nil {
+		t.Fatal(err)
+	}
+	expectSendack(t, raw, proto, 1)
+	expectSendack(t, raw, proto, 2)
+}
+
+func TestFrameSplitAcrossMessages(t *testing.T) {
+	proto := msproto.New()
+	raw := rawConnect(t, newServer(t), proto)
+
+	data := encodeSend(t, proto, "hello")
+	// 第一段只包含固定报头的第一个字节，其余部分分在后两个消息中
+	for _, part := range [][]byte{data[:1], data[1:4], data[4:]} {
+		if err := raw.WriteMessage(websocket.BinaryMessage, part); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectSendack(t, raw, proto, 5)
+}
+
+func TestTextMessage(t *testing.T) {
+	readErr := make(chan error, 1)
+	hs := httptest.NewServer(ws.NewHandler(func(conn net.Conn) {
+		defer conn.Close()
+		_, err := conn.Read(make([]byte, 16))
+		readErr <- err
+	}))
+	defer hs.Close()
+
+	raw, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(hs.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	if err = raw.WriteMessage(websocket.TextMessage, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err = <-readErr:
+		if !errors.Is(err, ws.ErrTextMessage) {
+			t.Fatalf("Read err = %v, want %v", err, ws.ErrTextMessage)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for Read")
+	}
+}